@@ -4,16 +4,15 @@
 
 package main
 
-import (
-	"math/rand"
-	"time"
-)
+import "math/rand"
 
 // representacao da armadilha
 type Armadilha struct {
 	X, Y  int  //posicao
 	Ativa bool //se esta ativa ou nao
 	ID    int  //identificador
+
+	disparou bool // jogador ainda em cima desde o último disparo
 }
 
 // verifica se o player pisou na armadilha
@@ -22,9 +21,7 @@ func armadilhaAtivada(armadilha *Armadilha, jogo *Jogo) bool {
 }
 
 // move todas as armadilhas para novas posições aleatórias
-func moverTodasArmadilhas(armadilhas []*Armadilha, jogo *Jogo) {
-	r := rand.New(rand.NewSource(time.Now().UnixNano()))
-
+func moverTodasArmadilhas(armadilhas []*Armadilha, jogo *Jogo, r *rand.Rand) {
 	for _, armadilha := range armadilhas {
 		// For para achar um lufar para as
 		for tentativas := 0; tentativas < 50; tentativas++ { // checkup para evitar problemas de posicionamento repetido
@@ -0,0 +1,56 @@
+//go:build !server
+// +build !server
+
+// camera.go - Janela do mapa que cabe na tela
+//
+// Mapas maiores que o terminal são desenhados só em parte: a câmera é um
+// retângulo do mapa centralizado no personagem e preso às bordas do mapa.
+// Ela é recalculada a cada quadro a partir do tamanho da tela, então também
+// acompanha o terminal quando ele é redimensionado.
+package main
+
+// linhasStatus é quanto sobra embaixo do mapa para a barra de status (uma
+// linha em branco, o status, outra em branco e as instruções)
+const linhasStatus = 4
+
+// Camera é a parte do mapa visível na tela: a célula (X, Y) do mapa aparece
+// no canto superior esquerdo
+type Camera struct {
+	X, Y            int
+	Largura, Altura int
+}
+
+// cameraSeguir calcula a câmera que mostra o personagem numa tela de
+// largura x altura
+func cameraSeguir(jogo *Jogo, largura, altura int) Camera {
+	mapaLargura := 0
+	for _, linha := range jogo.Mapa {
+		mapaLargura = max(mapaLargura, len(linha))
+	}
+	mapaAltura := len(jogo.Mapa)
+
+	c := Camera{
+		Largura: max(min(largura, mapaLargura), 0),
+		Altura:  max(min(altura-linhasStatus, mapaAltura), 1),
+	}
+	c.X = cameraCentralizar(jogo.PosX, c.Largura, mapaLargura)
+	c.Y = cameraCentralizar(jogo.PosY, c.Altura, mapaAltura)
+	return c
+}
+
+// cameraCentralizar devolve o início da janela de tamanho janela que deixa
+// pos no meio sem passar das bordas de 0 a total
+func cameraCentralizar(pos, janela, total int) int {
+	inicio := pos - janela/2
+	return max(min(inicio, total-janela), 0)
+}
+
+// Visivel diz se a célula (x, y) do mapa está dentro da câmera
+func (c Camera) Visivel(x, y int) bool {
+	return x >= c.X && x < c.X+c.Largura && y >= c.Y && y < c.Y+c.Altura
+}
+
+// Tela converte uma posição do mapa em posição na tela
+func (c Camera) Tela(x, y int) (int, int) {
+	return x - c.X, y - c.Y
+}
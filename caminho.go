@@ -0,0 +1,273 @@
+// caminho.go - Busca de caminhos na grade do mapa e comportamentos dos monstros
+//
+// Usado pelo monstro local (modo offline) e pelos monstros do servidor. A busca
+// é uma BFS nas quatro direções, respeitando as células tangíveis (menos para
+// os tipos que atravessam paredes). Cada monstro tem um Navegador que guarda o
+// caminho calculado e o reaproveita nos ticks seguintes enquanto ele continua
+// valendo.
+package main
+
+import "math/rand"
+
+// Comportamentos de monstro (atributo comportamento=... do catálogo e da legenda)
+const (
+	ComportamentoPerseguir = "perseguir" // vai atrás do jogador mais próximo
+	ComportamentoPatrulhar = "patrulhar" // percorre uma rota em ciclo
+	ComportamentoVagar     = "vagar"     // anda até pontos sorteados por perto
+	ComportamentoEmboscar  = "emboscar"  // vai para onde o jogador está indo
+)
+
+const (
+	visaoPadrao      = 6  // distância em que patrulha/vagar passam a perseguir
+	raioPatrulha     = 12 // alcance da rota padrão de patrulha
+	raioVagar        = 8  // alcance dos destinos sorteados ao vagar
+	maxExtensoes     = 4  // passos do alvo emendados no caminho antes de recalcular
+	distEmboscada    = 4  // quantas casas à frente do jogador o emboscador mira
+	comportamentoPad = ComportamentoPerseguir
+)
+
+// Grade é o que a busca precisa saber do mapa
+type Grade interface {
+	PodeMoverPara(x, y int) bool // célula dentro do mapa e sem elemento tangível
+	Dentro(x, y int) bool        // célula dentro do mapa
+}
+
+// gradeSemParedes é a grade vista por um monstro que atravessa paredes
+type gradeSemParedes struct{ Grade }
+
+func (g gradeSemParedes) PodeMoverPara(x, y int) bool {
+	return g.Dentro(x, y)
+}
+
+// Alvo é o jogador perseguido: posição e direção do último passo dele
+type Alvo struct {
+	Pos, Dir PosicaoMapa
+}
+
+var direcoesGrade = [4]PosicaoMapa{{X: 0, Y: -1}, {X: 0, Y: 1}, {X: -1, Y: 0}, {X: 1, Y: 0}}
+
+// comportamentoValido indica se o nome é um dos comportamentos conhecidos
+func comportamentoValido(c string) bool {
+	switch c {
+	case ComportamentoPerseguir, ComportamentoPatrulhar, ComportamentoVagar, ComportamentoEmboscar:
+		return true
+	}
+	return false
+}
+
+// buscarCaminho devolve o menor caminho de origem até destino, sem a origem e
+// com o destino. Devolve nil se origem == destino ou se não há caminho.
+func buscarCaminho(g Grade, origem, destino PosicaoMapa) []PosicaoMapa {
+	if origem == destino || !g.PodeMoverPara(destino.X, destino.Y) {
+		return nil
+	}
+	anterior := map[PosicaoMapa]PosicaoMapa{origem: origem}
+	fila := []PosicaoMapa{origem}
+	for len(fila) > 0 {
+		atual := fila[0]
+		fila = fila[1:]
+		for _, d := range direcoesGrade {
+			p := PosicaoMapa{X: atual.X + d.X, Y: atual.Y + d.Y}
+			if _, visto := anterior[p]; visto || !g.PodeMoverPara(p.X, p.Y) {
+				continue
+			}
+			anterior[p] = atual
+			if p == destino {
+				return refazerCaminho(anterior, origem, destino)
+			}
+			fila = append(fila, p)
+		}
+	}
+	return nil
+}
+
+func refazerCaminho(anterior map[PosicaoMapa]PosicaoMapa, origem, destino PosicaoMapa) []PosicaoMapa {
+	var caminho []PosicaoMapa
+	for p := destino; p != origem; p = anterior[p] {
+		caminho = append(caminho, p)
+	}
+	for i, j := 0, len(caminho)-1; i < j; i, j = i+1, j-1 {
+		caminho[i], caminho[j] = caminho[j], caminho[i]
+	}
+	return caminho
+}
+
+// alcancaveis devolve as células livres a até raio passos de origem, em ordem
+// de distância (a última é a mais distante)
+func alcancaveis(g Grade, origem PosicaoMapa, raio int) []PosicaoMapa {
+	dist := map[PosicaoMapa]int{origem: 0}
+	fila := []PosicaoMapa{origem}
+	var celulas []PosicaoMapa
+	for len(fila) > 0 {
+		atual := fila[0]
+		fila = fila[1:]
+		if dist[atual] == raio {
+			continue
+		}
+		for _, d := range direcoesGrade {
+			p := PosicaoMapa{X: atual.X + d.X, Y: atual.Y + d.Y}
+			if _, visto := dist[p]; visto || !g.PodeMoverPara(p.X, p.Y) {
+				continue
+			}
+			dist[p] = dist[atual] + 1
+			celulas = append(celulas, p)
+			fila = append(fila, p)
+		}
+	}
+	return celulas
+}
+
+// Navegador decide os passos de um monstro e guarda o caminho entre ticks
+type Navegador struct {
+	Comportamento string
+	Rota          []PosicaoMapa // pontos de patrulha, percorridos em ciclo
+	Visao         int           // patrulha/vagar perseguem o alvo a até Visao passos (0 = nunca)
+	Paredes       bool          // atravessa paredes
+
+	proximoPonto int
+	destino      PosicaoMapa
+	caminho      []PosicaoMapa
+	extensoes    int
+	rng          *rand.Rand
+}
+
+// novoNavegador cria o navegador de um monstro do tipo indicado;
+// comportamentos desconhecidos viram perseguição
+func novoNavegador(tipo EspecieMonstro, rng *rand.Rand) *Navegador {
+	n := &Navegador{
+		Comportamento: tipo.Comportamento,
+		Rota:          append([]PosicaoMapa(nil), tipo.Rota...),
+		Visao:         tipo.Visao,
+		Paredes:       tipo.Paredes,
+		rng:           rng,
+	}
+	if !comportamentoValido(n.Comportamento) {
+		n.Comportamento = comportamentoPad
+	}
+	return n
+}
+
+// Passo devolve a próxima posição do monstro que está em pos. alvo é o jogador
+// a perseguir (nil se não há nenhum).
+func (n *Navegador) Passo(g Grade, pos PosicaoMapa, alvo *Alvo) PosicaoMapa {
+	if n.Paredes {
+		g = gradeSemParedes{g}
+	}
+	if alvo != nil && n.persegue(pos, alvo.Pos) {
+		// alvo sem caminho (atrás de paredes): segue o comportamento normal
+		if prox := n.seguir(g, pos, n.mira(g, pos, alvo)); prox != pos {
+			return prox
+		}
+	}
+	switch n.Comportamento {
+	case ComportamentoPatrulhar:
+		if len(n.Rota) == 0 {
+			n.Rota = rotaPadrao(g, pos)
+		}
+		if pos == n.Rota[n.proximoPonto] {
+			n.proximoPonto = (n.proximoPonto + 1) % len(n.Rota)
+		}
+		return n.seguir(g, pos, n.Rota[n.proximoPonto])
+	case ComportamentoVagar:
+		if pos == n.destino || len(n.caminho) == 0 {
+			celulas := alcancaveis(g, pos, raioVagar)
+			if len(celulas) == 0 {
+				return pos
+			}
+			n.destino = celulas[n.rng.Intn(len(celulas))]
+			n.caminho = nil
+		}
+		return n.seguir(g, pos, n.destino)
+	}
+	return pos
+}
+
+// persegue indica se o monstro deve ir atrás do alvo neste tick
+func (n *Navegador) persegue(pos, alvo PosicaoMapa) bool {
+	if n.Comportamento == ComportamentoPerseguir || n.Comportamento == ComportamentoEmboscar {
+		return true
+	}
+	return n.Visao > 0 && abs(pos.X-alvo.X)+abs(pos.Y-alvo.Y) <= n.Visao
+}
+
+// mira devolve o destino de quem persegue o alvo. O emboscador mira
+// distEmboscada casas à frente do jogador (recuando até uma célula livre) e só
+// vai direto nele quando já está perto.
+func (n *Navegador) mira(g Grade, pos PosicaoMapa, alvo *Alvo) PosicaoMapa {
+	if n.Comportamento != ComportamentoEmboscar || alvo.Dir == (PosicaoMapa{}) {
+		return alvo.Pos
+	}
+	if abs(pos.X-alvo.Pos.X)+abs(pos.Y-alvo.Pos.Y) <= distEmboscada {
+		return alvo.Pos
+	}
+	for d := distEmboscada; d > 0; d-- {
+		p := PosicaoMapa{X: alvo.Pos.X + d*alvo.Dir.X, Y: alvo.Pos.Y + d*alvo.Dir.Y}
+		if g.PodeMoverPara(p.X, p.Y) && p != pos {
+			return p
+		}
+	}
+	return alvo.Pos
+}
+
+// seguir anda um passo no caminho até destino. O caminho do tick anterior é
+// reaproveitado enquanto o próximo passo continua livre; quando o destino
+// anda uma casa (o jogador se moveu), o passo é emendado no caminho em vez de
+// recalcular tudo, até maxExtensoes vezes seguidas.
+func (n *Navegador) seguir(g Grade, pos, destino PosicaoMapa) PosicaoMapa {
+	if !n.caminhoValido(g, pos) {
+		n.caminho = nil
+	}
+	if n.caminho != nil && destino != n.destino {
+		n.emendar(destino)
+	}
+	if n.caminho == nil {
+		n.caminho = buscarCaminho(g, pos, destino)
+		n.extensoes = 0
+	}
+	n.destino = destino
+	if len(n.caminho) == 0 {
+		n.caminho = nil
+		return pos
+	}
+	prox := n.caminho[0]
+	n.caminho = n.caminho[1:]
+	return prox
+}
+
+// caminhoValido indica se o caminho guardado começa ao lado de pos e o
+// primeiro passo continua livre
+func (n *Navegador) caminhoValido(g Grade, pos PosicaoMapa) bool {
+	if len(n.caminho) == 0 {
+		return false
+	}
+	prox := n.caminho[0]
+	return abs(prox.X-pos.X)+abs(prox.Y-pos.Y) == 1 && g.PodeMoverPara(prox.X, prox.Y)
+}
+
+// emendar ajusta o caminho guardado a um destino novo; descarta o caminho se
+// não dá para emendar
+func (n *Navegador) emendar(destino PosicaoMapa) {
+	for i, p := range n.caminho {
+		if p == destino {
+			// o alvo veio na direção do monstro: o caminho só encurta
+			n.caminho = n.caminho[:i+1]
+			return
+		}
+	}
+	if n.extensoes >= maxExtensoes || abs(destino.X-n.destino.X)+abs(destino.Y-n.destino.Y) != 1 {
+		n.caminho = nil
+		return
+	}
+	n.caminho = append(n.caminho, destino)
+	n.extensoes++
+}
+
+// rotaPadrao é usada por patrulhas sem rota: vai e volta entre o ponto de
+// partida e a célula alcançável mais distante dentro de raioPatrulha
+func rotaPadrao(g Grade, origem PosicaoMapa) []PosicaoMapa {
+	celulas := alcancaveis(g, origem, raioPatrulha)
+	if len(celulas) == 0 {
+		return []PosicaoMapa{origem}
+	}
+	return []PosicaoMapa{origem, celulas[len(celulas)-1]}
+}
@@ -0,0 +1,193 @@
+// catalogo_monstros.go - Catálogo de tipos de monstro
+//
+// Cada tipo define símbolo, cor, velocidade e estratégia (ver caminho.go). O
+// catálogo começa com os tipos embutidos abaixo e pode ser ampliado por um
+// arquivo (--monster-catalog no servidor, MONSTER_CATALOG no cliente) com uma
+// linha por tipo:
+//
+//	# nome      atributos
+//	lento       simbolo=ѫ cor=verde passo=2s comportamento=perseguir
+//	sentinela   simbolo=Ξ cor=azul comportamento=patrulhar rota=3,1;15,1
+//
+// Os mesmos atributos valem na legenda do mapa, numa entrada de monstro:
+// "@M monstro tipo=fantasma passo=800ms". O símbolo de cada tipo do catálogo
+// já é um marcador de monstro na legenda padrão.
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EspecieMonstro descreve um tipo de monstro do catálogo
+type EspecieMonstro struct {
+	Nome          string
+	Simbolo       rune
+	Cor           string        // nome de cor, como na legenda do mapa
+	Passo         time.Duration // intervalo entre dois passos
+	Comportamento string        // perseguir, patrulhar, vagar ou emboscar
+	Paredes       bool          // atravessa paredes
+	Visao         int           // patrulha/vagar perseguem um jogador a até Visao casas
+	Rota          []PosicaoMapa // pontos de patrulha (vazio = rota padrão)
+}
+
+// EspeciePadrao é o monstro dos marcadores sem tipo e dos mapas sem marcador
+const EspeciePadrao = "perseguidor"
+
+// catalogoMonstros é o catálogo em uso, por nome
+var catalogoMonstros = catalogoPadrao()
+
+func catalogoPadrao() map[string]EspecieMonstro {
+	tipos := []EspecieMonstro{
+		{Nome: EspeciePadrao, Simbolo: '☠', Cor: "magenta", Passo: time.Second, Comportamento: ComportamentoPerseguir},
+		{Nome: "corredor", Simbolo: 'Ж', Cor: "vermelho", Passo: 500 * time.Millisecond, Comportamento: ComportamentoPerseguir},
+		{Nome: "patrulheiro", Simbolo: 'Θ', Cor: "azul", Passo: time.Second, Comportamento: ComportamentoPatrulhar},
+		{Nome: "fantasma", Simbolo: 'Ω', Cor: "branco", Passo: 1500 * time.Millisecond, Comportamento: ComportamentoPerseguir, Paredes: true},
+		{Nome: "emboscador", Simbolo: 'Ψ', Cor: "ciano", Passo: time.Second, Comportamento: ComportamentoEmboscar},
+	}
+	catalogo := make(map[string]EspecieMonstro, len(tipos))
+	for _, t := range tipos {
+		t.Visao = visaoPadrao
+		catalogo[t.Nome] = t
+	}
+	return catalogo
+}
+
+// especieMonstro devolve o tipo do catálogo com esse nome
+func especieMonstro(nome string) (EspecieMonstro, bool) {
+	t, ok := catalogoMonstros[nome]
+	return t, ok
+}
+
+// especiePadrao devolve o tipo usado quando nenhum é indicado
+func especiePadrao() EspecieMonstro {
+	return catalogoMonstros[EspeciePadrao]
+}
+
+// especiesOrdenadas lista o catálogo em ordem de nome, para montar a legenda
+// padrão sempre da mesma forma
+func especiesOrdenadas() []EspecieMonstro {
+	tipos := make([]EspecieMonstro, 0, len(catalogoMonstros))
+	for _, t := range catalogoMonstros {
+		tipos = append(tipos, t)
+	}
+	sort.Slice(tipos, func(i, j int) bool { return tipos[i].Nome < tipos[j].Nome })
+	return tipos
+}
+
+// carregarCatalogoMonstros lê um arquivo de catálogo e acrescenta (ou
+// substitui) os tipos dele. Tipos novos partem do tipo padrão.
+func carregarCatalogoMonstros(nome string) error {
+	arq, err := os.Open(nome)
+	if err != nil {
+		return err
+	}
+	defer arq.Close()
+
+	novos := make(map[string]EspecieMonstro)
+	scanner := bufio.NewScanner(arq)
+	numLinha := 0
+	for scanner.Scan() {
+		numLinha++
+		campos := strings.Fields(scanner.Text())
+		if len(campos) == 0 || strings.HasPrefix(campos[0], "#") {
+			continue
+		}
+		t, ok := catalogoMonstros[campos[0]]
+		if !ok {
+			t = especiePadrao()
+		}
+		t.Nome = campos[0]
+		for _, kv := range campos[1:] {
+			chave, valor, ok := strings.Cut(kv, "=")
+			if !ok {
+				return fmt.Errorf("%s:%d: bad attribute %q", nome, numLinha, kv)
+			}
+			tratado, err := t.aplicarAtributo(chave, valor)
+			if err == nil && !tratado {
+				err = fmt.Errorf("unknown monster attribute %q", chave)
+			}
+			if err != nil {
+				return fmt.Errorf("%s:%d: %v", nome, numLinha, err)
+			}
+		}
+		novos[t.Nome] = t
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	for n, t := range novos {
+		catalogoMonstros[n] = t
+	}
+	return nil
+}
+
+// aplicarAtributo interpreta um atributo de monstro do catálogo ou da legenda.
+// Devolve false se a chave não é um atributo de monstro.
+func (t *EspecieMonstro) aplicarAtributo(chave, valor string) (bool, error) {
+	switch chave {
+	case "simbolo":
+		r := []rune(valor)
+		if len(r) != 1 {
+			return true, fmt.Errorf("monster symbol must be a single character: %q", valor)
+		}
+		t.Simbolo = r[0]
+	case "cor":
+		t.Cor = valor
+	case "passo":
+		d, err := time.ParseDuration(valor)
+		if err != nil || d <= 0 {
+			return true, fmt.Errorf("bad passo %q", valor)
+		}
+		t.Passo = d
+	case "comportamento":
+		if !comportamentoValido(valor) {
+			return true, fmt.Errorf("unknown comportamento %q", valor)
+		}
+		t.Comportamento = valor
+	case "paredes":
+		switch valor {
+		case "sim", "true":
+			t.Paredes = true
+		case "nao", "não", "false":
+			t.Paredes = false
+		default:
+			return true, fmt.Errorf("bad paredes value %q", valor)
+		}
+	case "visao":
+		v, err := strconv.Atoi(valor)
+		if err != nil || v < 0 {
+			return true, fmt.Errorf("bad visao %q", valor)
+		}
+		t.Visao = v
+	case "rota":
+		rota, err := lerRota(valor)
+		if err != nil {
+			return true, err
+		}
+		t.Rota = rota
+	default:
+		return false, nil
+	}
+	return true, nil
+}
+
+// lerRota interpreta "x,y;x,y;..."
+func lerRota(texto string) ([]PosicaoMapa, error) {
+	var rota []PosicaoMapa
+	for _, ponto := range strings.Split(texto, ";") {
+		xs, ys, ok := strings.Cut(ponto, ",")
+		x, errX := strconv.Atoi(xs)
+		y, errY := strconv.Atoi(ys)
+		if !ok || errX != nil || errY != nil {
+			return nil, fmt.Errorf("bad rota point %q", ponto)
+		}
+		rota = append(rota, PosicaoMapa{X: x, Y: y})
+	}
+	return rota, nil
+}
@@ -6,10 +6,14 @@ package main
 import (
 	"crypto/rand"
 	"encoding/hex"
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"net/rpc"
 	"os"
+	"sort"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
@@ -45,7 +49,7 @@ import (
 //
 // 4) Envio de comandos ao mover o personagem
 //    - Em `personagemMover` (ou logo após mover localmente), enviar atualização de posição:
-//      payload := map[string]interface{}{"x": nx, "y": ny, "lives": jogo.Pontos}
+//      payload := map[string]interface{}{"x": nx, "y": ny, "lives": jogo.Vidas}
 //      rpcClient.SendCommand("UPDATE_POS", payload)
 //    - Use sempre o mesmo ClientID e não reinicie Seq ao reiniciar o cliente (se possível persistir lastSeq).
 //
@@ -70,15 +74,46 @@ import (
 type RPCClient struct {
 	addr     string
 	mu       sync.Mutex
-	client   *rpc.Client
+	client   conexaoRPC
 	ClientID string
 	Seq      int64
+
+	// fim do bloco de seqs já gravado no arquivo (ver reservarSeq)
+	seqLimite int64
+
+	// sessão: token emitido pelo REGISTER e dados para registrar de novo
+	token          string
+	ultimoRegistro RegisterPayload
+
+	// réplica local dos jogadores, mantida aplicando os deltas do servidor
+	replicaMu     sync.Mutex
+	replica       map[string]PlayerInfo
+	versaoReplica int64
+	salaReplica   string // sala a que a réplica pertence
+
+	// resposta do Hello (nil enquanto não houve Hello), protegida por mu
+	servidor *HelloReply
+}
+
+// ErrProtocoloIncompativel é devolvido por Hello quando cliente e servidor não
+// falam versões compatíveis do protocolo
+var ErrProtocoloIncompativel = errors.New("incompatible protocol version")
+
+// intervaloPolling é a espera entre GetState quando o servidor não tem WatchState
+const intervaloPolling = 300 * time.Millisecond
+
+// conexaoRPC é o que o RPCClient usa da conexão: *rpc.Client (net/rpc com
+// gob) ou, com addr ws://..., transporteWS (ver client_ws.go)
+type conexaoRPC interface {
+	Call(serviceMethod string, args interface{}, reply interface{}) error
+	Close() error
 }
 
 func NewRPCClient(addr, clientID string) *RPCClient {
 	r := &RPCClient{addr: addr, ClientID: clientID}
-	// tentar carregar seq previamente persistido
+	// tentar carregar seq e token previamente persistidos
 	r.loadSeq()
+	r.loadToken()
 	return r
 }
 
@@ -122,7 +157,17 @@ func (r *RPCClient) connect() error {
 	// tentativas simples com backoff
 	backoff := 100 * time.Millisecond
 	for i := 0; i < 5; i++ {
-		r.client, err = rpc.Dial("tcp", r.addr)
+		if strings.HasPrefix(r.addr, "ws://") {
+			var t *transporteWS
+			if t, err = conectarTransporteWS(r.addr); err == nil {
+				r.client = t
+			}
+		} else {
+			var c *rpc.Client
+			if c, err = rpc.Dial("tcp", r.addr); err == nil {
+				r.client = c
+			}
+		}
 		if err == nil {
 			return nil
 		}
@@ -132,103 +177,369 @@ func (r *RPCClient) connect() error {
 	return err
 }
 
-// SendCommand envia um comando para o servidor com retries; garante que o mesmo seq seja transmitido nas retransmissões
+// SendCommand envia um comando para o servidor com retries. Se o servidor
+// rejeitar o token da sessão (inválido ou expirado), registra de novo e
+// reenvia o comando uma vez, com um novo seq.
 func (r *RPCClient) SendCommand(cmd string, payload interface{}) (CommandReply, error) {
-	// prepara args
+	return r.SendCommandSeq(cmd, payload, 0)
+}
+
+// SendCommandSeq é SendCommand com um seq já reservado por ReservarSeq (0
+// reserva um novo). O reenvio depois de um token rejeitado usa um seq novo.
+func (r *RPCClient) SendCommandSeq(cmd string, payload interface{}, seq int64) (CommandReply, error) {
+	reply, err := r.enviarComando(cmd, payload, seq)
+	if err == nil && cmd != "REGISTER" && tokenRejeitado(reply.Message) {
+		dbg.Printf("[CLIENT] token rejeitado (%s) - registrando novamente\n", reply.Message)
+		if rerr := r.reRegistrar(); rerr != nil {
+			dbg.Printf("[CLIENT] re-registro falhou: %v\n", rerr)
+			return reply, nil
+		}
+		return r.enviarComando(cmd, payload, 0)
+	}
+	return reply, err
+}
+
+// ReservarSeq reserva o próximo seq para um comando que será enviado depois,
+// permitindo ao chamador identificar a resposta (ver ComandoFila)
+func (r *RPCClient) ReservarSeq() int64 {
 	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.reservarSeq()
+}
+
+// blocoSeq é quantos seqs o cliente reserva no arquivo de uma vez
+const blocoSeq = 256
+
+// reservarSeq incrementa o seq. O arquivo guarda o fim do bloco reservado, e
+// não cada seq: ele só é gravado quando o bloco acaba, para não parar o tick a
+// cada tecla. Depois de um crash o cliente recomeça do fim do bloco, então um
+// seq nunca é reusado (só pula os que sobraram). Deve ser chamada com r.mu bloqueado.
+func (r *RPCClient) reservarSeq() int64 {
 	r.Seq++
-	seq := r.Seq
-	// persistir seq imediatamente para sobreviver a crashes
-	if err := r.saveSeq(seq); err != nil {
-		dbg.Printf("[CLIENT] aviso: não foi possível salvar seq %d: %v\n", seq, err)
+	if r.Seq > r.seqLimite {
+		limite := r.Seq + blocoSeq - 1
+		if err := r.saveSeq(limite); err != nil {
+			dbg.Printf("[CLIENT] aviso: não foi possível salvar seq %d: %v\n", limite, err)
+		} else {
+			r.seqLimite = limite
+		}
+	}
+	return r.Seq
+}
+
+// enviarComando faz o envio propriamente dito; garante que o mesmo seq seja transmitido nas retransmissões
+func (r *RPCClient) enviarComando(cmd string, payload interface{}, seq int64) (CommandReply, error) {
+	// prepara args
+	r.mu.Lock()
+	if seq == 0 {
+		seq = r.reservarSeq()
+	}
+	if reg, ok := payload.(RegisterPayload); ok {
+		r.ultimoRegistro = reg
 	}
+	token := r.token
 	r.mu.Unlock()
 
-	args := CommandArgs{ClientID: r.ClientID, Seq: seq, Cmd: cmd, Payload: payload}
+	args := CommandArgs{ClientID: r.ClientID, Seq: seq, Cmd: cmd, Payload: payload, Token: token}
 	var reply CommandReply
-	// conectar se necessário
-	if err := r.connect(); err != nil {
+	dbg.Printf("[CLIENT] Sending SendCommand to %s seq=%d cmd=%s\n", r.addr, seq, cmd)
+	// as retentativas de chamar repetem o mesmo seq; o servidor detecta duplicados
+	if err := r.chamar("GameServer.SendCommand", &args, &reply); err != nil {
 		return reply, err
 	}
+	dbg.Printf("[CLIENT] Got reply for seq=%d: %+v\n", seq, reply)
+	r.lembrarSessao(reply)
+	if reply.Message == MsgSeqTooOld {
+		dbg.Printf("[CLIENT] seq=%d abaixo da janela do servidor (arquivo %s desatualizado?)\n", seq, r.seqFilePath())
+	}
+	return reply, nil
+}
 
-	// retries com backoff; como usamos seq, reexecução é tolerante (server detecta duplicados)
-	backoff := 100 * time.Millisecond
-	for i := 0; i < 5; i++ {
-		dbg.Printf("[CLIENT] Sending SendCommand to %s seq=%d cmd=%s\n", r.addr, seq, cmd)
-		
-		r.mu.Lock()
-		client := r.client
-		r.mu.Unlock()
-		
-		if client == nil {
-			if err := r.connect(); err != nil {
-				return reply, err
-			}
-			r.mu.Lock()
-			client = r.client
-			r.mu.Unlock()
+// ComandoFila é um comando aguardando envio ordenado ao servidor
+type ComandoFila struct {
+	Cmd     string
+	Payload interface{}
+	Seq     int64 // reservado com ReservarSeq ao enfileirar (0 = reservar no envio)
+}
+
+// ProcessarFila envia os comandos de `fila` um por vez, na ordem em que foram
+// enfileirados, e publica cada resposta em `respostas`. Em caso de erro de rede
+// a resposta publicada tem Message "error". A resposta publicada sempre leva o
+// Seq com que o comando foi enfileirado, mesmo se ele foi reenviado com outro.
+func (r *RPCClient) ProcessarFila(fila <-chan ComandoFila, respostas chan<- CommandReply) {
+	for c := range fila {
+		reply, err := r.SendCommandSeq(c.Cmd, c.Payload, c.Seq)
+		if err != nil {
+			dbg.Printf("[CLIENT] comando %s falhou: %v\n", c.Cmd, err)
+			reply = CommandReply{Message: "error"}
 		}
-		
-		callErr := client.Call("GameServer.SendCommand", &args, &reply)
-		if callErr == nil {
-			dbg.Printf("[CLIENT] Got reply for seq=%d: %+v\n", seq, reply)
-			return reply, nil
-		}
-		dbg.Printf("[CLIENT] SendCommand error: %v - retrying...\n", callErr)
-		time.Sleep(backoff)
-		backoff *= 2
-		// reconectar antes da próxima tentativa
-		r.mu.Lock()
-		r.client = nil
-		r.mu.Unlock()
-		if err := r.connect(); err != nil {
-			return reply, err
+		if c.Seq != 0 {
+			reply.Seq = c.Seq
 		}
+		respostas <- reply
 	}
-	return reply, dbg.Output(1, "SendCommand failed after retries")
 }
 
 // GetState solicita o estado atual do servidor (polling)
 func (r *RPCClient) GetState() (StateReply, error) {
+	reply, err := r.getState()
+	if tokenRejeitado(mensagemErro(err)) && r.reRegistrar() == nil {
+		return r.getState()
+	}
+	return reply, err
+}
+
+func (r *RPCClient) getState() (StateReply, error) {
 	var reply StateReply
-	if err := r.connect(); err != nil {
+	args := ClientIDArgs{ClientID: r.ClientID, Now: time.Now(), BaseVersion: r.versaoBase(), Token: r.tokenAtual(), Room: r.Sala()}
+	dbg.Printf("[CLIENT] Requesting GetState from %s\n", r.addr)
+	if err := r.chamar("GameServer.GetState", &args, &reply); err != nil {
 		return reply, err
 	}
+	reply = r.aplicarEstado(reply)
+	dbg.Printf("[CLIENT] Received state with %d players\n", len(reply.Players))
+	return reply, nil
+}
+
+// WatchState faz long-poll no servidor: bloqueia até o estado ter versão maior que
+// `since` ou o timeout expirar. Substitui o polling periódico de GetState.
+func (r *RPCClient) WatchState(since int64, timeout time.Duration) (StateReply, error) {
+	if !r.Suporta(CapacidadeWatch) {
+		// servidor sem long-poll: volta ao polling de GetState
+		time.Sleep(min(timeout, intervaloPolling))
+		return r.GetState()
+	}
+	reply, err := r.watchState(since, timeout)
+	if tokenRejeitado(mensagemErro(err)) && r.reRegistrar() == nil {
+		return r.watchState(since, timeout)
+	}
+	return reply, err
+}
 
+func (r *RPCClient) watchState(since int64, timeout time.Duration) (StateReply, error) {
+	var reply StateReply
+	args := WatchArgs{ClientID: r.ClientID, SinceVersion: since, TimeoutMS: int(timeout / time.Millisecond), Token: r.tokenAtual(), Room: r.Sala()}
+	if base := r.versaoBase(); base == since {
+		args.BaseVersion = base
+	}
+	if err := r.chamar("GameServer.WatchState", &args, &reply); err != nil {
+		return reply, err
+	}
+	reply = r.aplicarEstado(reply)
+	if reply.Version > since {
+		dbg.Printf("[CLIENT] WatchState version=%d with %d players\n", reply.Version, len(reply.Players))
+	}
+	return reply, nil
+}
+
+// ListRooms pede ao servidor a lista de salas abertas (não exige registro)
+func (r *RPCClient) ListRooms() ([]RoomInfo, error) {
+	var reply RoomListReply
 	args := ClientIDArgs{ClientID: r.ClientID, Now: time.Now()}
+	if err := r.chamar("GameServer.ListRooms", &args, &reply); err != nil {
+		return nil, err
+	}
+	dbg.Printf("[CLIENT] ListRooms: %d salas\n", len(reply.Rooms))
+	return reply.Rooms, nil
+}
+
+// Hello faz o handshake de versão com o servidor e guarda a resposta para
+// Suporta. Servidores sem Hello são tratados como protocolo 1. Devolve um erro
+// com ErrProtocoloIncompativel se não dá para jogar com este servidor.
+func (r *RPCClient) Hello() (HelloReply, error) {
+	var reply HelloReply
+	args := HelloArgs{ClientID: r.ClientID, Protocol: VersaoProtocolo, MinProtocol: VersaoProtocoloMinima, Build: versaoBuild}
+	if err := r.chamar("GameServer.Hello", &args, &reply); err != nil {
+		if _, ok := err.(rpc.ServerError); !ok || !strings.Contains(err.Error(), "can't find method") {
+			return reply, err
+		}
+		reply = HelloReply{Protocol: 1, MinProtocol: 1}
+	}
+	dbg.Printf("[CLIENT] Hello: protocolo %d (mínimo %d), build %s, capacidades %v\n", reply.Protocol, reply.MinProtocol, reply.Build, reply.Capabilities)
+	if err := protocoloCompativel(reply.Protocol, reply.MinProtocol); err != nil {
+		return reply, fmt.Errorf("%w: server build %s: %v", ErrProtocoloIncompativel, reply.Build, err)
+	}
+	r.mu.Lock()
+	r.servidor = &reply
+	r.mu.Unlock()
+	return reply, nil
+}
+
+// Servidor devolve a resposta do Hello; false se ainda não houve Hello
+func (r *RPCClient) Servidor() (HelloReply, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.servidor == nil {
+		return HelloReply{}, false
+	}
+	return *r.servidor, true
+}
+
+// Suporta indica se o servidor anunciou a capacidade ou o comando nome. Sem
+// Hello (servidor fora do ar na hora) assume que sim, como antes do Hello.
+func (r *RPCClient) Suporta(nome string) bool {
+	h, ok := r.Servidor()
+	return !ok || h.Suporta(nome)
+}
+
+// versaoBase devolve a versão da réplica local, usada como base dos deltas.
+// Sem a capacidade delta é sempre 0 e o servidor manda o estado completo.
+func (r *RPCClient) versaoBase() int64 {
+	if !r.Suporta(CapacidadeDelta) {
+		return 0
+	}
+	r.replicaMu.Lock()
+	defer r.replicaMu.Unlock()
+	return r.versaoReplica
+}
+
+// Sala devolve a sala da réplica local (a última informada pelo servidor)
+func (r *RPCClient) Sala() string {
+	r.replicaMu.Lock()
+	defer r.replicaMu.Unlock()
+	return r.salaReplica
+}
+
+// aplicarEstado atualiza a réplica local com a resposta do servidor (snapshot
+// ou delta) e devolve a resposta com Players preenchido a partir da réplica
+func (r *RPCClient) aplicarEstado(st StateReply) StateReply {
+	r.replicaMu.Lock()
+	defer r.replicaMu.Unlock()
+
+	switch {
+	case st.Full:
+		r.replica = make(map[string]PlayerInfo, len(st.Players))
+		for _, p := range st.Players {
+			r.replica[p.ID] = p
+		}
+	case st.BaseVersion != r.versaoReplica || st.Room != r.salaReplica:
+		// delta sobre uma base que não temos: descarta e, com versão 0,
+		// a próxima chamada recebe snapshot completo
+		dbg.Printf("[CLIENT] delta com base %d/%s inesperada (réplica em %d/%s)\n", st.BaseVersion, st.Room, r.versaoReplica, r.salaReplica)
+		st.Version = 0
+	default:
+		if r.replica == nil {
+			r.replica = make(map[string]PlayerInfo)
+		}
+		for _, p := range st.Added {
+			r.replica[p.ID] = p
+		}
+		for _, p := range st.Updated {
+			r.replica[p.ID] = p
+		}
+		for _, id := range st.Removed {
+			delete(r.replica, id)
+		}
+	}
+	r.versaoReplica = st.Version
+	if st.Full {
+		r.salaReplica = st.Room
+	}
+
+	players := make([]PlayerInfo, 0, len(r.replica))
+	for _, p := range r.replica {
+		players = append(players, p)
+	}
+	sort.Slice(players, func(i, j int) bool { return players[i].ID < players[j].ID })
+	st.Players = players
+	return st
+}
+
+// chamar executa uma chamada RPC com retentativas (backoff exponencial) e
+// reconexão; é o caminho de todas as chamadas do RPCClient. Erros devolvidos
+// pelo servidor (rpc.ServerError, ex.: token inválido) não são repetidos.
+func (r *RPCClient) chamar(metodo string, args, reply interface{}) error {
+	if err := r.connect(); err != nil {
+		return err
+	}
 	backoff := 100 * time.Millisecond
+	var callErr error
 	for i := 0; i < 5; i++ {
-		dbg.Printf("[CLIENT] Requesting GetState from %s\n", r.addr)
-		
 		r.mu.Lock()
 		client := r.client
 		r.mu.Unlock()
-		
+
 		if client == nil {
 			if err := r.connect(); err != nil {
-				return reply, err
+				return err
 			}
 			r.mu.Lock()
 			client = r.client
 			r.mu.Unlock()
 		}
-		
-		callErr := client.Call("GameServer.GetState", &args, &reply)
+
+		callErr = client.Call(metodo, args, reply)
 		if callErr == nil {
-			dbg.Printf("[CLIENT] Received state with %d players\n", len(reply.Players))
-			return reply, nil
+			return nil
+		}
+		if _, ok := callErr.(rpc.ServerError); ok {
+			return callErr
 		}
-		dbg.Printf("[CLIENT] GetState error: %v - retrying...\n", callErr)
+		dbg.Printf("[CLIENT] %s error: %v - retrying...\n", metodo, callErr)
 		time.Sleep(backoff)
 		backoff *= 2
 		r.mu.Lock()
 		r.client = nil
 		r.mu.Unlock()
 		if err := r.connect(); err != nil {
-			return reply, err
+			return err
 		}
 	}
-	return reply, dbg.Output(2, "GetState failed after retries")
+	return callErr
+}
+
+// tokenRejeitado indica se a mensagem é uma rejeição de token da sessão
+func tokenRejeitado(msg string) bool {
+	return msg == MsgInvalidToken || msg == MsgTokenExpired
+}
+
+func mensagemErro(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+func (r *RPCClient) tokenAtual() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.token
+}
+
+// lembrarSessao guarda o token emitido pelo REGISTER
+func (r *RPCClient) lembrarSessao(reply CommandReply) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if reply.Token != "" && reply.Token != r.token {
+		r.token = reply.Token
+		if err := r.saveToken(reply.Token); err != nil {
+			dbg.Printf("[CLIENT] aviso: não foi possível salvar token: %v\n", err)
+		}
+	}
+}
+
+// reRegistrar repete o REGISTER (na sala atual) para obter um token novo; o
+// servidor mantém a posição do jogador
+func (r *RPCClient) reRegistrar() error {
+	sala := r.Sala()
+	r.mu.Lock()
+	reg := r.ultimoRegistro
+	if reg.Name == "" {
+		reg.Name = r.ClientID
+	}
+	if sala != "" {
+		reg.Room = sala
+	}
+	r.mu.Unlock()
+
+	reply, err := r.enviarComando("REGISTER", reg, 0)
+	if err != nil {
+		return err
+	}
+	if !reply.Applied {
+		return errors.New(reply.Message)
+	}
+	return nil
 }
 
 // helpers para persistir seq
@@ -241,7 +552,8 @@ func (r *RPCClient) loadSeq() {
 	path := r.seqFilePath()
 	if data, err := os.ReadFile(path); err == nil {
 		if s, err2 := strconv.ParseInt(string(data), 10, 64); err2 == nil {
-			r.Seq = s
+			// o arquivo tem o fim do último bloco reservado
+			r.Seq, r.seqLimite = s, s
 		}
 	}
 }
@@ -257,3 +569,23 @@ func (r *RPCClient) saveSeq(s int64) error {
 	// On Windows, os.Rename will replace existing file if target exists
 	return os.Rename(tmp, path)
 }
+
+// helpers para persistir o token da sessão (mesmo esquema do seq)
+func (r *RPCClient) tokenFilePath() string {
+	return "." + r.ClientID + ".token"
+}
+
+func (r *RPCClient) loadToken() {
+	if data, err := os.ReadFile(r.tokenFilePath()); err == nil {
+		r.token = strings.TrimSpace(string(data))
+	}
+}
+
+func (r *RPCClient) saveToken(token string) error {
+	path := r.tokenFilePath()
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(token), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,250 @@
+//go:build !server
+// +build !server
+
+package main
+
+import (
+    "bytes"
+    "errors"
+    "net"
+    "net/http"
+    "net/http/httptest"
+    "net/rpc"
+    "os"
+    "strings"
+    "testing"
+    "time"
+)
+
+// servidorSemHello é um servidor de antes do Hello (protocolo 1)
+type servidorSemHello struct{}
+
+func (servidorSemHello) GetState(args *ClientIDArgs, reply *StateReply) error {
+    return nil
+}
+
+// servidorHelloFixo responde o Hello sempre com a mesma resposta
+type servidorHelloFixo struct {
+    reply HelloReply
+}
+
+func (s *servidorHelloFixo) Hello(args *HelloArgs, reply *HelloReply) error {
+    *reply = s.reply
+    return nil
+}
+
+// servirGameServer registra rcvr como "GameServer" num servidor RPC próprio e
+// devolve o endereço dele
+func servirGameServer(t *testing.T, rcvr interface{}) string {
+    srv := rpc.NewServer()
+    if err := srv.RegisterName("GameServer", rcvr); err != nil {
+        t.Fatalf("RegisterName error: %v", err)
+    }
+    l, err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil {
+        t.Fatalf("listen error: %v", err)
+    }
+    t.Cleanup(func() { l.Close() })
+    go srv.Accept(l)
+    return l.Addr().String()
+}
+
+// TestHelloCliente verifica que o RPCClient recusa servidores de protocolo
+// incompatível (inclusive os sem Hello) e se adapta às capacidades anunciadas
+func TestHelloCliente(t *testing.T) {
+    // servidor sem Hello: protocolo 1, abaixo do mínimo
+    r := NewRPCClient(servirGameServer(t, servidorSemHello{}), "hello-a")
+    h, err := r.Hello()
+    if !errors.Is(err, ErrProtocoloIncompativel) || h.Protocol != 1 {
+        t.Fatalf("expected old server refused as protocol 1, got %+v, %v", h, err)
+    }
+
+    // servidor que exige um protocolo mais novo
+    futuro := &servidorHelloFixo{reply: HelloReply{Protocol: VersaoProtocolo + 1, MinProtocol: VersaoProtocolo + 1, Build: "v9"}}
+    r = NewRPCClient(servirGameServer(t, futuro), "hello-b")
+    if _, err := r.Hello(); !errors.Is(err, ErrProtocoloIncompativel) {
+        t.Fatalf("expected newer server refused, got %v", err)
+    }
+    if _, ok := r.Servidor(); ok {
+        t.Fatalf("expected no Hello reply kept for an incompatible server")
+    }
+
+    // servidor compatível sem deltas e sem MOVE
+    simples := &servidorHelloFixo{reply: HelloReply{
+        Protocol: VersaoProtocolo, MinProtocol: VersaoProtocoloMinima,
+        Commands: []string{"REGISTER", "UPDATE_POS"}, Capabilities: []string{CapacidadeWatch},
+    }}
+    r = NewRPCClient(servirGameServer(t, simples), "hello-c")
+    if _, err := r.Hello(); err != nil {
+        t.Fatalf("Hello error: %v", err)
+    }
+    if !r.Suporta(CapacidadeWatch) || r.Suporta(CapacidadeDelta) || r.Suporta("MOVE") {
+        t.Fatalf("expected only watch-state and UPDATE_POS supported")
+    }
+    r.aplicarEstado(StateReply{Full: true, Version: 5})
+    if v := r.versaoBase(); v != 0 {
+        t.Fatalf("expected base version 0 without deltas, got %d", v)
+    }
+
+    // o GameServer de verdade anuncia tudo
+    r = NewRPCClient(servirGameServer(t, NewGameServer()), "hello-d")
+    if _, err := r.Hello(); err != nil {
+        t.Fatalf("Hello error: %v", err)
+    }
+    for _, c := range []string{CapacidadeWatch, CapacidadeDelta, CapacidadeSalas, "MOVE", "RESPAWN"} {
+        if !r.Suporta(c) {
+            t.Fatalf("expected GameServer to support %s", c)
+        }
+    }
+}
+
+// TestTransporteWS verifica o RPCClient com RPC_ADDR=ws://...: comandos com
+// deduplicação, estados empurrados pela assinatura aplicados como deltas e o
+// timeout sem mudanças. Também confere os frames grandes do websocket.go.
+func TestTransporteWS(t *testing.T) {
+    t.Chdir(t.TempDir()) // o RPCClient grava Seq e token no diretório atual
+    if err := os.WriteFile("mapa.txt", []byte("▤▤▤▤▤\n▤☺  ▤\n▤▤▤▤▤\n"), 0600); err != nil {
+        t.Fatalf("write map: %v", err)
+    }
+    gs := NewGameServer()
+    if err := gs.carregarMapa("mapa.txt"); err != nil {
+        t.Fatalf("carregarMapa error: %v", err)
+    }
+    ts := httptest.NewServer(gs.handlerWS())
+    defer ts.Close()
+    addr := "ws" + strings.TrimPrefix(ts.URL, "http") + "/ws"
+
+    r := NewRPCClient(addr, "ws-a")
+    if _, err := r.Hello(); err != nil {
+        t.Fatalf("Hello error: %v", err)
+    }
+    reg, err := r.SendCommand("REGISTER", RegisterPayload{Name: "ws-a"})
+    if err != nil || !reg.Applied || reg.Token == "" {
+        t.Fatalf("expected REGISTER applied over websocket, got %+v, %v", reg, err)
+    }
+    seq := r.ReservarSeq()
+    mv, err := r.SendCommandSeq("MOVE", MovePayload{Dir: DirDireita}, seq)
+    if err != nil || !mv.Applied || mv.X != 2 {
+        t.Fatalf("expected move to (2,1), got %+v, %v", mv, err)
+    }
+    dup, _ := r.SendCommandSeq("MOVE", MovePayload{Dir: DirDireita}, seq)
+    if dup != mv {
+        t.Fatalf("expected cached reply for duplicate seq, got %+v and %+v", mv, dup)
+    }
+
+    st, err := r.WatchState(0, time.Second)
+    if err != nil || !st.Full || len(st.Players) != 1 || st.Players[0].X != 2 {
+        t.Fatalf("expected full state with ws-a at (2,1), got %+v, %v", st, err)
+    }
+
+    // outro jogador entra: chega como delta empurrado pela assinatura
+    go func() {
+        time.Sleep(50 * time.Millisecond)
+        var cr CommandReply
+        gs.SendCommand(&CommandArgs{ClientID: "ws-b", Seq: 1, Cmd: "REGISTER", Payload: RegisterPayload{Name: "ws-b"}}, &cr)
+    }()
+    st2, err := r.WatchState(st.Version, 2*time.Second)
+    if err != nil || st2.Full || st2.Version <= st.Version || len(st2.Players) != 2 {
+        t.Fatalf("expected pushed delta with 2 players, got %+v, %v", st2, err)
+    }
+
+    // sem mudanças a chamada volta no timeout com a mesma versão
+    st3, err := r.WatchState(st2.Version, 50*time.Millisecond)
+    if err != nil || st3.Version != st2.Version || len(st3.Players) != 2 {
+        t.Fatalf("expected unchanged state on timeout, got %+v, %v", st3, err)
+    }
+
+    // mensagens grandes (tamanho em 16 e 64 bits), mascaradas pelo cliente
+    eco := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+        c, err := aceitarWS(w, req)
+        if err != nil {
+            return
+        }
+        defer c.Fechar()
+        for {
+            m, err := c.LerMensagem()
+            if err != nil {
+                return
+            }
+            c.EscreverMensagem(m)
+        }
+    }))
+    defer eco.Close()
+    c, err := conectarWS("ws" + strings.TrimPrefix(eco.URL, "http") + "/")
+    if err != nil {
+        t.Fatalf("conectarWS error: %v", err)
+    }
+    defer c.Fechar()
+    for _, n := range []int{0, 125, 300, 70000} {
+        m := bytes.Repeat([]byte("x"), n)
+        if err := c.EscreverMensagem(m); err != nil {
+            t.Fatalf("write %d bytes: %v", n, err)
+        }
+        if got, err := c.LerMensagem(); err != nil || !bytes.Equal(got, m) {
+            t.Fatalf("expected echo of %d bytes, got %d, %v", n, len(got), err)
+        }
+    }
+
+    // o servidor fecha a conexão em frames sem máscara e em frames de controle
+    // grandes ou fragmentados
+    violacoes := map[string]func(c *ConexaoWS) error{
+        "unmasked": func(c *ConexaoWS) error {
+            c.cliente = false
+            defer func() { c.cliente = true }()
+            return c.EscreverMensagem([]byte("x"))
+        },
+        "large ping": func(c *ConexaoWS) error {
+            return c.escreverFrame(opPing, bytes.Repeat([]byte("x"), 126))
+        },
+        "fragmented ping": func(c *ConexaoWS) error {
+            _, err := c.conn.Write([]byte{opPing, 0x80, 0, 0, 0, 0})
+            return err
+        },
+    }
+    for nome, violar := range violacoes {
+        c, err := conectarWS("ws" + strings.TrimPrefix(eco.URL, "http") + "/")
+        if err != nil {
+            t.Fatalf("conectarWS error: %v", err)
+        }
+        if err := violar(c); err != nil {
+            t.Fatalf("%s: write error: %v", nome, err)
+        }
+        c.EscreverMensagem([]byte("eco")) // ecoado se a conexão continuasse aberta
+        c.conn.SetReadDeadline(time.Now().Add(time.Second))
+        if m, err := c.LerMensagem(); err == nil {
+            t.Fatalf("%s: expected the server to close the connection, got %q", nome, m)
+        }
+        c.Fechar()
+    }
+}
+
+// TestReservarSeqEmBlocos verifica que o arquivo de seq guarda o fim do bloco
+// reservado e que um cliente reiniciado continua depois dele
+func TestReservarSeqEmBlocos(t *testing.T) {
+    t.Chdir(t.TempDir())
+    r := NewRPCClient("127.0.0.1:1", "seq")
+    for i := int64(1); i <= 3; i++ {
+        if seq := r.ReservarSeq(); seq != i {
+            t.Fatalf("expected seq %d, got %d", i, seq)
+        }
+    }
+    arquivo := func() string {
+        data, err := os.ReadFile(r.seqFilePath())
+        if err != nil {
+            t.Fatalf("read seq file: %v", err)
+        }
+        return string(data)
+    }
+    if got := arquivo(); got != "256" {
+        t.Fatalf("expected end of block 256 in seq file, got %q", got)
+    }
+
+    // reiniciado: nunca reusa um seq do bloco anterior
+    r2 := NewRPCClient("127.0.0.1:1", "seq")
+    if seq := r2.ReservarSeq(); seq != 257 {
+        t.Fatalf("expected seq 257 after restart, got %d", seq)
+    }
+    if got := arquivo(); got != "512" {
+        t.Fatalf("expected next block end 512 in seq file, got %q", got)
+    }
+}
@@ -0,0 +1,216 @@
+//go:build !server
+// +build !server
+
+// client_ws.go - Transporte WebSocket do RPCClient
+//
+// Com RPC_ADDR=ws://127.0.0.1:<porta>/ws o RPCClient fala com o endpoint de
+// server_ws.go em vez do net/rpc. transporteWS tem o mesmo Call do
+// *rpc.Client, então retentativas, re-registro e deltas do RPCClient não
+// mudam. A diferença está no WatchState: em vez de um long-poll por chamada,
+// o transporte assina os estados uma vez e cada WatchState devolve o próximo
+// estado empurrado pelo servidor (ou, no timeout, um delta vazio). Ele
+// assina de novo quando o RPCClient pede uma versão diferente da última
+// entregue, por exemplo depois de perder a base dos deltas.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/rpc"
+	"strings"
+	"sync"
+	"time"
+)
+
+// errTransporteFechado é devolvido pelas chamadas depois que a conexão caiu;
+// não é um rpc.ServerError, então o RPCClient reconecta e tenta de novo
+var errTransporteFechado = errors.New("websocket connection closed")
+
+// transporteWS faz as chamadas do RPCClient por uma conexão WebSocket
+type transporteWS struct {
+	conn *ConexaoWS
+
+	mu        sync.Mutex
+	proximoID int64
+	esperando map[int64]chan RespostaWS // chamadas aguardando resposta, por ID
+	fechado   bool
+
+	// assinatura dos estados
+	assinatura  *WatchArgs    // argumentos da assinatura atual (nil = nenhuma)
+	estados     []StateReply  // estados empurrados ainda não entregues
+	erroEstados error         // erro que terminou a assinatura
+	chegou      chan struct{} // avisa que estados ou erroEstados mudaram
+	versao      int64         // versão do último estado entregue
+	sala        string        // sala do último estado entregue
+}
+
+// conectarTransporteWS abre a conexão e começa a ler as mensagens do servidor
+func conectarTransporteWS(endereco string) (*transporteWS, error) {
+	conn, err := conectarWS(endereco)
+	if err != nil {
+		return nil, err
+	}
+	t := &transporteWS{conn: conn, esperando: make(map[int64]chan RespostaWS), chegou: make(chan struct{}, 1)}
+	go t.ler()
+	return t, nil
+}
+
+// ler distribui as mensagens do servidor: respostas para quem as espera e
+// estados para a fila da assinatura
+func (t *transporteWS) ler() {
+	for {
+		var m RespostaWS
+		if err := t.conn.LerJSON(&m); err != nil {
+			dbg.Printf("[CLIENT] WebSocket encerrado: %v\n", err)
+			t.Close()
+			return
+		}
+		t.mu.Lock()
+		switch {
+		case m.ID != 0:
+			if ch, ok := t.esperando[m.ID]; ok {
+				delete(t.esperando, m.ID)
+				ch <- m
+			}
+		case m.State != nil:
+			t.estados = append(t.estados, *m.State)
+		case m.Error != "":
+			t.erroEstados = rpc.ServerError(m.Error)
+			t.assinatura = nil
+		}
+		t.mu.Unlock()
+		t.avisar()
+	}
+}
+
+func (t *transporteWS) avisar() {
+	select {
+	case t.chegou <- struct{}{}:
+	default:
+	}
+}
+
+// Call faz a chamada metodo ("GameServer.SendCommand", ...) como o *rpc.Client
+func (t *transporteWS) Call(metodo string, args, reply interface{}) error {
+	metodo = strings.TrimPrefix(metodo, "GameServer.")
+	if metodo == "WatchState" {
+		return t.assistir(args.(*WatchArgs), reply.(*StateReply))
+	}
+
+	params, err := json.Marshal(args)
+	if err != nil {
+		return err
+	}
+	ch := make(chan RespostaWS, 1)
+	t.mu.Lock()
+	if t.fechado {
+		t.mu.Unlock()
+		return errTransporteFechado
+	}
+	t.proximoID++
+	id := t.proximoID
+	t.esperando[id] = ch
+	t.mu.Unlock()
+
+	if err := t.conn.EscreverJSON(PedidoWS{ID: id, Method: metodo, Params: params}); err != nil {
+		t.Close()
+		return err
+	}
+	resp, ok := <-ch
+	if !ok {
+		return errTransporteFechado
+	}
+	if resp.Error != "" {
+		return rpc.ServerError(resp.Error)
+	}
+	return json.Unmarshal(resp.Result, reply)
+}
+
+// assistir entrega o próximo estado da assinatura, assinando antes se
+// necessário. No timeout devolve um delta vazio sobre a versão pedida.
+func (t *transporteWS) assistir(args *WatchArgs, reply *StateReply) error {
+	t.mu.Lock()
+	if t.fechado {
+		t.mu.Unlock()
+		return errTransporteFechado
+	}
+	if err := t.erroEstados; err != nil {
+		// a assinatura terminou (ex.: token recusado); a próxima chamada assina de novo
+		t.erroEstados = nil
+		t.mu.Unlock()
+		return err
+	}
+	a := t.assinatura
+	if a == nil || a.ClientID != args.ClientID || a.Token != args.Token ||
+		args.SinceVersion != t.versao || (args.Room != "" && args.Room != t.sala) {
+		// assinatura nova a partir do que o RPCClient tem
+		nova := *args
+		t.assinatura, t.estados, t.erroEstados = &nova, nil, nil
+		t.versao, t.sala = args.SinceVersion, args.Room
+		t.mu.Unlock()
+		params, err := json.Marshal(args)
+		if err != nil {
+			return err
+		}
+		dbg.Printf("[CLIENT] WebSocket Subscribe desde a versão %d\n", args.SinceVersion)
+		if err := t.conn.EscreverJSON(PedidoWS{Method: "Subscribe", Params: params}); err != nil {
+			t.Close()
+			return err
+		}
+		t.mu.Lock()
+	}
+	t.mu.Unlock()
+
+	timeout := time.Duration(args.TimeoutMS) * time.Millisecond
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		t.mu.Lock()
+		switch {
+		case len(t.estados) > 0:
+			*reply = t.estados[0]
+			t.estados = t.estados[1:]
+			t.versao, t.sala = reply.Version, reply.Room
+			t.mu.Unlock()
+			return nil
+		case t.erroEstados != nil:
+			err := t.erroEstados
+			t.erroEstados = nil
+			t.mu.Unlock()
+			return err
+		case t.fechado:
+			t.mu.Unlock()
+			return errTransporteFechado
+		}
+		t.mu.Unlock()
+
+		select {
+		case <-t.chegou:
+		case <-timer.C:
+			t.mu.Lock()
+			*reply = StateReply{Room: t.sala, Version: t.versao, BaseVersion: t.versao}
+			t.mu.Unlock()
+			return nil
+		}
+	}
+}
+
+// Close fecha a conexão; as chamadas pendentes recebem errTransporteFechado
+func (t *transporteWS) Close() error {
+	t.mu.Lock()
+	if t.fechado {
+		t.mu.Unlock()
+		return nil
+	}
+	t.fechado = true
+	for id, ch := range t.esperando {
+		close(ch)
+		delete(t.esperando, id)
+	}
+	t.mu.Unlock()
+	t.avisar()
+	return t.conn.Fechar()
+}
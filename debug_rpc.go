@@ -1,7 +1,11 @@
 //go:build ignore
 // +build ignore
 
-// debug_rpc.go - util simples para testar conexão e GetState
+// debug_rpc.go - util simples para testar conexão, Hello e GetState
+//
+// Roda sozinho (go run debug_rpc.go), então tem cópias próprias dos tipos de
+// rpc_types.go. Por isso chama GameServer.Hello antes de tudo: se o servidor
+// fala outra versão do protocolo, as cópias podem estar desatualizadas.
 package main
 
 import (
@@ -10,6 +14,26 @@ import (
 	"time"
 )
 
+// versaoProtocolo é a cópia de VersaoProtocolo (rpc_types.go) destes tipos
+const versaoProtocolo = 2
+
+type HelloArgs struct {
+	ClientID    string
+	Protocol    int
+	MinProtocol int
+	Build       string
+}
+
+type HelloReply struct {
+	Protocol     int
+	MinProtocol  int
+	Build        string
+	Commands     []string
+	Capabilities []string
+	Map          string
+	MapChecksum  string
+}
+
 type ClientIDArgs struct {
 	ClientID string
 	Now      time.Time
@@ -43,6 +67,23 @@ func main() {
 	
 	fmt.Println("✓ Conectado ao servidor!")
 	
+	// Testar Hello
+	hello := HelloReply{Protocol: 1, MinProtocol: 1}
+	helloArgs := HelloArgs{ClientID: "debug-checker", Protocol: versaoProtocolo, MinProtocol: versaoProtocolo, Build: "debug_rpc"}
+	if err := client.Call("GameServer.Hello", &helloArgs, &hello); err != nil {
+		fmt.Printf("⚠ Servidor sem Hello (%v): protocolo 1\n", err)
+	} else {
+		fmt.Printf("\n✓ Hello funcionou!\n")
+		fmt.Printf("  Protocolo: %d (mínimo %d), build %s\n", hello.Protocol, hello.MinProtocol, hello.Build)
+		fmt.Printf("  Comandos: %v\n", hello.Commands)
+		fmt.Printf("  Capacidades: %v\n", hello.Capabilities)
+		fmt.Printf("  Mapa: %s (sha256 %s)\n", hello.Map, hello.MapChecksum)
+	}
+	if hello.Protocol != versaoProtocolo {
+		fmt.Printf("ERRO: este utilitário fala o protocolo %d e o servidor o %d; atualize os tipos de debug_rpc.go\n", versaoProtocolo, hello.Protocol)
+		return
+	}
+	
 	// Testar GetState
 	args := ClientIDArgs{ClientID: "debug-checker", Now: time.Now()}
 	var reply StateReply
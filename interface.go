@@ -10,6 +10,7 @@ package main
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/nsf/termbox-go"
 )
@@ -30,9 +31,32 @@ const (
 	CorMagenta         = termbox.ColorLightMagenta
 )
 
+// coresPorNome são os nomes de cor aceitos na legenda dos mapas
+var coresPorNome = map[string]Cor{
+	"padrao":   CorPadrao,
+	"preto":    termbox.ColorBlack,
+	"vermelho": CorVermelho,
+	"verde":    CorVerde,
+	"amarelo":  CorAmarelo,
+	"azul":     termbox.ColorBlue,
+	"magenta":  CorMagenta,
+	"ciano":    termbox.ColorCyan,
+	"branco":   termbox.ColorWhite,
+	"cinza":    CorCinzaEscuro,
+}
+
+// corPorNome converte um nome de cor da legenda; nomes vazios ou desconhecidos
+// ficam com a cor padrão do elemento
+func corPorNome(nome string, padrao Cor) Cor {
+	if c, ok := coresPorNome[nome]; ok {
+		return c
+	}
+	return padrao
+}
+
 // EventoTeclado representa uma ação detectada do teclado (como mover, sair ou interagir)
 type EventoTeclado struct {
-	Tipo  string // "sair", "interagir", "mover"
+	Tipo  string // "sair", "interagir", "mover", "confirmar" (Enter), "redimensionar" (terminal mudou de tamanho)
 	Tecla rune   // Tecla pressionada, usada no caso de movimento
 }
 
@@ -48,61 +72,85 @@ func interfaceFinalizar() {
 	termbox.Close()
 }
 
-// Lê um evento do teclado e o traduz para um EventoTeclado
-func interfaceLerEventoTeclado(canal chan EventoTeclado) {
+// Lê os eventos da fonte de teclas e os envia no canal, até a fonte acabar
+func interfaceLerEventoTeclado(fonte FonteTeclado, canal chan<- EventoTeclado) {
 	for {
-		ev := termbox.PollEvent()
-		if ev.Type != termbox.EventKey {
-			continue
-		}
-
-		var evento EventoTeclado
-		if ev.Key == termbox.KeyEsc {
-			evento = EventoTeclado{Tipo: "sair"}
-		} else if ev.Ch == 'e' {
-			evento = EventoTeclado{Tipo: "interagir"}
-		} else {
-			evento = EventoTeclado{Tipo: "mover", Tecla: ev.Ch}
+		evento, ok := fonte.LerEvento()
+		if !ok {
+			return
 		}
 		canal <- evento
 	}
 }
 
 // Renderiza todo o estado atual do jogo na tela
-func interfaceDesenharJogo(jogo *Jogo, armadilhas []*Armadilha, moeda *Moeda) {
-	interfaceLimparTela()
+func interfaceDesenharJogo(tela Renderer, jogo *Jogo, armadilhas []*Armadilha, moeda *Moeda) {
+	tela.Limpar()
 
-	// Desenha todos os elementos do mapa
+	// só a parte do mapa em volta do personagem que cabe na tela
+	largura, altura := tela.Tamanho()
+	cam := cameraSeguir(jogo, largura, altura)
+
+	// Desenha todos os elementos do mapa; com neblina, as células fora da
+	// visão aparecem apagadas se já foram exploradas e vazias se não
 	for y, linha := range jogo.Mapa {
 		for x, elem := range linha {
-			interfaceDesenharElemento(x, y, elem)
+			switch {
+			case visaoEnxerga(jogo, x, y):
+				interfaceDesenharElemento(tela, cam, x, y, elem)
+			case visaoExplorada(jogo, x, y):
+				interfaceDesenharElemento(tela, cam, x, y, Elemento{simbolo: elem.simbolo, cor: CorCinzaEscuro, corFundo: CorPadrao})
+			}
 		}
 	}
 
 	//desenhar armadilhas sobre o mapa
 	for _, a := range armadilhas {
 		if a.Ativa {
-			interfaceDesenharElemento(a.X, a.Y, ArmadilhaElem)
+			interfaceDesenharVisivel(tela, cam, jogo, a.X, a.Y, ArmadilhaElem)
 		}
 	}
 
 	//desenha a moeda sobre o mapa
-	interfaceDesenharElemento(moeda.X, moeda.Y, MoedaElem)
+	if moeda != nil {
+		interfaceDesenharVisivel(tela, cam, jogo, moeda.X, moeda.Y, MoedaElem)
+	}
 
-	//desenha o monstro sobre o mapa
-	interfaceDesenharElemento(jogo.MonstroX, jogo.MonstroY, MonstroElem)
+	// moedas e armadilhas do servidor (modo online)
+	for _, e := range jogo.Entidades {
+		switch e.Kind {
+		case EntidadeMoeda:
+			interfaceDesenharVisivel(tela, cam, jogo, e.X, e.Y, MoedaElem)
+		case EntidadeArmadilha:
+			interfaceDesenharVisivel(tela, cam, jogo, e.X, e.Y, ArmadilhaElem)
+		}
+	}
 
-	// Desenha o personagem sobre o mapa
-	interfaceDesenharElemento(jogo.PosX, jogo.PosY, Personagem)
+	// outros jogadores e monstros do servidor são desenhados interpolados;
+	// offline (sem estados do servidor) ficam as posições de jogo
+	outros, monstros := jogo.OtherPlayers, jogo.Monstros
+	if j, m, ok := jogo.Remotos.Posicoes(time.Now()); ok {
+		outros, monstros = j, m
+	}
+
+	//desenha os monstros sobre o mapa
+	for _, m := range monstros {
+		interfaceDesenharVisivel(tela, cam, jogo, m.X, m.Y, monstroElemento(m))
+	}
+
+	// Desenha o personagem sobre o mapa; pisca enquanto está invulnerável
+	if !jogoInvulneravel(jogo) || jogo.Invulneravel/4%2 == 0 {
+		interfaceDesenharElemento(tela, cam, jogo.PosX, jogo.PosY, Personagem)
+	}
 
 	// === B) desenhar outros joadores
-	if len(jogo.OtherPlayers) > 0 {
+	if len(outros) > 0 {
 		remoteElem := Elemento{simbolo: '☺', cor: CorAmarelo, corFundo: CorPadrao, tangivel: true}
-		for _, p := range jogo.OtherPlayers {
+		for _, p := range outros {
 			if p.ID == LocalClientID {
 				continue
 			}
-			interfaceDesenharElemento(p.X, p.Y, remoteElem)
+			interfaceDesenharVisivel(tela, cam, jogo, p.X, p.Y, remoteElem)
 		}
 	}
 	// TODO Member B: desenhar outros jogadores reportados pelo servidor
@@ -114,60 +162,56 @@ func interfaceDesenharJogo(jogo *Jogo, armadilhas []*Armadilha, moeda *Moeda) {
 	// for _, p := range jogo.OtherPlayers {
 	//     if p.ID == LocalClientID { continue }
 	//     // desenhar um símbolo simples para outros jogadores, por exemplo '☺' com cor diferente
-	//     interfaceDesenharElemento(p.X, p.Y, Elemento{simbolo: '☺', cor: CorAmarelo, corFundo: CorPadrao, tangivel: true})
+	//     interfaceDesenharElemento(tela, cam, p.X, p.Y, Elemento{simbolo: '☺', cor: CorAmarelo, corFundo: CorPadrao, tangivel: true})
 	// }
 
 	// Desenha a barra de status
-	interfaceDesenharBarraDeStatus(jogo)
-
-	// Força a atualização do terminal
-	interfaceAtualizarTela()
+	interfaceDesenharBarraDeStatus(tela, jogo, cam)
 
 	// desenha painel de debug ao lado
-	interfaceDesenharDebugPanel(jogo)
+	interfaceDesenharDebugPanel(tela, cam)
 
-	termbox.Flush()
+	// Força a atualização da tela com os dados desenhados
+	tela.Atualizar()
 }
 
-// Limpa a tela do terminal
-func interfaceLimparTela() {
-	termbox.Clear(CorPadrao, CorPadrao)
-}
-
-// Força a atualização da tela do terminal com os dados desenhados
-func interfaceAtualizarTela() {
-	termbox.Flush()
+// Desenha um elemento na posição (x, y) do mapa, se ela estiver na câmera
+func interfaceDesenharElemento(tela Renderer, cam Camera, x, y int, elem Elemento) {
+	if !cam.Visivel(x, y) {
+		return
+	}
+	tx, ty := cam.Tela(x, y)
+	tela.Celula(tx, ty, elem.simbolo, elem.cor, elem.corFundo)
 }
 
-// Desenha um elemento na posição (x, y)
-func interfaceDesenharElemento(x, y int, elem Elemento) {
-	termbox.SetCell(x, y, elem.simbolo, elem.cor, elem.corFundo)
+// Desenha um elemento que só aparece onde o personagem enxerga agora
+func interfaceDesenharVisivel(tela Renderer, cam Camera, jogo *Jogo, x, y int, elem Elemento) {
+	if visaoEnxerga(jogo, x, y) {
+		interfaceDesenharElemento(tela, cam, x, y, elem)
+	}
 }
 
-// Exibe uma barra de status com informações úteis ao jogador
-func interfaceDesenharBarraDeStatus(jogo *Jogo) {
+// Exibe uma barra de status com informações úteis ao jogador, logo abaixo
+// da parte visível do mapa
+func interfaceDesenharBarraDeStatus(tela Renderer, jogo *Jogo, cam Camera) {
 	// Linha de status dinâmica
-	status := fmt.Sprintf("%s | Moedas: %d", jogo.StatusMsg, jogo.Pontos)
-	for i, c := range status {
-		termbox.SetCell(i, len(jogo.Mapa)+1, c, CorTexto, CorPadrao)
-	}
+	status := fmt.Sprintf("%s | Vidas: %d | Moedas: %d | Semente: %d", jogo.StatusMsg, jogo.Vidas, jogo.Pontos, jogo.Semente)
+	tela.Texto(0, cam.Altura+1, status, CorTexto, CorPadrao)
 
 	// Instruções fixas
 	msg := "Use WASD para mover e E para interagir. ESC para sair."
-	for i, c := range msg {
-		termbox.SetCell(i, len(jogo.Mapa)+3, c, CorTexto, CorPadrao)
-	}
+	tela.Texto(0, cam.Altura+3, msg, CorTexto, CorPadrao)
 }
 
-func interfaceDesenharDebugPanel(jogo *Jogo) {
+func interfaceDesenharDebugPanel(tela Renderer, cam Camera) {
 	if !debugPanelEnabled {
 		return
 	}
 	debugPanelDrain()
 
-	w, h := termbox.Size()
+	w, h := tela.Tamanho()
 
-	mapH := len(jogo.Mapa)
+	mapH := cam.Altura
 
 	// A barra de status usa duas linhas (y=mapH+1 e y=mapH+3).
 	top := mapH + 5
@@ -181,12 +225,12 @@ func interfaceDesenharDebugPanel(jogo *Jogo) {
 	// Limpa a região do painel (toda a largura, do "top" até o fim)
 	for y := top; y < h; y++ {
 		for x := 0; x < w; x++ {
-			termbox.SetCell(x, y, ' ', fg, bg)
+			tela.Celula(x, y, ' ', fg, bg)
 		}
 	}
 
 	// título
-	tbPrint(1, top, fg|termbox.AttrBold, bg, "Logs (DEBUG_PANEL)")
+	tela.Texto(1, top, "Logs (DEBUG_PANEL)", fg|termbox.AttrBold, bg)
 
 	// últimas linhas, de baixo para cima
 	maxLines := h - (top + 1)
@@ -202,21 +246,47 @@ func interfaceDesenharDebugPanel(jogo *Jogo) {
 	}
 	for i := start; i < len(lines) && y < h; i++ {
 		line := truncateToWidth(lines[i], w-2)
-		tbPrint(1, y, termbox.ColorWhite, bg, line)
+		tela.Texto(1, y, line, termbox.ColorWhite, bg)
 		y++
 	}
 }
 
-// helpers simples para escrever texto e truncar
-func tbPrint(x, y int, fg, bg termbox.Attribute, msg string) {
-	for i, ch := range msg {
-		termbox.SetCell(x+i, y, ch, fg, bg)
-	}
-}
-
+// helper simples para truncar
 func truncateToWidth(s string, w int) string {
 	if w <= 0 || len(s) <= w {
 		return s
 	}
 	return s[:w]
 }
+
+// interfaceEscolherSala mostra o menu inicial com as salas abertas no servidor
+// e devolve o índice escolhido (teclas 1-9), -1 para criar uma sala nova ('n')
+// ou -2 para ficar no lobby (Enter/ESC)
+func interfaceEscolherSala(tela Renderer, canalTeclado <-chan EventoTeclado, salas []RoomInfo) int {
+	for {
+		tela.Limpar()
+		tela.Texto(0, 0, "Escolha uma sala", CorAmarelo|termbox.AttrBold, CorPadrao)
+		for i, s := range salas {
+			if i >= 9 {
+				break
+			}
+			capacidade := fmt.Sprintf("%d jogadores", s.Players)
+			if s.Capacity > 0 {
+				capacidade = fmt.Sprintf("%d/%d", s.Players, s.Capacity)
+			}
+			tela.Texto(2, i+2, fmt.Sprintf("%d) %s  [%s]  %s", i+1, s.Name, s.Map, capacidade), CorPadrao, CorPadrao)
+		}
+		tela.Texto(0, len(salas)+3, "1-9 entra na sala, N cria uma sala nova, Enter fica no lobby", CorTexto, CorPadrao)
+		tela.Atualizar()
+
+		ev := <-canalTeclado
+		switch {
+		case ev.Tipo == "confirmar" || ev.Tipo == "sair":
+			return -2
+		case ev.Tecla == 'n' || ev.Tecla == 'N':
+			return -1
+		case ev.Tecla >= '1' && ev.Tecla <= '9' && int(ev.Tecla-'1') < len(salas):
+			return int(ev.Tecla - '1')
+		}
+	}
+}
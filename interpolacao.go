@@ -0,0 +1,135 @@
+//go:build !server
+// +build !server
+
+// interpolacao.go - Desenho suave dos jogadores e monstros do servidor
+//
+// Cada StateReply traz ServerTime, em milissegundos. O cliente guarda os
+// estados recebidos e desenha os outros jogadores e os monstros do servidor
+// um pouco no passado (atrasoInterpolacao), entre os dois estados em volta
+// desse instante, para que eles andem casa a casa em vez de pular a cada
+// resposta. Se o próximo estado demora, o movimento continua por no máximo
+// um intervalo entre estados (e nunca mais que maxExtrapolacao); depois disso
+// eles ficam na última posição recebida, já que no long-poll a falta de
+// resposta também pode querer dizer que nada mudou. Só o desenho usa essas
+// posições: colisões e dano continuam usando o último estado recebido.
+package main
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	atrasoInterpolacao = 100 * time.Millisecond // entidades remotas são desenhadas esse tempo no passado
+	maxExtrapolacao    = 250 * time.Millisecond // maior tempo que o movimento continua sem estado novo
+)
+
+// quadroRemoto é um estado recebido do servidor
+type quadroRemoto struct {
+	instante  int64 // StateReply.ServerTime (ms)
+	jogadores []PlayerInfo
+	monstros  []MonsterInfo
+}
+
+// Interpolador guarda os estados recebidos e calcula as posições a desenhar
+type Interpolador struct {
+	quadros []quadroRemoto
+	// desvio estimado entre o relógio do servidor e o local (ms): o maior
+	// ServerTime - chegada visto, ou seja, o da resposta que chegou mais rápido
+	desvio    int64
+	temDesvio bool
+}
+
+// Adicionar guarda um estado recebido em agora. Estados sem ServerTime ou
+// mais antigos que o último guardado são ignorados.
+func (ip *Interpolador) Adicionar(st StateReply, agora time.Time) {
+	if st.ServerTime == 0 {
+		return
+	}
+	if d := st.ServerTime - agora.UnixMilli(); !ip.temDesvio || d > ip.desvio {
+		ip.desvio, ip.temDesvio = d, true
+	}
+	q := quadroRemoto{instante: st.ServerTime, jogadores: st.Players, monstros: st.Monsters}
+	n := len(ip.quadros)
+	switch {
+	case n > 0 && st.ServerTime < ip.quadros[n-1].instante:
+		return
+	case n > 0 && st.ServerTime == ip.quadros[n-1].instante:
+		ip.quadros[n-1] = q
+	default:
+		ip.quadros = append(ip.quadros, q)
+	}
+}
+
+// Posicoes devolve os jogadores e monstros como devem aparecer em agora.
+// Devolve false enquanto nenhum estado foi guardado.
+func (ip *Interpolador) Posicoes(agora time.Time) ([]PlayerInfo, []MonsterInfo, bool) {
+	if len(ip.quadros) == 0 {
+		return nil, nil, false
+	}
+	t := agora.UnixMilli() + ip.desvio - atrasoInterpolacao.Milliseconds()
+	// só é preciso guardar um estado anterior ao instante desenhado
+	for len(ip.quadros) > 2 && ip.quadros[1].instante <= t {
+		ip.quadros = ip.quadros[1:]
+	}
+
+	n := len(ip.quadros)
+	ultimo := ip.quadros[n-1]
+	switch {
+	case n == 1 || t <= ip.quadros[0].instante:
+		q := ip.quadros[0]
+		if n == 1 {
+			q = ultimo
+		}
+		return interpolarQuadros(q, q, 0)
+	case t < ultimo.instante:
+		a, b := ip.quadros[0], ip.quadros[1]
+		return interpolarQuadros(a, b, float64(t-a.instante)/float64(b.instante-a.instante))
+	}
+
+	// sem estado novo: continua o movimento dos dois últimos por pouco tempo
+	a := ip.quadros[n-2]
+	intervalo := ultimo.instante - a.instante
+	passado := t - ultimo.instante
+	if passado > min(intervalo, maxExtrapolacao.Milliseconds()) {
+		return interpolarQuadros(ultimo, ultimo, 0)
+	}
+	return interpolarQuadros(a, ultimo, 1+float64(passado)/float64(intervalo))
+}
+
+// interpolarQuadros calcula as posições na fração f do caminho de a até b
+// (f > 1 extrapola). Entidades que não estão nos dois usam a posição de b.
+func interpolarQuadros(a, b quadroRemoto, f float64) ([]PlayerInfo, []MonsterInfo, bool) {
+	antesJ := make(map[string]PlayerInfo, len(a.jogadores))
+	for _, p := range a.jogadores {
+		antesJ[p.ID] = p
+	}
+	jogadores := make([]PlayerInfo, len(b.jogadores))
+	for i, p := range b.jogadores {
+		if ant, ok := antesJ[p.ID]; ok {
+			p.X, p.Y = interpolarPos(ant.X, ant.Y, p.X, p.Y, f)
+		}
+		jogadores[i] = p
+	}
+
+	antesM := make(map[string]MonsterInfo, len(a.monstros))
+	for _, m := range a.monstros {
+		antesM[m.ID] = m
+	}
+	monstros := make([]MonsterInfo, len(b.monstros))
+	for i, m := range b.monstros {
+		if ant, ok := antesM[m.ID]; ok {
+			m.X, m.Y = interpolarPos(ant.X, ant.Y, m.X, m.Y, f)
+		}
+		monstros[i] = m
+	}
+	return jogadores, monstros, true
+}
+
+// interpolarPos arredonda para a célula mais próxima do ponto na fração f
+// entre (x0, y0) e (x1, y1)
+func interpolarPos(x0, y0, x1, y1 int, f float64) (int, int) {
+	x := float64(x0) + float64(x1-x0)*f
+	y := float64(y0) + float64(y1-y0)*f
+	return int(math.Round(x)), int(math.Round(y))
+}
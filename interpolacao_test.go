@@ -0,0 +1,54 @@
+//go:build !server
+// +build !server
+
+package main
+
+import (
+    "testing"
+    "time"
+)
+
+// TestInterpolacaoRemotos verifica a interpolação entre estados, a
+// extrapolação curta sem estado novo e a volta à última posição recebida
+func TestInterpolacaoRemotos(t *testing.T) {
+    var ip Interpolador
+    estado := func(ms int64, x int) StateReply {
+        return StateReply{
+            ServerTime: ms,
+            Players:    []PlayerInfo{{ID: "b", X: x, Y: 1}},
+            Monsters:   []MonsterInfo{{ID: "m", X: 10 - x, Y: 2}},
+        }
+    }
+    // relógios iguais: cada estado chega no instante em que saiu do servidor
+    ip.Adicionar(estado(1000, 0), time.UnixMilli(1000))
+    ip.Adicionar(estado(1200, 4), time.UnixMilli(1200))
+    ip.Adicionar(estado(1100, 9), time.UnixMilli(1250)) // fora de ordem, ignorado
+
+    casos := []struct {
+        agora int64
+        x, mx int
+    }{
+        {1050, 0, 10}, // antes do primeiro estado
+        {1200, 2, 8},  // metade do caminho (desenhado 100ms no passado)
+        {1350, 5, 5},  // sem estado novo: continua o movimento
+        {1600, 4, 6},  // passou do intervalo: fica na última posição recebida
+    }
+    for _, c := range casos {
+        jogadores, monstros, ok := ip.Posicoes(time.UnixMilli(c.agora))
+        if !ok || len(jogadores) != 1 || len(monstros) != 1 {
+            t.Fatalf("at %d: expected one player and one monster, got %v %v %v", c.agora, jogadores, monstros, ok)
+        }
+        if jogadores[0].X != c.x || monstros[0].X != c.mx {
+            t.Fatalf("at %d: expected player x=%d monster x=%d, got %d and %d", c.agora, c.x, c.mx, jogadores[0].X, monstros[0].X)
+        }
+    }
+}
+
+// TestInterpolacaoSemEstados verifica que sem estados do servidor (offline)
+// o desenho continua usando as posições do jogo
+func TestInterpolacaoSemEstados(t *testing.T) {
+    var ip Interpolador
+    if _, _, ok := ip.Posicoes(time.Now()); ok {
+        t.Fatalf("expected no positions without states")
+    }
+}
@@ -5,9 +5,7 @@
 package main
 
 import (
-	"bufio"
 	"math/rand"
-	"os"
 	"time"
 )
 
@@ -21,44 +19,46 @@ type Elemento struct {
 
 // Jogo contém o estado atual do jogo
 type Jogo struct {
-	Mapa               [][]Elemento // grade 2D representando o mapa
-	PosX, PosY         int          // posição atual do personagem
-	UltimoVisitado     Elemento     // elemento que estava na posição do personagem antes de mover
-	StatusMsg          string       // mensagem para a barra de status
-	MonstroX, MonstroY int          //posicao atual do monstro
-	Pontos             int          //moedas coletadas
+	Mapa           [][]Elemento  // grade 2D representando o mapa
+	PosX, PosY     int           // posição atual do personagem
+	UltimoVisitado Elemento      // elemento que estava na posição do personagem antes de mover
+	StatusMsg      string        // mensagem para a barra de status
+	Monstros       []MonsterInfo //posicao atual dos monstros (do servidor ou o monstro local)
+	Pontos         int           //moedas coletadas
 	// OtherPlayers é preenchido pela goroutine de polling (chamada a GetState)
 	// TODO Member B: popular este campo com os dados retornados por rpcClient.GetState()
 	OtherPlayers []PlayerInfo
+	// Pendentes são os comandos enviados ao servidor ainda sem resposta, em
+	// ordem de Seq; os MOVE são refeitos sobre cada posição oficial recebida
+	Pendentes []ComandoPendente
+	// Entidades são as moedas e armadilhas do servidor (modo online)
+	Entidades []EntityInfo
+	// ColetaPendente é o ID da moeda pedida com COLLECT ainda sem resposta
+	ColetaPendente string
+	// Posições marcadas no arquivo de mapa (ver mapa_formato.go): inícios de
+	// jogador e onde nascem monstros, armadilhas e moedas no modo offline
+	Inicios, SpawnArmadilhas, SpawnMoedas []PosicaoMapa
+	SpawnMonstros                         []MarcadorMonstro
+	// UltimaDirecao é o último passo do personagem (usado pelo emboscador)
+	UltimaDirecao PosicaoMapa
+	// Vidas restantes; monstros e armadilhas tiram uma e o jogo acaba em zero
+	Vidas int
+	// Invulneravel conta os passos da simulação em que o personagem ainda não
+	// leva dano depois de renascer
+	Invulneravel int
+	// Semente do gerador aleatório da partida (variável SEED); com a mesma
+	// semente e as mesmas teclas a partida se repete igual
+	Semente int64
+	rng     *rand.Rand // único gerador usado pela simulação
+	// Visao é o campo de visão em mapas com neblina (nil quando o mapa todo é visível)
+	Visao *Visao
+	// Remotos guarda os estados do servidor para desenhar os outros jogadores
+	// e os monstros interpolados (ver interpolacao.go)
+	Remotos Interpolador
 }
 
-// mensagem do monstro
-type MonstroMsg struct {
-	X, Y     int
-	Encostou bool
-}
-
-// canal para a comunicacao do monstro
-var canalMonstro = make(chan MonstroMsg)
-
-// armadilhas
-type ArmadilhaMsg struct {
-	ID      int
-	X, Y    int
-	Ativada bool
-}
-
-// canal armadilhas
-var canalArmadilha = make(chan ArmadilhaMsg)
-
-// config da msg
-type MoedaColetadaMsg struct {
-	Moeda    Moeda
-	Coletada bool
-}
-
-// canal para a feature das moedas
-var canalMoedaColetada = make(chan MoedaColetadaMsg)
+// duracaoInvulneravel é a proteção contra dano logo depois de renascer
+const duracaoInvulneravel = 2 * time.Second
 
 // Elementos visuais do jogo
 var (
@@ -71,47 +71,62 @@ var (
 	MoedaElem     = Elemento{'$', CorAmarelo, CorPadrao, false}
 )
 
-// Cria e retorna uma nova instância do jogo
-func jogoNovo() Jogo {
+// Cria e retorna uma nova instância do jogo, com o gerador aleatório
+// iniciado pela semente
+func jogoNovo(semente int64) Jogo {
 	// O ultimo elemento visitado é inicializado como vazio
 	// pois o jogo começa com o personagem em uma posição vazia
-	return Jogo{UltimoVisitado: Vazio}
+	return Jogo{UltimoVisitado: Vazio, Vidas: VidasIniciais, Semente: semente, rng: rand.New(rand.NewSource(semente))}
 }
 
-// Lê um arquivo texto linha por linha e constrói o mapa do jogo
+// Lê o arquivo de mapa (formato descrito em mapa_formato.go) e constrói o mapa
+// do jogo, com as posições marcadas para o personagem e os spawns
 func jogoCarregarMapa(nome string, jogo *Jogo) error {
-	arq, err := os.Open(nome)
+	arq, err := lerMapaArquivo(nome)
 	if err != nil {
 		return err
 	}
-	defer arq.Close()
-
-	scanner := bufio.NewScanner(arq)
-	y := 0
-	for scanner.Scan() {
-		linha := scanner.Text()
-		var linhaElems []Elemento
-		for x, ch := range linha {
-			e := Vazio
-			switch ch {
-			case Parede.simbolo:
-				e = Parede
-			case Vegetacao.simbolo:
-				e = Vegetacao
-			case Personagem.simbolo:
-				jogo.PosX, jogo.PosY = x, y // registra a posição inicial do personagem
-			}
-			linhaElems = append(linhaElems, e)
+	for _, celulas := range arq.Celulas {
+		linhaElems := make([]Elemento, len(celulas))
+		for x, c := range celulas {
+			linhaElems[x] = elementoDaLegenda(c)
 		}
 		jogo.Mapa = append(jogo.Mapa, linhaElems)
-		y++
 	}
-	if err := scanner.Err(); err != nil {
-		return err
+	jogo.Inicios = arq.Inicios
+	jogo.SpawnMonstros = arq.Monstros
+	jogo.SpawnArmadilhas = arq.Armadilhas
+	jogo.SpawnMoedas = arq.Moedas
+	if len(arq.Inicios) > 0 {
+		// registra a posição inicial do personagem
+		jogo.PosX, jogo.PosY = arq.Inicios[0].X, arq.Inicios[0].Y
 	}
+	jogo.Visao = novaVisao(jogo, arq.Neblina)
+	visaoAtualizar(jogo)
 	return nil
 }
 
+// elementoDaLegenda converte uma entrada da legenda do mapa em Elemento,
+// partindo do elemento padrão do tipo e aplicando símbolo, cores e tangibilidade
+func elementoDaLegenda(e EntradaLegenda) Elemento {
+	var el Elemento
+	switch e.Tipo {
+	case TipoParede:
+		el = Parede
+	case TipoVegetacao:
+		el = Vegetacao
+	case TipoElemento:
+		el = Elemento{cor: CorPadrao, corFundo: CorPadrao}
+	default:
+		return Vazio
+	}
+	el.simbolo = e.Simbolo
+	el.tangivel = e.Tangivel
+	el.cor = corPorNome(e.Cor, el.cor)
+	el.corFundo = corPorNome(e.Fundo, el.corFundo)
+	return el
+}
+
 // Verifica se o personagem pode se mover para a posição (x, y)
 func jogoPodeMoverPara(jogo *Jogo, x, y int) bool {
 	// Verifica se a coordenada Y está dentro dos limites verticais do mapa
@@ -145,86 +160,31 @@ func jogoMoverElemento(jogo *Jogo, x, y, dx, dy int) {
 	jogo.Mapa[ny][nx] = elemento            // move o elemento
 }
 
-// controla a monstro
-func monstroLoop(monstro *Monstro, jogo *Jogo, canalMonstro chan<- MonstroMsg, done <-chan struct{}) {
-	for {
-		//move em direcao ao player
-		monstroMover(monstro, jogo.PosX, jogo.PosY, jogo)
-		//verifica se encostou no player
-		encostou := monstroEncostou(monstro, jogo)
-		//envia mensagem ao controlador do jogo
-		canalMonstro <- MonstroMsg{X: monstro.X, Y: monstro.Y, Encostou: encostou}
-		//delay para o monstro ir devagar
-		time.Sleep(1000 * time.Millisecond)
-	}
+// jogoInvulneravel indica se o personagem ainda está protegido após renascer
+func jogoInvulneravel(jogo *Jogo) bool {
+	return jogo.Invulneravel > 0
 }
 
-// controla as armadilhas
-func armadilhaLoop(armadilha *Armadilha, jogo *Jogo, canalArmadilha chan<- ArmadilhaMsg, done <-chan struct{}) {
-	for {
-		if armadilhaAtivada(armadilha, jogo) {
-			canalArmadilha <- ArmadilhaMsg{
-				ID:      armadilha.ID,
-				X:       armadilha.X,
-				Y:       armadilha.Y,
-				Ativada: true,
-			}
-			return
-		}
-		time.Sleep(50 * time.Millisecond)
+// jogoSofrerDano tira uma vida do personagem. Devolve false se ele estava
+// invulnerável (ou já sem vidas) e nada mudou.
+func jogoSofrerDano(jogo *Jogo) bool {
+	if jogo.Vidas <= 0 || jogoInvulneravel(jogo) {
+		return false
 	}
+	jogo.Vidas--
+	return true
 }
 
-func moedaColetada(moeda *Moeda, jogo *Jogo) bool {
-	return moeda.X == jogo.PosX && moeda.Y == jogo.PosY
-}
-
-func moedaLoop(moeda *Moeda, jogo *Jogo, canalMoeda chan<- Moeda, canalMoedaColetada chan<- MoedaColetadaMsg, done <-chan struct{}) {
-	r := rand.New(rand.NewSource(time.Now().UnixNano()))
-	ticker := time.NewTicker(15 * time.Second)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-done:
-			return
-		case <-ticker.C:
-			// Muda posição pelo timer - sem incrementar pontos
-			for {
-				nx := r.Intn(len(jogo.Mapa[0]))
-				ny := r.Intn(len(jogo.Mapa))
-				if jogoPodeMoverPara(jogo, nx, ny) && (nx != jogo.PosX || ny != jogo.PosY) {
-					moeda.X = nx
-					moeda.Y = ny
-					canalMoeda <- Moeda{X: nx, Y: ny}
-					break
-				}
-			}
-		default:
-			// Verifica se a moeda foi coletada pelo jogador
-			if moedaColetada(moeda, jogo) {
-				// Envia mensagem que moeda foi coletada
-				canalMoedaColetada <- MoedaColetadaMsg{
-					Moeda:    *moeda,
-					Coletada: true,
-				}
-
-				// Incrementa pontos
-				jogo.Pontos++
-
-				// Gera nova posição para a moeda
-				for {
-					nx := r.Intn(len(jogo.Mapa[0]))
-					ny := r.Intn(len(jogo.Mapa))
-					if jogoPodeMoverPara(jogo, nx, ny) && (nx != jogo.PosX || ny != jogo.PosY) {
-						moeda.X = nx
-						moeda.Y = ny
-						canalMoeda <- Moeda{X: nx, Y: ny}
-						break
-					}
-				}
-			}
-			time.Sleep(50 * time.Millisecond)
-		}
+// jogoRenascer leva o personagem ao primeiro início marcado no mapa e o deixa
+// invulnerável por duracaoInvulneravel. No modo online o servidor pode
+// escolher outro início, aplicado quando chega a resposta do RESPAWN.
+func jogoRenascer(jogo *Jogo) {
+	jogo.Invulneravel = int(duracaoInvulneravel / tickSimulacao)
+	jogo.UltimaDirecao = PosicaoMapa{}
+	if len(jogo.Inicios) == 0 {
+		return
 	}
+	ini := jogo.Inicios[0]
+	jogoMoverElemento(jogo, jogo.PosX, jogo.PosY, ini.X-jogo.PosX, ini.Y-jogo.PosY)
+	jogo.PosX, jogo.PosY = ini.X, ini.Y
 }
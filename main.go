@@ -10,8 +10,9 @@ import (
 	"time"
 
 	// === B) imports
-	"crypto/rand"
+	crand "crypto/rand"
 	"encoding/hex"
+	"errors"
 	"strconv"
 	"strings"
 )
@@ -43,8 +44,228 @@ import (
 var (
 	rpcClient     *RPCClient
 	LocalClientID string
+
+	// fila de comandos enviados em ordem ao servidor (MOVE, REGISTER, ...)
+	// e canal com as respostas, consumido pelo loop principal
+	filaComandos      chan ComandoFila
+	respostasComandos chan CommandReply
 )
 
+// ComandoPendente é um comando enfileirado ainda sem resposta do servidor.
+// Nos MOVE, DX/DY é o passo que o cliente já deu localmente (predição).
+type ComandoPendente struct {
+	Seq    int64
+	Cmd    string
+	DX, DY int
+}
+
+// clienteEnfileirar coloca um comando na fila de envio ao servidor, com um
+// Seq reservado, e guarda-o como pendente até a resposta chegar
+func clienteEnfileirar(jogo *Jogo, cmd string, payload interface{}) {
+	if filaComandos == nil {
+		return
+	}
+	c := ComandoFila{Cmd: cmd, Payload: payload, Seq: rpcClient.ReservarSeq()}
+	select {
+	case filaComandos <- c:
+		p := ComandoPendente{Seq: c.Seq, Cmd: cmd}
+		if mv, ok := payload.(MovePayload); ok {
+			p.DX, p.DY, _ = direcaoDelta(mv.Dir)
+		}
+		jogo.Pendentes = append(jogo.Pendentes, p)
+	default:
+		dbg.Printf("[CLIENT] fila de comandos cheia, descartando %s\n", cmd)
+	}
+}
+
+// clienteRegistrar enfileira o REGISTER do começo da rodada. Da segunda rodada
+// em diante a partida anterior é encerrada com LOGOUT antes, porque o servidor
+// não devolve as vidas a um jogador ativo. Como uma sala criada por jogadores
+// fecha quando fica vazia, o jogador volta a ela recriando-a (CREATE_ROOM) ou,
+// se outros continuam lá, com JOIN_ROOM; o que não se aplicar é recusado.
+func clienteRegistrar(jogo *Jogo, rodada int64, sala string) {
+	if rodada == 0 {
+		clienteEnfileirar(jogo, "REGISTER", RegisterPayload{Name: LocalClientID, Room: sala})
+		return
+	}
+	clienteEnfileirar(jogo, "LOGOUT", nil)
+	clienteEnfileirar(jogo, "REGISTER", RegisterPayload{Name: LocalClientID})
+	if sala != "" && sala != SalaPadrao {
+		clienteEnfileirar(jogo, "CREATE_ROOM", RoomPayload{Name: sala})
+		clienteEnfileirar(jogo, "JOIN_ROOM", RoomPayload{Name: sala})
+	}
+}
+
+// clienteReconciliar trata a resposta de um comando enfileirado. A posição
+// da resposta é a oficial depois do comando resp.Seq; o cliente parte dela,
+// refaz os MOVE ainda pendentes (com Seq maior) e, se o resultado difere da
+// posição local, corrige o personagem.
+func clienteReconciliar(jogo *Jogo, resp CommandReply) {
+	// a fila responde em ordem: tudo até resp.Seq já foi respondido
+	n := 0
+	for n < len(jogo.Pendentes) && jogo.Pendentes[n].Seq <= resp.Seq {
+		n++
+	}
+	jogo.Pendentes = jogo.Pendentes[n:]
+
+	switch resp.Message {
+	case "registered", "moved", "blocked", "position-updated", "invalid-position", "respawned", "room-created", "joined-room":
+	case "collected":
+		jogo.ColetaPendente = ""
+		jogo.StatusMsg = "Moeda coletada! Novas armadilhas foram posicionadas!"
+		return
+	case "no-such-coin", "not-on-coin":
+		jogo.ColetaPendente = ""
+		jogo.StatusMsg = "Outro jogador pegou a moeda"
+		return
+	case "room-full", "no-such-room":
+		jogo.StatusMsg = "Não foi possível entrar na sala: " + resp.Message
+		return
+	default:
+		return
+	}
+
+	x, y, ok := clientePrever(jogo, resp.X, resp.Y)
+	if !ok || (x == jogo.PosX && y == jogo.PosY) {
+		return
+	}
+	if !jogoPodeMoverPara(jogo, x, y) {
+		dbg.Printf("[CLIENT] posição do servidor (%d,%d) inválida no mapa local\n", x, y)
+		return
+	}
+	jogoMoverElemento(jogo, jogo.PosX, jogo.PosY, x-jogo.PosX, y-jogo.PosY)
+	jogo.PosX, jogo.PosY = x, y
+	jogo.StatusMsg = "Posição corrigida pelo servidor"
+}
+
+// clientePrever refaz os MOVE pendentes a partir da posição oficial (x, y),
+// com as mesmas regras de personagemMover. Devolve false se ainda há um
+// comando pendente que troca a posição no servidor (REGISTER, UPDATE_POS,
+// RESPAWN ou de sala): a resposta dele é que vale.
+func clientePrever(jogo *Jogo, x, y int) (int, int, bool) {
+	for _, p := range jogo.Pendentes {
+		switch p.Cmd {
+		case "MOVE":
+			if jogoPodeMoverPara(jogo, x+p.DX, y+p.DY) {
+				x, y = x+p.DX, y+p.DY
+			}
+		case "REGISTER", "UPDATE_POS", "RESPAWN", "CREATE_ROOM", "JOIN_ROOM":
+			return 0, 0, false
+		}
+	}
+	return x, y, true
+}
+
+// clienteEscolherSala decide em qual sala o jogador entra: a variável ROOM ou,
+// sem ela, o menu inicial com as salas do servidor. Uma sala que ainda não
+// existe é criada; como CREATE_ROOM exige sessão, o jogador é registrado no
+// lobby antes. Devolve o nome da sala e o arquivo de mapa dela.
+func clienteEscolherSala(tela Renderer, canalTeclado <-chan EventoTeclado) (string, string) {
+	nome := os.Getenv("ROOM")
+	if !rpcClient.Suporta(CapacidadeSalas) {
+		// servidor sem salas: todos jogam no lobby
+		h, _ := rpcClient.Servidor()
+		return SalaPadrao, h.Map
+	}
+	salas, err := rpcClient.ListRooms()
+	if err != nil {
+		dbg.Printf("[CLIENT] ListRooms erro: %v\n", err)
+		return nome, ""
+	}
+	mapaLobby := ""
+	for _, s := range salas {
+		if s.Name == SalaPadrao {
+			mapaLobby = s.Map
+		}
+	}
+
+	if nome == "" {
+		switch i := interfaceEscolherSala(tela, canalTeclado, salas); {
+		case i >= 0:
+			nome = salas[i].Name
+		case i == -1:
+			nome = "sala-" + LocalClientID
+			if len(nome) > 13 {
+				nome = nome[:13]
+			}
+		default:
+			nome = SalaPadrao
+		}
+	}
+	for _, s := range salas {
+		if s.Name == nome {
+			return nome, s.Map
+		}
+	}
+
+	if _, err := rpcClient.SendCommand("REGISTER", RegisterPayload{Name: LocalClientID}); err != nil {
+		dbg.Printf("[CLIENT] REGISTER erro: %v\n", err)
+		return SalaPadrao, mapaLobby
+	}
+	reply, err := rpcClient.SendCommand("CREATE_ROOM", RoomPayload{Name: nome})
+	if err != nil || !reply.Applied {
+		dbg.Printf("[CLIENT] não foi possível criar a sala %s: %v %s\n", nome, err, reply.Message)
+		return SalaPadrao, mapaLobby
+	}
+	return nome, mapaLobby
+}
+
+// clienteVerificarEntidades confere a posição do jogador contra as moedas e
+// armadilhas do servidor: pede a moeda com COLLECT (o servidor decide quem a
+// leva) e devolve true se o jogador pisou numa armadilha
+func clienteVerificarEntidades(jogo *Jogo) bool {
+	for _, e := range jogo.Entidades {
+		if e.X != jogo.PosX || e.Y != jogo.PosY {
+			continue
+		}
+		switch e.Kind {
+		case EntidadeArmadilha:
+			return true
+		case EntidadeMoeda:
+			if jogo.ColetaPendente != e.ID {
+				jogo.ColetaPendente = e.ID
+				clienteEnfileirar(jogo, "COLLECT", CollectPayload{ID: e.ID})
+			}
+		}
+	}
+	return false
+}
+
+// clienteAplicarEstado aplica um estado novo do servidor: outros jogadores,
+// monstros, moedas e armadilhas da sala e as moedas do jogador
+func clienteAplicarEstado(jogo *Jogo, st StateReply) {
+	jogo.Remotos.Adicionar(st, time.Now())
+	jogo.OtherPlayers = st.Players
+	jogo.Monstros = st.Monsters
+	jogo.Entidades = st.Entities
+	for _, p := range st.Players {
+		if p.ID == LocalClientID {
+			jogo.Pontos = p.Coins
+		}
+	}
+	jogo.StatusMsg = "Sala " + st.Room + " | Jogadores Online: " + strconv.Itoa(len(st.Players))
+}
+
+// clienteFimDeJogo mostra o motivo da morte, depois quantas moedas foram
+// coletadas, e espera o jogador pressionar uma tecla
+func clienteFimDeJogo(tela Renderer, jogo *Jogo, armadilhas []*Armadilha, moeda *Moeda, canalTeclado <-chan EventoTeclado, motivo string) {
+	jogo.StatusMsg = motivo
+	interfaceDesenharJogo(tela, jogo, armadilhas, moeda)
+	time.Sleep(2 * time.Second)
+
+	// Exibe quantas moedas foram coletadas
+	jogo.StatusMsg = "GAME OVER! Você coletou " + fmt.Sprintf("%d", jogo.Pontos) + " moedas antes de morrer. Pressione qualquer tecla para continuar..."
+	interfaceDesenharJogo(tela, jogo, armadilhas, moeda)
+
+	// Espera o jogador pressionar uma tecla para continuar
+	for ev := range canalTeclado {
+		if ev.Tipo != "redimensionar" {
+			break
+		}
+		interfaceDesenharJogo(tela, jogo, armadilhas, moeda)
+	}
+}
+
 // === B) util para gerar/persistir clientID ===
 func loadOrCreateClientID(path string) (string, error) {
 	if b, err := os.ReadFile(path); err == nil {
@@ -55,7 +276,7 @@ func loadOrCreateClientID(path string) (string, error) {
 	}
 	// gera novo
 	buf := make([]byte, 16)
-	if _, err := rand.Read(buf); err != nil {
+	if _, err := crand.Read(buf); err != nil {
 		return "", err
 	}
 	id := hex.EncodeToString(buf)
@@ -65,16 +286,29 @@ func loadOrCreateClientID(path string) (string, error) {
 	return id, nil
 }
 
+// ConfigCliente é o que o loop do cliente precisa saber da sessão
+type ConfigCliente struct {
+	Mapa     string    // arquivo de mapa
+	Sala     string    // sala pedida no REGISTER
+	Semente  int64     // semente da primeira rodada; as seguintes somam 1
+	Replay   *Replay   // teclas gravadas (nil joga pelo teclado)
+	Gravador *Gravador // grava as teclas (nil não grava)
+	WatchMS  int       // tempo máximo de cada WatchState
+	Aviso    string    // mensagem da barra de status no começo da primeira rodada
+}
+
 func main() {
 	// Inicializa a interface (termbox)
 	interfaceIniciar()
 	defer interfaceFinalizar()
+	tela := rendererTermbox{}
 
-	// Usa "mapa.txt" como arquivo padrão ou lê o primeiro argumento
+	// uma única goroutine lê o teclado durante toda a sessão
+	canalTeclado := make(chan EventoTeclado)
+	go interfaceLerEventoTeclado(tecladoTermbox{}, canalTeclado)
+
+	// Usa o mapa da sala (ou "mapa.txt") como arquivo padrão ou lê o primeiro argumento
 	mapaFile := "mapa.txt"
-	if len(os.Args) > 1 {
-		mapaFile = os.Args[1]
-	}
 
 	// === B) Configurar RPC client ===
 	// Suporta CLIENTID_FILE ou CLIENT_ID_FILE (fallback para compatibilidade)
@@ -105,161 +339,241 @@ func main() {
 		serverAddr = "127.0.0.1:12345"
 	}
 	
-	rpcClient = NewRPCClient(serverAddr, LocalClientID)
+	// REPLAY=<arquivo> repete uma partida gravada com RECORD; é sempre offline,
+	// porque só a simulação local é reproduzível
+	var replay *Replay
+	if nome := os.Getenv("REPLAY"); nome != "" {
+		if replay, err = lerReplay(nome); err != nil {
+			panic(err)
+		}
+		serverAddr = "none"
+	}
 
-	pollMS := 300
-	if v := os.Getenv("POLL_MS"); v != "" {
-		if n, convErr := strconv.Atoi(v); convErr == nil && n >= 50 {
-			pollMS = n
+	// RPC_ADDR=none joga offline, com monstro, moeda e armadilhas locais
+	sala, mapaSala := "", ""
+	if serverAddr != "none" {
+		rpcClient = NewRPCClient(serverAddr, LocalClientID)
+		// handshake antes de qualquer comando: com protocolo incompatível não
+		// há como jogar; com o servidor fora do ar segue como antes
+		if _, err := rpcClient.Hello(); errors.Is(err, ErrProtocoloIncompativel) {
+			interfaceFinalizar()
+			fmt.Fprintf(os.Stderr, "Não é possível jogar neste servidor (%s): %v\n", serverAddr, err)
+			os.Exit(1)
+		} else if err != nil {
+			dbg.Printf("[CLIENT] Hello erro: %v\n", err)
+		}
+		filaComandos = make(chan ComandoFila, 64)
+		respostasComandos = make(chan CommandReply, 64)
+		go rpcClient.ProcessarFila(filaComandos, respostasComandos)
+
+		// sala escolhida via ROOM ou pelo menu inicial
+		sala, mapaSala = clienteEscolherSala(tela, canalTeclado)
+	}
+	if len(os.Args) > 1 {
+		mapaFile = os.Args[1]
+	} else if replay != nil && replay.Mapa != "" {
+		mapaFile = replay.Mapa
+	} else if mapaSala != "" {
+		if _, gerado, _ := lerGeradorMapa(mapaSala); gerado {
+			// mapa gerado: o cliente gera a mesma grade a partir do nome
+			mapaFile = mapaSala
+		} else if _, err := os.Stat(mapaSala); err == nil {
+			mapaFile = mapaSala
+		} else {
+			dbg.Printf("[CLIENT] mapa %s da sala não encontrado, usando %s\n", mapaSala, mapaFile)
 		}
 	}
 
-	for {
-		canalMonstro := make(chan MonstroMsg)
-		canalArmadilha := make(chan ArmadilhaMsg)
-		canalMoeda := make(chan Moeda)
-		canalMoedaColetada := make(chan MoedaColetadaMsg)
-		canalTeclado := make(chan EventoTeclado)
-		done := make(chan struct{}) //canal pra cancelar routines antigas
+	// no lobby o mapa local tem de ser o do servidor, senão os movimentos
+	// aceitos aqui podem ser recusados lá
+	aviso := ""
+	if rpcClient != nil {
+		h, ok := rpcClient.Servidor()
+		if ok && h.MapChecksum != "" && (sala == "" || sala == SalaPadrao) {
+			if soma, err := checksumMapa(mapaFile); err == nil && soma != h.MapChecksum {
+				dbg.Printf("[CLIENT] mapa %s difere do mapa %s do servidor (checksum %s, servidor %s)\n", mapaFile, h.Map, soma, h.MapChecksum)
+				aviso = "Atenção: o mapa local difere do mapa do servidor"
+			}
+		}
+	}
 
-		// Inicializa o jogo
-		jogo := jogoNovo()
-		if err := jogoCarregarMapa(mapaFile, &jogo); err != nil {
-			panic(err)
+	// tipos de monstro extras para o modo offline (o servidor usa --monster-catalog)
+	if catalogo := os.Getenv("MONSTER_CATALOG"); catalogo != "" {
+		if err := carregarCatalogoMonstros(catalogo); err != nil {
+			dbg.Printf("[CLIENT] catálogo de monstros %s: %v\n", catalogo, err)
 		}
+	}
 
-		jogo.Pontos = -1
+	// semente dos sorteios da partida: SEED repete uma partida (ela aparece na
+	// barra de status); cada nova rodada usa a semente seguinte
+	semente := time.Now().UnixNano()
+	if v := os.Getenv("SEED"); v != "" {
+		if n, convErr := strconv.ParseInt(v, 10, 64); convErr == nil {
+			semente = n
+		} else {
+			dbg.Printf("[CLIENT] SEED inválida %q, usando %d\n", v, semente)
+		}
+	}
 
-		// === B) registrar e publicar posicao inicial ===
+	// RECORD=<arquivo> grava a semente e as teclas de cada rodada (ver replay.go).
+	// Só offline: online, monstros, moedas e posições vêm do servidor, e o
+	// replay (sempre offline) mostraria outra partida
+	var gravador *Gravador
+	if nome := os.Getenv("RECORD"); nome != "" && replay == nil {
 		if rpcClient != nil {
-			// usar tipos tipados para payloads RPC
-			reg := RegisterPayload{Name: LocalClientID, X: jogo.PosX, Y: jogo.PosY}
-			go func() { _, _ = rpcClient.SendCommand("REGISTER", reg) }()
+			dbg.Printf("[CLIENT] RECORD ignorado: só partidas offline (RPC_ADDR=none) são gravadas\n")
+			if aviso == "" {
+				aviso = "RECORD ignorado: só partidas offline são gravadas"
+			}
+		} else if gravador, err = novoGravador(nome, mapaFile); err != nil {
+			dbg.Printf("[CLIENT] não foi possível gravar o replay em %s: %v\n", nome, err)
+		} else {
+			defer gravador.Fechar()
+		}
+	}
+
+	// tempo máximo que cada WatchState fica pendurado no servidor
+	watchMS := 10000
+	if v := os.Getenv("WATCH_MS"); v != "" {
+		if n, convErr := strconv.Atoi(v); convErr == nil && n >= 50 {
+			watchMS = n
+		}
+	}
+
+	cfg := ConfigCliente{Mapa: mapaFile, Sala: sala, Semente: semente, Replay: replay, Gravador: gravador, WatchMS: watchMS, Aviso: aviso}
+	if err := clienteJogar(tela, canalTeclado, cfg); err != nil {
+		panic(err)
+	}
+}
+
+// clienteJogar roda as rodadas do jogo até o jogador sair (ou o replay
+// acabar). Desenha em tela e lê as teclas de canalTeclado, então roda igual
+// no terminal e sem ele (ver tela.go).
+func clienteJogar(tela Renderer, canalTeclado <-chan EventoTeclado, cfg ConfigCliente) error {
+	replay, gravador := cfg.Replay, cfg.Gravador
+	for rodada := int64(0); ; rodada++ {
+		done := make(chan struct{}) //canal pra cancelar routines antigas
 
-			up := UpdatePosPayload{X: jogo.PosX, Y: jogo.PosY, Lives: jogo.Pontos}
-			go func() { _, _ = rpcClient.SendCommand("UPDATE_POS", up) }()
+		// no replay, a semente e as teclas de cada rodada vêm do arquivo
+		sementeRodada := cfg.Semente + rodada
+		var gravadas *RodadaReplay
+		if replay != nil {
+			if rodada >= int64(len(replay.Rodadas)) {
+				return nil
+			}
+			gravadas = replay.Rodadas[rodada]
+			sementeRodada = gravadas.Semente
+		}
+
+		// Inicializa o jogo
+		jogo := jogoNovo(sementeRodada)
+		dbg.Printf("[CLIENT] rodada %d com semente %d\n", rodada+1, jogo.Semente)
+		if gravador != nil {
+			if err := gravador.Rodada(jogo.Semente); err != nil {
+				dbg.Printf("[CLIENT] erro gravando replay: %v\n", err)
+			}
+		}
+		if err := jogoCarregarMapa(cfg.Mapa, &jogo); err != nil {
+			return err
 		}
-		// polling getstate -> envia para stateChan (evitar datarace)
+		if rodada == 0 && cfg.Aviso != "" {
+			jogo.StatusMsg = cfg.Aviso
+		}
+
+		// === B) registrar ===
+		// passa pela fila para chegar ao servidor antes dos MOVEs; a posição
+		// inicial é a da resposta (ver clienteReconciliar)
+		clienteRegistrar(&jogo, rodada, cfg.Sala)
+		// long-poll WatchState -> envia para stateChan (evitar datarace)
 		stateChan := make(chan StateReply, 1)
-		go func(intervalMS int, stop <-chan struct{}) {
-			ticker := time.NewTicker(time.Duration(intervalMS) * time.Millisecond)
-			defer ticker.Stop()
+		go func(timeout time.Duration, stop <-chan struct{}) {
+			var versao int64
+			var salaAtual string
 			for {
 				select {
 				case <-stop:
 					return
-				case <-ticker.C:
-					if rpcClient == nil {
-						continue
-					}
-					st, err := rpcClient.GetState()
-					if err != nil {
-						dbg.Printf("[CLIENT] polling erro: %v\n", err)
-						continue
-					}
-					select {
-					case stateChan <- st:
-					default:
-					}
+				default:
+				}
+				if rpcClient == nil {
+					return
+				}
+				st, err := rpcClient.WatchState(versao, timeout)
+				if err != nil {
+					dbg.Printf("[CLIENT] WatchState erro: %v\n", err)
+					time.Sleep(time.Second)
+					continue
 				}
+				if st.Version == versao && st.Room == salaAtual {
+					continue // timeout sem mudanças
+				}
+				versao, salaAtual = st.Version, st.Room
+				// mantém apenas o estado mais recente no canal
+				select {
+				case <-stateChan:
+				default:
+				}
+				stateChan <- st
 			}
-		}(pollMS, done)
-
-		// Inicia a goroutine para ler eventos do teclado
-		go interfaceLerEventoTeclado(canalTeclado)
-
-		//cria o monstro
-		monstro := &Monstro{X: 69, Y: 15}
-		go monstroLoop(monstro, &jogo, canalMonstro, done)
-
-		//cria as armadilhas
-		armadilhas := []*Armadilha{
-			{X: 6, Y: 14, Ativa: true, ID: 1},
-			{X: 10, Y: 7, Ativa: true, ID: 1},
-			{X: 20, Y: 5, Ativa: true, ID: 1},
-			{X: 30, Y: 10, Ativa: true, ID: 1},
-			{X: 40, Y: 15, Ativa: true, ID: 1},
-			{X: 38, Y: 5, Ativa: true, ID: 1},
-			{X: 60, Y: 8, Ativa: true, ID: 1},
-			{X: 25, Y: 18, Ativa: true, ID: 1},
-			{X: 11, Y: 19, Ativa: true, ID: 1},
-			{X: 35, Y: 25, Ativa: true, ID: 1},
-			{X: 51, Y: 4, Ativa: true, ID: 1},
-			{X: 69, Y: 16, Ativa: true, ID: 1},
-			{X: 46, Y: 11, Ativa: true, ID: 1},
-			{X: 51, Y: 25, Ativa: true, ID: 1},
-			{X: 3, Y: 3, Ativa: true, ID: 1},
-			{X: 13, Y: 28, Ativa: true, ID: 1},
-			{X: 45, Y: 20, Ativa: true, ID: 1},
-			{X: 65, Y: 23, Ativa: true, ID: 1},
-			{X: 74, Y: 26, Ativa: true, ID: 1},
-			{X: 72, Y: 10, Ativa: true, ID: 10},
-		}
-		for _, a := range armadilhas {
-			go armadilhaLoop(a, &jogo, canalArmadilha, done)
-		}
+		}(time.Duration(cfg.WatchMS)*time.Millisecond, done)
 
-		moeda := &Moeda{X: 6, Y: 10}
-		go moedaLoop(moeda, &jogo, canalMoeda, canalMoedaColetada, done)
+		// monstros, armadilhas e moeda locais só no modo offline, nas posições
+		// marcadas no mapa; online eles são do servidor e chegam em StateReply
+		sim := novaSimulacao(&jogo, rpcClient == nil)
 
 		// Desenha o estado inicial do jogo
-		interfaceDesenharJogo(&jogo, armadilhas, moeda)
+		interfaceDesenharJogo(tela, &jogo, sim.Armadilhas, sim.Moeda)
 
-		//nova logica de jogo
+		// teclado e rede só enfileiram entradas; o estado do jogo muda apenas
+		// no passo da simulação, a cada tickSimulacao (ver simulacao.go)
+		ticker := time.NewTicker(tickSimulacao)
+		var entradas []Entrada
 		rodando := true
 		for rodando {
 			select {
-			case msg := <-canalMonstro:
-				jogo.MonstroX = msg.X
-				jogo.MonstroY = msg.Y
-				if msg.Encostou {
-					jogo.StatusMsg = "O MONSTRO TE PEGOU, VOCE MORREU"
-					interfaceDesenharJogo(&jogo, armadilhas, moeda)
-					time.Sleep(2 * time.Second)
-
-					// Exibe quantas moedas foram coletadas
-					jogo.StatusMsg = "GAME OVER! Você coletou " + fmt.Sprintf("%d", jogo.Pontos) + " moedas antes de morrer. Pressione qualquer tecla para continuar..."
-					interfaceDesenharJogo(&jogo, armadilhas, moeda)
-
-					// Espera o jogador pressionar uma tecla para continuar
-					<-canalTeclado
-					rodando = false
-				}
-			case <-canalArmadilha:
-				jogo.StatusMsg = "CAIU EM UMA ARMADILHA, VOCE MORREU"
-				interfaceDesenharJogo(&jogo, armadilhas, moeda)
-				time.Sleep(2 * time.Second)
-
-				// Exibe quantas moedas foram coletadas
-				jogo.StatusMsg = "GAME OVER! Você coletou " + fmt.Sprintf("%d", jogo.Pontos) + " moedas antes de morrer. Pressione qualquer tecla para continuar..."
-				interfaceDesenharJogo(&jogo, armadilhas, moeda)
-
-				// Espera o jogador pressionar uma tecla para continuar
-				<-canalTeclado
-				rodando = false
-			case novaMoeda := <-canalMoeda:
-				moeda.X = novaMoeda.X
-				moeda.Y = novaMoeda.Y
-			case msgMoedaColetada := <-canalMoedaColetada:
-				if msgMoedaColetada.Coletada {
-					// Feature de mudar a posi das armadilhas quando coletar moedas
-					moverTodasArmadilhas(armadilhas, &jogo)
-					jogo.StatusMsg = "Moeda coletada! Novas armadilhas foram posicionadas!"
-				}
 			case evento := <-canalTeclado:
-				if continuar := personagemExecutarAcao(evento, &jogo); !continuar {
-					return
+				if evento.Tipo == "redimensionar" {
+					// a câmera acompanha o tamanho novo já neste quadro; não é
+					// uma entrada da simulação nem vai para a gravação
+					interfaceDesenharJogo(tela, &jogo, sim.Armadilhas, sim.Moeda)
+					break
+				}
+				// no replay o teclado só serve para sair
+				if gravadas == nil || evento.Tipo == "sair" {
+					entradas = append(entradas, Entrada{Teclado: &evento})
 				}
+			// === B) respostas dos comandos enfileirados (posição oficial)
+			case resp := <-respostasComandos:
+				entradas = append(entradas, Entrada{Resposta: &resp})
 			// === B) consumo do polling
 			case st := <-stateChan:
-				jogo.OtherPlayers = st.Players
-				jogo.StatusMsg = "Jogadores Online: " + strconv.Itoa(len(st.Players))
-
-			case <-time.After(50 * time.Millisecond):
-				// para atualizar a tela periodicamente
-				interfaceDesenharJogo(&jogo, armadilhas, moeda)
+				entradas = append(entradas, Entrada{Estado: &st})
+			case <-ticker.C:
+				if gravadas != nil {
+					entradas = append(entradas, gravadas.entradas(sim.Tick+1)...)
+				}
+				if gravador != nil {
+					if err := gravador.Entradas(sim.Tick+1, entradas); err != nil {
+						dbg.Printf("[CLIENT] erro gravando replay: %v\n", err)
+					}
+				}
+				r := simularPasso(&jogo, sim, entradas)
+				entradas = entradas[:0]
+				if r.FimDeJogo != "" {
+					clienteFimDeJogo(tela, &jogo, sim.Armadilhas, sim.Moeda, canalTeclado, r.FimDeJogo)
+					rodando = false
+					break
+				}
+				// o último quadro é desenhado mesmo quando o jogador sai
+				interfaceDesenharJogo(tela, &jogo, sim.Armadilhas, sim.Moeda)
+				if r.Sair {
+					ticker.Stop()
+					close(done)
+					return nil
+				}
 			}
 		}
+		ticker.Stop()
 		close(done)
 	}
 }
@@ -0,0 +1,320 @@
+// mapa_formato.go - Formato dos arquivos de mapa, compartilhado por cliente e servidor
+//
+// Um arquivo de mapa pode começar com um cabeçalho de legenda, em que cada
+// linha começa com '@' e declara um símbolo:
+//
+//	@♠ parede cor=verde fundo=preto
+//	@~ elemento cor=azul tangivel=sim
+//	@P monstro comportamento=patrulhar
+//
+// Formato de uma entrada: @<símbolo> <tipo> [cor=<cor>] [fundo=<cor>] [tangivel=sim|nao].
+// Entradas de monstro aceitam também tipo=<nome do catálogo> e os atributos de
+// catalogo_monstros.go (passo, comportamento, paredes, visao, rota, simbolo).
+// Tipos de célula: vazio, parede, vegetacao, elemento (decoração com a cor e a
+// tangibilidade da legenda). Marcadores de spawn: inicio, monstro, armadilha,
+// moeda. Um marcador vira uma célula vazia e a posição entra na lista
+// correspondente de MapaArquivo. Pode haver vários inícios de jogador.
+//
+// Palavras com mais de um caractere no lugar do símbolo são opções do mapa:
+//
+//	@neblina 6
+//
+// liga a neblina (ver visao.go) com o personagem enxergando 6 células; sem
+// essa linha o mapa inteiro fica sempre visível.
+//
+// A primeira linha que não começa com '@' inicia a grade. Símbolos sem
+// entrada na legenda são células vazias. A legenda padrão mantém os símbolos
+// antigos (▤ ♣ ☺) e acrescenta Δ, $ e o símbolo de cada monstro do catálogo
+// (☠ é o perseguidor), então mapas sem cabeçalho continuam válidos.
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Tipos de entrada da legenda
+const (
+	TipoVazio     = "vazio"
+	TipoParede    = "parede"
+	TipoVegetacao = "vegetacao"
+	TipoElemento  = "elemento"
+	TipoInicio    = "inicio"
+	TipoMonstro   = "monstro"
+	TipoArmadilha = "armadilha"
+	TipoMoeda     = "moeda"
+)
+
+// EntradaLegenda descreve o que um símbolo do mapa representa. Cor e Fundo são
+// nomes ("verde", "cinza", ...) convertidos em cores pelo cliente; vazios usam
+// a cor padrão do tipo.
+type EntradaLegenda struct {
+	Simbolo  rune
+	Tipo     string
+	Cor      string
+	Fundo    string
+	Tangivel bool
+	// Monstro é o tipo dos monstros nascidos neste marcador
+	Monstro EspecieMonstro
+}
+
+// PosicaoMapa é uma coordenada da grade
+type PosicaoMapa struct {
+	X, Y int
+}
+
+// MarcadorMonstro é a posição onde nasce um monstro e o tipo dele
+type MarcadorMonstro struct {
+	PosicaoMapa
+	Especie EspecieMonstro
+}
+
+// MapaArquivo é o resultado da leitura de um arquivo de mapa
+type MapaArquivo struct {
+	Legenda map[rune]EntradaLegenda
+	// Celulas tem a entrada da legenda de cada célula; marcadores de spawn e
+	// símbolos desconhecidos aparecem como vazio
+	Celulas [][]EntradaLegenda
+
+	Inicios    []PosicaoMapa
+	Monstros   []MarcadorMonstro
+	Armadilhas []PosicaoMapa
+	Moedas     []PosicaoMapa
+
+	// Neblina é o alcance da visão do personagem (opção @neblina); 0 deixa o
+	// mapa todo visível
+	Neblina int
+}
+
+// legendaPadrao é usada para os símbolos não redefinidos no cabeçalho
+func legendaPadrao() map[rune]EntradaLegenda {
+	entradas := []EntradaLegenda{
+		{Simbolo: ' ', Tipo: TipoVazio},
+		{Simbolo: simboloParede, Tipo: TipoParede, Tangivel: true},
+		{Simbolo: '♣', Tipo: TipoVegetacao},
+		{Simbolo: simboloPersonagem, Tipo: TipoInicio},
+		{Simbolo: 'Δ', Tipo: TipoArmadilha},
+		{Simbolo: '$', Tipo: TipoMoeda},
+	}
+	for _, especie := range especiesOrdenadas() {
+		entradas = append(entradas, EntradaLegenda{Simbolo: especie.Simbolo, Tipo: TipoMonstro, Monstro: especie})
+	}
+	legenda := make(map[rune]EntradaLegenda, len(entradas))
+	for _, e := range entradas {
+		legenda[e.Simbolo] = e
+	}
+	return legenda
+}
+
+// lerMapaArquivo lê e interpreta um arquivo de mapa. Nomes "gerar:..." são
+// mapas gerados (ver mapa_gerador.go) e não são lidos do disco.
+func lerMapaArquivo(nome string) (*MapaArquivo, error) {
+	if g, gerado, err := lerGeradorMapa(nome); gerado {
+		if err != nil {
+			return nil, err
+		}
+		return lerMapa(nome, strings.NewReader(strings.Join(g.Linhas(), "\n")))
+	}
+	arq, err := os.Open(nome)
+	if err != nil {
+		return nil, err
+	}
+	defer arq.Close()
+	return lerMapa(nome, arq)
+}
+
+// checksumMapa devolve o sha256 (hex) do texto do mapa nome. Um mapa gerado
+// tem o checksum do arquivo que --export-map gravaria para ele, então os dois
+// lados de uma partida podem conferir que carregaram a mesma grade.
+func checksumMapa(nome string) (string, error) {
+	var dados []byte
+	if g, gerado, err := lerGeradorMapa(nome); gerado {
+		if err != nil {
+			return "", err
+		}
+		dados = []byte(strings.Join(g.Linhas(), "\n") + "\n")
+	} else if dados, err = os.ReadFile(nome); err != nil {
+		return "", err
+	}
+	soma := sha256.Sum256(dados)
+	return hex.EncodeToString(soma[:]), nil
+}
+
+// lerMapa interpreta o texto de um mapa; nome só aparece nos erros
+func lerMapa(nome string, r io.Reader) (*MapaArquivo, error) {
+	m := &MapaArquivo{Legenda: legendaPadrao()}
+	scanner := bufio.NewScanner(r)
+	cabecalho := true
+	numLinha := 0
+	for scanner.Scan() {
+		linha := scanner.Text()
+		numLinha++
+		if cabecalho && strings.HasPrefix(linha, "@") {
+			if opcao, err := m.lerOpcao(linha[1:]); opcao || err != nil {
+				if err != nil {
+					return nil, fmt.Errorf("%s:%d: %v", nome, numLinha, err)
+				}
+				continue
+			}
+			e, err := lerEntradaLegenda(linha[1:])
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %v", nome, numLinha, err)
+			}
+			m.Legenda[e.Simbolo] = e
+			continue
+		}
+		cabecalho = false
+		m.adicionarLinha([]rune(linha))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// adicionarLinha interpreta uma linha da grade
+func (m *MapaArquivo) adicionarLinha(linha []rune) {
+	y := len(m.Celulas)
+	celulas := make([]EntradaLegenda, len(linha))
+	for x, ch := range linha {
+		e, ok := m.Legenda[ch]
+		if !ok {
+			e = EntradaLegenda{Simbolo: ' ', Tipo: TipoVazio}
+		}
+		p := PosicaoMapa{X: x, Y: y}
+		switch e.Tipo {
+		case TipoInicio:
+			m.Inicios = append(m.Inicios, p)
+		case TipoMonstro:
+			m.Monstros = append(m.Monstros, MarcadorMonstro{PosicaoMapa: p, Especie: e.Monstro})
+		case TipoArmadilha:
+			m.Armadilhas = append(m.Armadilhas, p)
+		case TipoMoeda:
+			m.Moedas = append(m.Moedas, p)
+		}
+		if marcador(e.Tipo) {
+			e = EntradaLegenda{Simbolo: ' ', Tipo: TipoVazio}
+		}
+		celulas[x] = e
+	}
+	m.Celulas = append(m.Celulas, celulas)
+}
+
+// lerOpcao trata uma linha de opção do cabeçalho ("neblina <alcance>").
+// Devolve false quando a linha é uma entrada da legenda.
+func (m *MapaArquivo) lerOpcao(texto string) (bool, error) {
+	campos := strings.Fields(texto)
+	if len(campos) == 0 || len([]rune(campos[0])) == 1 {
+		return false, nil
+	}
+	switch campos[0] {
+	case "neblina":
+		if len(campos) != 2 {
+			return true, fmt.Errorf("neblina needs a sight range")
+		}
+		alcance, err := strconv.Atoi(campos[1])
+		if err != nil || alcance < 0 {
+			return true, fmt.Errorf("bad neblina range %q", campos[1])
+		}
+		m.Neblina = alcance
+		return true, nil
+	}
+	return true, fmt.Errorf("unknown map option %q", campos[0])
+}
+
+// lerEntradaLegenda interpreta "<símbolo> <tipo> [chave=valor ...]"
+func lerEntradaLegenda(texto string) (EntradaLegenda, error) {
+	var e EntradaLegenda
+	campos := strings.Fields(texto)
+	if len(campos) < 2 {
+		return e, fmt.Errorf("legend entry needs a symbol and a type: %q", texto)
+	}
+	simbolo := []rune(campos[0])
+	if len(simbolo) != 1 {
+		return e, fmt.Errorf("legend symbol must be a single character: %q", campos[0])
+	}
+	e.Simbolo = simbolo[0]
+	e.Tipo = campos[1]
+	switch e.Tipo {
+	case TipoVazio, TipoVegetacao, TipoElemento:
+	case TipoParede:
+		e.Tangivel = true
+	case TipoInicio, TipoMonstro, TipoArmadilha, TipoMoeda:
+	default:
+		return e, fmt.Errorf("unknown legend type %q", e.Tipo)
+	}
+	if e.Tipo == TipoMonstro {
+		e.Monstro = especiePadrao()
+		e.Monstro.Simbolo = e.Simbolo
+	}
+	// tipo= vem antes dos outros atributos, que o ajustam
+	atributos := campos[2:]
+	sort.SliceStable(atributos, func(i, j int) bool {
+		return strings.HasPrefix(atributos[i], "tipo=") && !strings.HasPrefix(atributos[j], "tipo=")
+	})
+	for _, kv := range atributos {
+		chave, valor, ok := strings.Cut(kv, "=")
+		if !ok {
+			return e, fmt.Errorf("bad legend attribute %q", kv)
+		}
+		if e.Tipo == TipoMonstro {
+			if err := e.aplicarAtributoMonstro(chave, valor); err != nil {
+				return e, err
+			}
+			continue
+		}
+		switch chave {
+		case "cor":
+			e.Cor = valor
+		case "fundo":
+			e.Fundo = valor
+		case "tangivel":
+			switch valor {
+			case "sim", "true":
+				e.Tangivel = true
+			case "nao", "não", "false":
+				e.Tangivel = false
+			default:
+				return e, fmt.Errorf("bad tangivel value %q", valor)
+			}
+		default:
+			return e, fmt.Errorf("unknown legend attribute %q", chave)
+		}
+	}
+	return e, nil
+}
+
+// aplicarAtributoMonstro trata um atributo de uma entrada de monstro. tipo=
+// troca a base pelo tipo do catálogo, mantendo o símbolo do marcador.
+func (e *EntradaLegenda) aplicarAtributoMonstro(chave, valor string) error {
+	if chave == "tipo" {
+		especie, ok := especieMonstro(valor)
+		if !ok {
+			return fmt.Errorf("unknown monster type %q", valor)
+		}
+		especie.Simbolo = e.Monstro.Simbolo
+		e.Monstro = especie
+		return nil
+	}
+	tratado, err := e.Monstro.aplicarAtributo(chave, valor)
+	if err == nil && !tratado {
+		err = fmt.Errorf("unknown monster attribute %q", chave)
+	}
+	return err
+}
+
+// marcador indica se o tipo é um marcador de spawn (não ocupa a célula)
+func marcador(tipo string) bool {
+	switch tipo {
+	case TipoInicio, TipoMonstro, TipoArmadilha, TipoMoeda:
+		return true
+	}
+	return false
+}
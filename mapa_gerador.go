@@ -0,0 +1,266 @@
+// mapa_gerador.go - Mapas gerados a partir de uma semente
+//
+// No lugar do nome de um arquivo de mapa (argumento do cliente, --map do
+// servidor, mapa de uma sala) pode vir a descrição de um mapa gerado:
+//
+//	gerar:labirinto:41x21:7
+//	gerar:masmorra:80x30:123
+//
+// Formato: gerar:<tipo>:<largura>x<altura>[:<semente>], semente 1 quando
+// omitida. O mesmo texto gera sempre a mesma grade, então cliente e servidor
+// chegam ao mesmo mapa sem trocar arquivos. labirinto é um labirinto perfeito
+// (backtracker recursivo; largura e altura pares perdem uma coluna/linha) e
+// masmorra são salas retangulares ligadas por corredores. Os dois tipos são
+// conexos, e mesmo assim inícios, moedas, armadilhas e monstros só são postos
+// em células alcançáveis a partir do primeiro início. O resultado é texto no
+// formato de mapa_formato.go e pode ser gravado num arquivo (--export-map no
+// servidor).
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Tipos de mapa gerado
+const (
+	GeradoLabirinto = "labirinto"
+	GeradoMasmorra  = "masmorra"
+)
+
+const (
+	prefixoMapaGerado = "gerar:"
+	minLadoGerado     = 5   // menor largura/altura de um mapa gerado
+	maxLadoGerado     = 500 // maior largura/altura de um mapa gerado
+	iniciosGerados    = 4   // inícios de jogador por mapa gerado
+	tentativasSala    = 200 // salas sorteadas (as que se sobrepõem são descartadas)
+)
+
+// GeradorMapa descreve um mapa gerado
+type GeradorMapa struct {
+	Tipo            string
+	Largura, Altura int
+	Semente         int64
+}
+
+// lerGeradorMapa interpreta "gerar:<tipo>:<largura>x<altura>[:<semente>]".
+// gerado é false quando o nome é de um arquivo comum.
+func lerGeradorMapa(nome string) (g GeradorMapa, gerado bool, err error) {
+	if !strings.HasPrefix(nome, prefixoMapaGerado) {
+		return g, false, nil
+	}
+	campos := strings.Split(strings.TrimPrefix(nome, prefixoMapaGerado), ":")
+	if len(campos) < 2 || len(campos) > 3 {
+		return g, true, fmt.Errorf("generated map must be gerar:<tipo>:<largura>x<altura>[:<semente>], got %q", nome)
+	}
+	g.Tipo = campos[0]
+	if g.Tipo != GeradoLabirinto && g.Tipo != GeradoMasmorra {
+		return g, true, fmt.Errorf("unknown generated map type %q", g.Tipo)
+	}
+	l, a, ok := strings.Cut(campos[1], "x")
+	if g.Largura, err = strconv.Atoi(l); ok && err == nil {
+		g.Altura, err = strconv.Atoi(a)
+	}
+	if !ok || err != nil {
+		return g, true, fmt.Errorf("bad generated map size %q", campos[1])
+	}
+	if g.Largura < minLadoGerado || g.Altura < minLadoGerado || g.Largura > maxLadoGerado || g.Altura > maxLadoGerado {
+		return g, true, fmt.Errorf("generated map size must be between %d and %d, got %dx%d", minLadoGerado, maxLadoGerado, g.Largura, g.Altura)
+	}
+	g.Semente = 1
+	if len(campos) == 3 {
+		if g.Semente, err = strconv.ParseInt(campos[2], 10, 64); err != nil {
+			return g, true, fmt.Errorf("bad generated map seed %q", campos[2])
+		}
+	}
+	return g, true, nil
+}
+
+// Linhas gera o mapa e devolve as linhas da grade no formato de arquivo
+func (g GeradorMapa) Linhas() []string {
+	r := rand.New(rand.NewSource(g.Semente))
+	grade := make(gradeRunas, g.Altura)
+	for y := range grade {
+		grade[y] = []rune(strings.Repeat(string(simboloParede), g.Largura))
+	}
+	switch g.Tipo {
+	case GeradoLabirinto:
+		gerarLabirinto(grade, r)
+	case GeradoMasmorra:
+		gerarMasmorra(grade, r)
+	}
+	posicionarMarcadores(grade, r)
+
+	linhas := make([]string, len(grade))
+	for y, l := range grade {
+		linhas[y] = string(l)
+	}
+	return linhas
+}
+
+// exportarMapa grava o mapa gerado descrito por nome no arquivo destino
+func exportarMapa(nome, destino string) error {
+	g, gerado, err := lerGeradorMapa(nome)
+	if err != nil {
+		return err
+	}
+	if !gerado {
+		return fmt.Errorf("%s is not a generated map", nome)
+	}
+	return os.WriteFile(destino, []byte(strings.Join(g.Linhas(), "\n")+"\n"), 0644)
+}
+
+// gradeRunas é a grade de um mapa sendo gerado, vista como Grade para a busca
+type gradeRunas [][]rune
+
+func (g gradeRunas) Dentro(x, y int) bool {
+	return y >= 0 && y < len(g) && x >= 0 && x < len(g[y])
+}
+
+func (g gradeRunas) PodeMoverPara(x, y int) bool {
+	return g.Dentro(x, y) && g[y][x] != simboloParede
+}
+
+// gerarLabirinto cava um labirinto perfeito nas células de coordenadas
+// ímpares, sem mexer na borda de paredes
+func gerarLabirinto(grade gradeRunas, r *rand.Rand) {
+	// a última coluna/linha fica como parede quando o lado é par
+	largura, altura := len(grade[0])-1+len(grade[0])%2, len(grade)-1+len(grade)%2
+	grade[1][1] = ' '
+	pilha := []PosicaoMapa{{X: 1, Y: 1}}
+	for len(pilha) > 0 {
+		atual := pilha[len(pilha)-1]
+		var vizinhos []PosicaoMapa
+		for _, d := range direcoesGrade {
+			v := PosicaoMapa{X: atual.X + 2*d.X, Y: atual.Y + 2*d.Y}
+			if v.X > 0 && v.X < largura-1 && v.Y > 0 && v.Y < altura-1 && grade[v.Y][v.X] == simboloParede {
+				vizinhos = append(vizinhos, v)
+			}
+		}
+		if len(vizinhos) == 0 {
+			pilha = pilha[:len(pilha)-1]
+			continue
+		}
+		v := vizinhos[r.Intn(len(vizinhos))]
+		grade[(atual.Y+v.Y)/2][(atual.X+v.X)/2] = ' '
+		grade[v.Y][v.X] = ' '
+		pilha = append(pilha, v)
+	}
+}
+
+// salaMasmorra é um retângulo de células livres de uma masmorra
+type salaMasmorra struct {
+	x, y, largura, altura int
+}
+
+func (s salaMasmorra) centro() PosicaoMapa {
+	return PosicaoMapa{X: s.x + s.largura/2, Y: s.y + s.altura/2}
+}
+
+// sobrepoe indica se as salas se tocam, contando uma parede de margem
+func (s salaMasmorra) sobrepoe(o salaMasmorra) bool {
+	return s.x <= o.x+o.largura && o.x <= s.x+s.largura && s.y <= o.y+o.altura && o.y <= s.y+s.altura
+}
+
+// gerarMasmorra sorteia salas sem sobreposição e liga cada uma à anterior
+// com um corredor em L
+func gerarMasmorra(grade gradeRunas, r *rand.Rand) {
+	largura, altura := len(grade[0]), len(grade)
+	var salas []salaMasmorra
+	for i := 0; i < tentativasSala; i++ {
+		s := salaMasmorra{largura: min(4+r.Intn(7), largura-2), altura: min(3+r.Intn(4), altura-2)}
+		s.x = 1 + r.Intn(largura-1-s.largura)
+		s.y = 1 + r.Intn(altura-1-s.altura)
+		livre := true
+		for _, o := range salas {
+			if s.sobrepoe(o) {
+				livre = false
+				break
+			}
+		}
+		if !livre {
+			continue
+		}
+		for y := s.y; y < s.y+s.altura; y++ {
+			for x := s.x; x < s.x+s.largura; x++ {
+				grade[y][x] = ' '
+			}
+		}
+		if len(salas) > 0 {
+			cavarCorredor(grade, salas[len(salas)-1].centro(), s.centro(), r.Intn(2) == 0)
+		}
+		salas = append(salas, s)
+	}
+}
+
+// cavarCorredor abre um corredor de a até b, primeiro na horizontal ou
+// primeiro na vertical
+func cavarCorredor(grade gradeRunas, a, b PosicaoMapa, horizontalPrimeiro bool) {
+	canto := PosicaoMapa{X: b.X, Y: a.Y}
+	if !horizontalPrimeiro {
+		canto = PosicaoMapa{X: a.X, Y: b.Y}
+	}
+	for _, trecho := range [2][2]PosicaoMapa{{a, canto}, {canto, b}} {
+		de, ate := trecho[0], trecho[1]
+		for x := min(de.X, ate.X); x <= max(de.X, ate.X); x++ {
+			grade[de.Y][x] = ' '
+		}
+		for y := min(de.Y, ate.Y); y <= max(de.Y, ate.Y); y++ {
+			grade[y][de.X] = ' '
+		}
+	}
+}
+
+// posicionarMarcadores escolhe o primeiro início entre as células livres e
+// põe os demais marcadores só nas alcançáveis a partir dele: inícios perto
+// dele, moedas e armadilhas fora da vizinhança imediata e monstros na metade
+// mais distante. Mapas pequenos recebem menos inícios.
+func posicionarMarcadores(grade gradeRunas, r *rand.Rand) {
+	var livres []PosicaoMapa
+	for y, linha := range grade {
+		for x, ch := range linha {
+			if ch == ' ' {
+				livres = append(livres, PosicaoMapa{X: x, Y: y})
+			}
+		}
+	}
+	if len(livres) == 0 {
+		return
+	}
+	inicio := livres[r.Intn(len(livres))]
+	// em ordem de distância do início
+	celulas := append([]PosicaoMapa{inicio}, alcancaveis(grade, inicio, len(livres))...)
+	n := len(celulas)
+
+	especies := make([]EspecieMonstro, 0, len(catalogoPadrao()))
+	for _, e := range catalogoPadrao() {
+		especies = append(especies, e)
+	}
+	sort.Slice(especies, func(i, j int) bool { return especies[i].Nome < especies[j].Nome })
+
+	grade[inicio.Y][inicio.X] = simboloPersonagem
+	longe := min(n/2, 10)
+	sortearMarcadores(grade, r, celulas[:min(n, 20)], min(iniciosGerados-1, n/8), func() rune { return simboloPersonagem })
+	sortearMarcadores(grade, r, celulas[longe:], max(1, n/150), func() rune { return '$' })
+	sortearMarcadores(grade, r, celulas[n/2:], max(1, n/150), func() rune { return especies[r.Intn(len(especies))].Simbolo })
+	sortearMarcadores(grade, r, celulas[longe:], n/40, func() rune { return 'Δ' })
+}
+
+// sortearMarcadores põe até quantos marcadores em células ainda vazias de
+// candidatas, sorteadas em ordem
+func sortearMarcadores(grade gradeRunas, r *rand.Rand, candidatas []PosicaoMapa, quantos int, simbolo func() rune) {
+	for _, i := range r.Perm(len(candidatas)) {
+		if quantos <= 0 {
+			return
+		}
+		p := candidatas[i]
+		if grade[p.Y][p.X] == ' ' {
+			grade[p.Y][p.X] = simbolo()
+			quantos--
+		}
+	}
+}
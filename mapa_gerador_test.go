@@ -0,0 +1,82 @@
+package main
+
+import (
+    "path/filepath"
+    "reflect"
+    "testing"
+)
+
+// TestMapaGeradoAlcancavel gera labirintos e masmorras de várias sementes e
+// confere que todos os marcadores são alcançáveis a partir do primeiro início
+func TestMapaGeradoAlcancavel(t *testing.T) {
+    for _, nome := range []string{
+        "gerar:labirinto:41x21:1", "gerar:labirinto:40x20:2", "gerar:labirinto:5x5:3",
+        "gerar:masmorra:80x30:1", "gerar:masmorra:30x12:2", "gerar:masmorra:5x5:3",
+    } {
+        m, err := carregarMapaServidor(nome)
+        if err != nil {
+            t.Fatalf("%s: %v", nome, err)
+        }
+        if len(m.Inicios) == 0 || len(m.Moedas) == 0 || len(m.Monstros) == 0 {
+            t.Fatalf("%s: missing markers (inicios=%d moedas=%d monstros=%d)", nome, len(m.Inicios), len(m.Moedas), len(m.Monstros))
+        }
+        inicio := m.Inicios[0]
+        alcance := map[PosicaoMapa]bool{inicio: true}
+        for _, p := range alcancaveis(m, inicio, 1<<20) {
+            alcance[p] = true
+        }
+        marcadores := append(append(append([]PosicaoMapa{}, m.Inicios...), m.Moedas...), m.Armadilhas...)
+        for _, mm := range m.Monstros {
+            marcadores = append(marcadores, mm.PosicaoMapa)
+        }
+        for _, p := range marcadores {
+            if !alcance[p] {
+                t.Fatalf("%s: marker at %v is not reachable from %v", nome, p, inicio)
+            }
+        }
+    }
+}
+
+// TestMapaGeradoReproduzivel verifica que o mesmo nome gera o mesmo mapa, que
+// outra semente muda o mapa e que o mapa exportado é lido igual
+func TestMapaGeradoReproduzivel(t *testing.T) {
+    a, err := lerMapaArquivo("gerar:masmorra:50x20:9")
+    if err != nil {
+        t.Fatalf("lerMapaArquivo error: %v", err)
+    }
+    b, _ := lerMapaArquivo("gerar:masmorra:50x20:9")
+    c, _ := lerMapaArquivo("gerar:masmorra:50x20:10")
+    if !reflect.DeepEqual(a, b) {
+        t.Fatalf("same name generated different maps")
+    }
+    if reflect.DeepEqual(a.Celulas, c.Celulas) {
+        t.Fatalf("different seeds generated the same map")
+    }
+    if len(a.Celulas) != 20 || len(a.Celulas[0]) != 50 {
+        t.Fatalf("unexpected size %dx%d", len(a.Celulas[0]), len(a.Celulas))
+    }
+
+    path := filepath.Join(t.TempDir(), "masmorra.txt")
+    if err := exportarMapa("gerar:masmorra:50x20:9", path); err != nil {
+        t.Fatalf("exportarMapa error: %v", err)
+    }
+    d, err := lerMapaArquivo(path)
+    if err != nil {
+        t.Fatalf("reading exported map: %v", err)
+    }
+    if !reflect.DeepEqual(a, d) {
+        t.Fatalf("exported map differs from the generated one")
+    }
+}
+
+// TestMapaGeradoInvalido verifica os erros de nomes de mapa gerado mal formados
+func TestMapaGeradoInvalido(t *testing.T) {
+    for _, nome := range []string{
+        "gerar:caverna:40x20", "gerar:labirinto", "gerar:labirinto:40", "gerar:labirinto:3x3",
+        "gerar:masmorra:40x20:abc", "gerar:masmorra:40x20:1:2",
+    } {
+        if _, err := lerMapaArquivo(nome); err == nil {
+            t.Fatalf("%s: expected an error", nome)
+        }
+    }
+}
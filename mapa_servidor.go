@@ -0,0 +1,79 @@
+// mapa_servidor.go - Mapa carregado pelo servidor para validar movimentos
+package main
+
+// Símbolos da legenda padrão do formato de mapa (ver mapa_formato.go)
+const (
+	simboloParede     = '▤'
+	simboloPersonagem = '☺'
+)
+
+// MapaServidor guarda apenas o que o servidor precisa saber do mapa:
+// quais células bloqueiam passagem e as posições marcadas no arquivo
+type MapaServidor struct {
+	Nome             string
+	tangivel         [][]bool // true se a célula bloqueia passagem
+	InicioX, InicioY int      // primeiro início de jogador marcado no arquivo
+
+	Inicios    []PosicaoMapa     // todos os inícios de jogador
+	Monstros   []MarcadorMonstro // marcadores de monstro
+	Armadilhas []PosicaoMapa     // marcadores de armadilha
+	Moedas     []PosicaoMapa     // marcadores de moeda
+}
+
+// Lê o mapa no mesmo formato de jogoCarregarMapa
+func carregarMapaServidor(nome string) (*MapaServidor, error) {
+	arq, err := lerMapaArquivo(nome)
+	if err != nil {
+		return nil, err
+	}
+	m := &MapaServidor{
+		Nome:       nome,
+		Inicios:    arq.Inicios,
+		Monstros:   arq.Monstros,
+		Armadilhas: arq.Armadilhas,
+		Moedas:     arq.Moedas,
+	}
+	if len(arq.Inicios) > 0 {
+		m.InicioX, m.InicioY = arq.Inicios[0].X, arq.Inicios[0].Y
+	}
+	for _, celulas := range arq.Celulas {
+		linha := make([]bool, len(celulas))
+		for x, c := range celulas {
+			linha[x] = c.Tangivel
+		}
+		m.tangivel = append(m.tangivel, linha)
+	}
+	return m, nil
+}
+
+// PodeMoverPara aplica as mesmas regras de jogoPodeMoverPara: dentro dos limites
+// e sem elemento tangível no destino
+func (m *MapaServidor) PodeMoverPara(x, y int) bool {
+	if y < 0 || y >= len(m.tangivel) {
+		return false
+	}
+	if x < 0 || x >= len(m.tangivel[y]) {
+		return false
+	}
+	return !m.tangivel[y][x]
+}
+
+// Dentro indica se (x, y) está dentro dos limites do mapa
+func (m *MapaServidor) Dentro(x, y int) bool {
+	return y >= 0 && y < len(m.tangivel) && x >= 0 && x < len(m.tangivel[y])
+}
+
+// direcaoDelta converte a direção de um MovePayload em deslocamento
+func direcaoDelta(dir string) (dx, dy int, ok bool) {
+	switch dir {
+	case DirCima:
+		return 0, -1, true
+	case DirBaixo:
+		return 0, 1, true
+	case DirEsquerda:
+		return -1, 0, true
+	case DirDireita:
+		return 1, 0, true
+	}
+	return 0, 0, false
+}
@@ -4,6 +4,35 @@
 // moeda.go -> funcoes para a moeda
 package main
 
+import "math/rand"
+
 type Moeda struct {
 	X, Y int
 }
+
+// verifica se o player está em cima da moeda
+func moedaColetada(moeda *Moeda, jogo *Jogo) bool {
+	return moeda.X == jogo.PosX && moeda.Y == jogo.PosY
+}
+
+// sorteia uma nova posição livre para a moeda, fora da posição do player.
+// Sem lugar depois de algumas tentativas a moeda sai do mapa (-1, -1) até o
+// próximo sorteio, para o tick nunca ficar preso num mapa sem célula livre
+func moedaReposicionar(moeda *Moeda, jogo *Jogo, r *rand.Rand) {
+	moeda.X, moeda.Y = -1, -1
+	if len(jogo.Mapa) == 0 {
+		return
+	}
+	for tentativas := 0; tentativas < 50; tentativas++ {
+		ny := r.Intn(len(jogo.Mapa))
+		if len(jogo.Mapa[ny]) == 0 {
+			continue
+		}
+		nx := r.Intn(len(jogo.Mapa[ny])) // linhas podem ter larguras diferentes
+		if jogoPodeMoverPara(jogo, nx, ny) && (nx != jogo.PosX || ny != jogo.PosY) {
+			moeda.X = nx
+			moeda.Y = ny
+			return
+		}
+	}
+}
@@ -4,27 +4,75 @@
 // monstro.go -> funcoes para a movimentacao e etc do monstro
 package main
 
+import (
+	"math/rand"
+	"strconv"
+	"time"
+)
+
 // estrutura que representa o monstro no jogo
 type Monstro struct {
-	X, Y int //posicao do bicho
+	ID      int //indice do monstro (um por marcador do mapa)
+	X, Y    int //posicao do bicho
+	especie EspecieMonstro
+	nav     *Navegador
+	espera  time.Duration //tempo acumulado desde o último passo
+}
+
+// cria o monstro de um marcador do mapa, com o tipo do marcador
+func monstroNovo(id int, marcador MarcadorMonstro, rng *rand.Rand) *Monstro {
+	return &Monstro{ID: id, X: marcador.X, Y: marcador.Y, especie: marcador.Especie, nav: novoNavegador(marcador.Especie, rng)}
+}
+
+// informações do monstro para desenhar (o mesmo formato dos monstros do servidor)
+func monstroInfo(monstro *Monstro) MonsterInfo {
+	return MonsterInfo{
+		ID:     "local" + strconv.Itoa(monstro.ID+1),
+		X:      monstro.X,
+		Y:      monstro.Y,
+		Kind:   monstro.especie.Nome,
+		Symbol: string(monstro.especie.Simbolo),
+		Color:  monstro.especie.Cor,
+	}
+}
+
+// gradeJogo deixa a busca de caminhos usar as regras de jogoPodeMoverPara
+type gradeJogo struct{ jogo *Jogo }
+
+func (g gradeJogo) PodeMoverPara(x, y int) bool {
+	return jogoPodeMoverPara(g.jogo, x, y)
 }
 
-// move o monstro em direcao ao player
-func monstroMover(monstro *Monstro, alvoX, alvoY int, jogo *Jogo) {
+func (g gradeJogo) Dentro(x, y int) bool {
+	return y >= 0 && y < len(g.jogo.Mapa) && x >= 0 && x < len(g.jogo.Mapa[y])
+}
 
-	dx, dy := 0, 0
-	if monstro.X < alvoX {
-		dx = 1
-	} else if monstro.X > alvoX {
-		dx = -1
+// move o monstro um passo em direção ao player conforme o tipo dele
+func monstroMover(monstro *Monstro, jogo *Jogo) {
+	alvo := &Alvo{Pos: PosicaoMapa{X: jogo.PosX, Y: jogo.PosY}, Dir: jogo.UltimaDirecao}
+	prox := monstro.nav.Passo(gradeJogo{jogo}, PosicaoMapa{X: monstro.X, Y: monstro.Y}, alvo)
+	monstro.X, monstro.Y = prox.X, prox.Y
+}
+
+// elemento usado para desenhar o monstro: símbolo e cor do tipo, ou o
+// MonstroElem quando o servidor não informou
+func monstroElemento(m MonsterInfo) Elemento {
+	elem := MonstroElem
+	if r := []rune(m.Symbol); len(r) == 1 {
+		elem.simbolo = r[0]
 	}
-	if monstro.Y < alvoY {
-		dy = 1
-	} else if monstro.Y > alvoY {
-		dy = -1
+	elem.cor = corPorNome(m.Color, elem.cor)
+	return elem
+}
+
+// verifica se algum monstro conhecido (do servidor) está na posição do player
+func monstroNaPosicao(jogo *Jogo) bool {
+	for _, m := range jogo.Monstros {
+		if m.X == jogo.PosX && m.Y == jogo.PosY {
+			return true
+		}
 	}
-	monstro.X += dx
-	monstro.Y += dy
+	return false
 }
 
 // verifica se o monstro encostou no player
@@ -8,29 +8,33 @@ import "fmt"
 
 // personagem.go
 // --------------------------------------------------
-// Comentários/TODOs para Member B:
-// - Depois de integrar o RPC client, enviar um comando UPDATE_POS ao servidor sempre
-//   que o jogador se mover localmente. Não mova a lógica de movimentação para o servidor;
-//   o cliente continua sendo autoridade sobre seu próprio movimento.
-// - Exemplo de payload:
-//     payload := map[string]interface{}{"x": nx, "y": ny, "lives": jogo.Pontos}
-//     rpcClient.SendCommand("UPDATE_POS", payload)
-// - Armazene/recupere o rpcClient a partir de uma variável global acessível aqui ou passe-o
-//   como parâmetro (ex: personagemMover(tecla, jogo, rpcClient)).
+// O movimento é aplicado localmente na hora (predição, para a resposta ser
+// imediata) e enviado ao servidor como um comando MOVE com a direção. O
+// servidor valida o passo contra o mapa e responde com a posição oficial; o
+// loop principal parte dela e refaz os MOVE ainda sem resposta (ver
+// clienteReconciliar), então o personagem só é corrigido quando diverge.
 // --------------------------------------------------
 
 // Atualiza a posição do personagem com base na tecla pressionada (WASD)
 func personagemMover(tecla rune, jogo *Jogo) {
 	dx, dy := 0, 0
+	dir := ""
 	switch tecla {
 	case 'w':
 		dy = -1 // Move para cima
+		dir = DirCima
 	case 'a':
 		dx = -1 // Move para a esquerda
+		dir = DirEsquerda
 	case 's':
 		dy = 1 // Move para baixo
+		dir = DirBaixo
 	case 'd':
 		dx = 1 // Move para a direita
+		dir = DirDireita
+	}
+	if dir == "" {
+		return // tecla sem movimento associado
 	}
 
 	nx, ny := jogo.PosX+dx, jogo.PosY+dy
@@ -38,13 +42,14 @@ func personagemMover(tecla rune, jogo *Jogo) {
 	if jogoPodeMoverPara(jogo, nx, ny) {
 		jogoMoverElemento(jogo, jogo.PosX, jogo.PosY, dx, dy)
 		jogo.PosX, jogo.PosY = nx, ny
+		jogo.UltimaDirecao = PosicaoMapa{X: dx, Y: dy}
 
-		// === B) reportar posicao ao servidor
-		if rpcClient != nil {
-			up := UpdatePosPayload{X: jogo.PosX, Y: jogo.PosY, Lives: jogo.Pontos}
-			go func() {
-				_, _ = rpcClient.SendCommand("UPDATE_POS", up)
-			}()
+		// === B) pedir ao servidor o mesmo passo; ele devolve a posição oficial
+		if rpcClient == nil || rpcClient.Suporta("MOVE") {
+			clienteEnfileirar(jogo, "MOVE", MovePayload{Dir: dir})
+		} else {
+			// servidor sem MOVE: manda a posição nova, como antes do MOVE existir
+			clienteEnfileirar(jogo, "UPDATE_POS", UpdatePosPayload{X: nx, Y: ny, Lives: jogo.Vidas})
 		}
 	}
 }
@@ -70,10 +75,5 @@ func personagemExecutarAcao(ev EventoTeclado, jogo *Jogo) bool {
 		// Move o personagem com base na tecla
 		personagemMover(ev.Tecla, jogo)
 	}
-	// TODO Member B: Logo após mover (no caso "mover"), enviar UPDATE_POS via rpcClient.
-	// Se o rpcClient estiver disponível globalmente, chame aqui:
-	//   payload := map[string]interface{}{ "x": jogo.PosX, "y": jogo.PosY, "lives": jogo.Pontos }
-	//   rpcClient.SendCommand("UPDATE_POS", payload)
-
 	return true // Continua o jogo
 }
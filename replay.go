@@ -0,0 +1,192 @@
+//go:build !server
+// +build !server
+
+// replay.go - Gravação das teclas e replay determinístico
+//
+// Com RECORD=<arquivo> o cliente grava a semente de cada rodada e cada tecla
+// com o passo da simulação em que foi aplicada. Com REPLAY=<arquivo> as teclas
+// vêm do arquivo em vez do teclado e, como a simulação só depende da semente e
+// das entradas (ver simulacao.go), a partida se repete igual. O arquivo é texto:
+//
+//	mapa mapa.txt
+//	rodada 1718000000000000000
+//	12 mover d
+//	40 interagir
+//	rodada 1718000000000000001
+//	7 sair
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// TeclaReplay é uma tecla gravada e o passo em que ela foi aplicada
+type TeclaReplay struct {
+	Tick   int64
+	Evento EventoTeclado
+}
+
+// RodadaReplay são as teclas de uma rodada, do REGISTER ao fim de jogo
+type RodadaReplay struct {
+	Semente int64
+	Teclas  []TeclaReplay
+
+	proxima int // primeira tecla ainda não entregue
+}
+
+// Replay é um arquivo de replay lido
+type Replay struct {
+	Mapa    string
+	Rodadas []*RodadaReplay
+}
+
+// Gravador escreve o arquivo de replay. Cada linha é gravada na hora, para o
+// arquivo valer mesmo se o jogo for encerrado à força.
+type Gravador struct {
+	arq *os.File
+	w   *bufio.Writer
+}
+
+func novoGravador(nome, mapa string) (*Gravador, error) {
+	arq, err := os.Create(nome)
+	if err != nil {
+		return nil, err
+	}
+	g := &Gravador{arq: arq, w: bufio.NewWriter(arq)}
+	if err := g.linha("mapa " + mapa); err != nil {
+		arq.Close()
+		return nil, err
+	}
+	return g, nil
+}
+
+// Rodada marca o começo de uma rodada com a semente dela
+func (g *Gravador) Rodada(semente int64) error {
+	return g.linha("rodada " + strconv.FormatInt(semente, 10))
+}
+
+// Tecla grava uma tecla aplicada no passo tick
+func (g *Gravador) Tecla(tick int64, ev EventoTeclado) error {
+	l := strconv.FormatInt(tick, 10) + " " + ev.Tipo
+	if ev.Tipo == "mover" {
+		l += " " + string(ev.Tecla)
+	}
+	return g.linha(l)
+}
+
+// Entradas grava as teclas que estão entre as entradas do passo tick
+func (g *Gravador) Entradas(tick int64, entradas []Entrada) error {
+	for _, e := range entradas {
+		if e.Teclado == nil {
+			continue
+		}
+		if err := g.Tecla(tick, *e.Teclado); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g *Gravador) linha(l string) error {
+	if _, err := g.w.WriteString(l + "\n"); err != nil {
+		return err
+	}
+	return g.w.Flush()
+}
+
+func (g *Gravador) Fechar() error {
+	return g.arq.Close()
+}
+
+// lerReplay lê um arquivo gravado por Gravador
+func lerReplay(nome string) (*Replay, error) {
+	arq, err := os.Open(nome)
+	if err != nil {
+		return nil, err
+	}
+	defer arq.Close()
+
+	r := &Replay{}
+	var atual *RodadaReplay
+	scanner := bufio.NewScanner(arq)
+	numLinha := 0
+	for scanner.Scan() {
+		numLinha++
+		campos := strings.Fields(scanner.Text())
+		if len(campos) == 0 {
+			continue
+		}
+		switch campos[0] {
+		case "mapa":
+			r.Mapa = strings.TrimSpace(strings.TrimPrefix(scanner.Text(), "mapa"))
+			continue
+		case "rodada":
+			if len(campos) != 2 {
+				return nil, fmt.Errorf("%s:%d: bad rodada line", nome, numLinha)
+			}
+			semente, err := strconv.ParseInt(campos[1], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: bad seed %q", nome, numLinha, campos[1])
+			}
+			atual = &RodadaReplay{Semente: semente}
+			r.Rodadas = append(r.Rodadas, atual)
+			continue
+		}
+		if atual == nil {
+			return nil, fmt.Errorf("%s:%d: key before the first rodada line", nome, numLinha)
+		}
+		tecla, err := lerTeclaReplay(scanner.Text())
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", nome, numLinha, err)
+		}
+		atual.Teclas = append(atual.Teclas, tecla)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// lerTeclaReplay interpreta "<tick> <tipo> [tecla]"; a tecla é o resto da
+// linha depois de um espaço (pode ser ela mesma um espaço)
+func lerTeclaReplay(linha string) (TeclaReplay, error) {
+	campos := strings.SplitN(strings.TrimLeft(linha, " \t"), " ", 3)
+	if len(campos) < 2 {
+		return TeclaReplay{}, fmt.Errorf("bad key line %q", linha)
+	}
+	tick, err := strconv.ParseInt(campos[0], 10, 64)
+	if err != nil {
+		return TeclaReplay{}, fmt.Errorf("bad tick %q", campos[0])
+	}
+	t := TeclaReplay{Tick: tick, Evento: EventoTeclado{Tipo: strings.TrimSpace(campos[1])}}
+	switch t.Evento.Tipo {
+	case "mover":
+		var r []rune
+		if len(campos) == 3 {
+			r = []rune(campos[2])
+		}
+		if len(r) != 1 {
+			return TeclaReplay{}, fmt.Errorf("mover needs a single key")
+		}
+		t.Evento.Tecla = r[0]
+	case "interagir", "sair", "confirmar":
+	default:
+		return TeclaReplay{}, fmt.Errorf("unknown key type %q", t.Evento.Tipo)
+	}
+	return t, nil
+}
+
+// entradas devolve as teclas gravadas para o passo tick
+func (r *RodadaReplay) entradas(tick int64) []Entrada {
+	var es []Entrada
+	for r.proxima < len(r.Teclas) && r.Teclas[r.proxima].Tick <= tick {
+		ev := r.Teclas[r.proxima].Evento
+		es = append(es, Entrada{Teclado: &ev})
+		r.proxima++
+	}
+	return es
+}
@@ -2,6 +2,8 @@ package main
 
 import (
 	"encoding/gob"
+	"encoding/json"
+	"fmt"
 	"time"
 )
 
@@ -21,7 +23,7 @@ import (
 // - Modificações necessárias nos ficheiros antigos (resumo):
 //   * `main.go`  : inicializar `RPCClient`, iniciar polling goroutine e passar `rpcClient` onde necessário.
 //   * `personagem.go` : ao mover o jogador (em `personagemMover` ou `personagemExecutarAcao`), chamar
-//                       `rpcClient.SendCommand("UPDATE_POS", map[string]interface{}{ "x": nx, "y": ny, "lives": jogo.Pontos })`.
+//                       `rpcClient.SendCommand("UPDATE_POS", map[string]interface{}{ "x": nx, "y": ny, "lives": jogo.Vidas })`.
 //   * `jogo.go` : opcionalmente, não mover a lógica de movimento para o servidor; o servidor apenas armazena
 //                posições reportadas pelos clientes. Mantenha `jogoMoverElemento` e `jogoPodeMoverPara` no cliente.
 //   * `interface.go` : alterar `interfaceDesenharJogo` para desenhar também os outros jogadores (iteração sobre
@@ -32,18 +34,75 @@ type PlayerInfo struct {
 	ID       string
 	X, Y     int
 	Lives    int
+	Coins    int   // moedas coletadas com COLLECT
 	LastSeen int64 // unix timestamp
 }
 
+// StateReply traz o estado completo (Full=true, em Players) ou apenas as
+// mudanças desde BaseVersion (Added/Updated/Removed), quando o cliente pede delta
 type StateReply struct {
 	Players    []PlayerInfo
-	ServerTime int64
+	ServerTime int64  // instante da resposta no servidor, em milissegundos Unix
+	Version    int64  // versão monotônica do estado da sala; muda a cada alteração em Players
+	Room       string // sala do jogador; versões de salas diferentes não são comparáveis
+
+	Full        bool         // true quando Players contém o snapshot completo
+	BaseVersion int64        // versão sobre a qual o delta deve ser aplicado
+	Added       []PlayerInfo // jogadores que não existiam em BaseVersion
+	Updated     []PlayerInfo // jogadores que mudaram desde BaseVersion
+	Removed     []string     // IDs removidos desde BaseVersion
+
+	Monsters []MonsterInfo // monstros da sala (sempre a lista completa)
+	Entities []EntityInfo  // moedas e armadilhas da sala (sempre a lista completa)
+}
+
+// MonsterInfo é a posição de um monstro simulado pelo servidor. Kind é o nome
+// do tipo no catálogo; Symbol e Color dizem como desenhá-lo.
+type MonsterInfo struct {
+	ID     string
+	X, Y   int
+	Kind   string
+	Symbol string
+	Color  string
+}
+
+// Tipos de EntityInfo.Kind
+const (
+	EntidadeMoeda     = "coin"
+	EntidadeArmadilha = "trap"
+)
+
+// EntityInfo é uma moeda ou armadilha mantida pelo servidor
+type EntityInfo struct {
+	ID   string // muda a cada reaparecimento da moeda
+	Kind string // EntidadeMoeda ou EntidadeArmadilha
+	X, Y int
 }
 
 // Payloads tipados para comunicação RPC
 type RegisterPayload struct {
 	Name string
-	X, Y int
+	X, Y int    // ignorados: o servidor escolhe a posição (ver SendCommand)
+	Room string // sala onde entrar ("" mantém a atual ou usa o lobby)
+}
+
+// RoomPayload é usado por CREATE_ROOM (Name, Map, Capacity) e JOIN_ROOM (Name)
+type RoomPayload struct {
+	Name     string
+	Map      string // arquivo de mapa da sala ("" usa o mapa do lobby)
+	Capacity int    // máximo de jogadores (0 usa o padrão do servidor)
+}
+
+// RoomInfo descreve uma sala na resposta de ListRooms
+type RoomInfo struct {
+	Name     string
+	Map      string
+	Capacity int
+	Players  int
+}
+
+type RoomListReply struct {
+	Rooms []RoomInfo
 }
 
 type UpdatePosPayload struct {
@@ -51,6 +110,35 @@ type UpdatePosPayload struct {
 	Lives int
 }
 
+// MovePayload pede ao servidor para mover o jogador um passo na direção Dir.
+// O servidor valida contra as paredes do mapa e responde com a posição oficial.
+type MovePayload struct {
+	Dir string // DirCima, DirBaixo, DirEsquerda ou DirDireita
+}
+
+// Direções aceitas pelo comando MOVE
+const (
+	DirCima     = "up"
+	DirBaixo    = "down"
+	DirEsquerda = "left"
+	DirDireita  = "right"
+)
+
+// CollectPayload pede a moeda ID; só o primeiro jogador na posição dela a leva
+type CollectPayload struct {
+	ID string
+}
+
+// VidasIniciais é quantas vidas o jogador tem ao registrar
+const VidasIniciais = 3
+
+// RespawnPayload avisa que o jogador levou dano e ficou com Lives vidas. Com
+// vidas sobrando o servidor o leva a um início livre do mapa; com zero, só
+// registra o fim de jogo.
+type RespawnPayload struct {
+	Lives int
+}
+
 // CommandArgs representa um comando enviado pelo cliente ao servidor
 // Payload agora é interface{} para suportar structs tipados. Os tipos
 // precisam ser registrados com gob para permitir serialização via net/rpc.
@@ -59,23 +147,133 @@ type CommandArgs struct {
 	Seq      int64
 	Cmd      string
 	Payload  interface{}
+	Token    string // token de sessão devolvido pelo REGISTER (dispensado no próprio REGISTER)
 }
 
 type CommandReply struct {
 	Seq     int64
 	Applied bool
 	Message string
+	X, Y    int    // posição oficial do jogador após o comando (MOVE/UPDATE_POS/RESPAWN)
+	Token   string // token de sessão emitido pelo REGISTER
 }
 
 type ClientIDArgs struct {
-	ClientID string
-	Now      time.Time
+	ClientID    string
+	Now         time.Time
+	BaseVersion int64 // versão que o cliente já possui; 0 pede snapshot completo
+	Token       string
+	Room        string // sala a que BaseVersion se refere
+}
+
+// WatchArgs são os argumentos de GameServer.WatchState: a chamada só retorna
+// quando o estado tiver versão maior que SinceVersion (ou após TimeoutMS)
+type WatchArgs struct {
+	ClientID     string
+	SinceVersion int64
+	TimeoutMS    int   // 0 usa o timeout máximo do servidor
+	BaseVersion  int64 // versão que o cliente já possui; 0 pede snapshot completo
+	Token        string
+	Room         string // sala a que SinceVersion/BaseVersion se referem
+}
+
+// VersaoProtocolo é a versão dos tipos e comandos RPC; muda quando uma
+// alteração quebra clientes ou servidores antigos. A versão 1 é a de antes do
+// Hello; a 2 trouxe o Hello e StateReply.ServerTime em milissegundos.
+// VersaoProtocoloMinima é a versão mais antiga do outro lado com que este
+// binário ainda joga.
+const (
+	VersaoProtocolo       = 2
+	VersaoProtocoloMinima = 2
+)
+
+// versaoBuild identifica o binário no Hello; troque com
+// go build -ldflags "-X main.versaoBuild=<versão>"
+var versaoBuild = "dev"
+
+// Capacidades opcionais anunciadas pelo servidor no Hello. Sem elas o cliente
+// continua jogando, do jeito mais simples.
+const (
+	CapacidadeWatch = "watch-state" // WatchState (sem ela, polling de GetState)
+	CapacidadeDelta = "delta"       // GetState/WatchState respondem deltas (sem ela, sempre o estado completo)
+	CapacidadeSalas = "rooms"       // ListRooms e CREATE_ROOM/JOIN_ROOM (sem ela, só o lobby)
+)
+
+// HelloArgs são os argumentos de GameServer.Hello, chamado antes do REGISTER
+type HelloArgs struct {
+	ClientID    string
+	Protocol    int // VersaoProtocolo do cliente
+	MinProtocol int // VersaoProtocoloMinima do cliente
+	Build       string
+}
+
+// HelloReply descreve o servidor: versão do protocolo, build, comandos de
+// SendCommand, capacidades opcionais e o mapa do lobby com o checksum dele
+type HelloReply struct {
+	Protocol     int
+	MinProtocol  int
+	Build        string
+	Commands     []string
+	Capabilities []string
+	Map          string
+	MapChecksum  string // ver checksumMapa
+}
+
+// Suporta indica se o servidor anunciou a capacidade ou o comando nome
+func (h HelloReply) Suporta(nome string) bool {
+	for _, c := range h.Capabilities {
+		if c == nome {
+			return true
+		}
+	}
+	for _, c := range h.Commands {
+		if c == nome {
+			return true
+		}
+	}
+	return false
+}
+
+// protocoloCompativel confere a versão do outro lado (versao, e a mínima que
+// ele aceita) contra a deste binário
+func protocoloCompativel(versao, minima int) error {
+	if versao < VersaoProtocoloMinima {
+		return fmt.Errorf("peer speaks protocol version %d, this build needs at least %d", versao, VersaoProtocoloMinima)
+	}
+	if minima > VersaoProtocolo {
+		return fmt.Errorf("peer needs protocol version %d or newer, this build speaks %d", minima, VersaoProtocolo)
+	}
+	return nil
+}
+
+// PedidoWS é uma chamada no transporte WebSocket (ver server_ws.go). Params
+// leva os mesmos argumentos do net/rpc: CommandArgs em SendCommand,
+// ClientIDArgs em GetState e ListRooms, HelloArgs em Hello e WatchArgs em
+// Subscribe.
+type PedidoWS struct {
+	ID     int64
+	Method string
+	Params json.RawMessage
+}
+
+// RespostaWS é uma mensagem do servidor no transporte WebSocket: a resposta
+// do pedido ID (Result ou Error) ou, com ID 0, um estado da assinatura (State,
+// ou Error quando a assinatura termina)
+type RespostaWS struct {
+	ID     int64
+	Result json.RawMessage `json:",omitempty"`
+	Error  string          `json:",omitempty"`
+	State  *StateReply     `json:",omitempty"`
 }
 
 func init() {
 	// Registrar os tipos usados para que encoding/gob consiga codificar/decodificar
 	gob.Register(RegisterPayload{})
 	gob.Register(UpdatePosPayload{})
+	gob.Register(MovePayload{})
+	gob.Register(RoomPayload{})
+	gob.Register(CollectPayload{})
+	gob.Register(RespawnPayload{})
 }
 
 // Validação simples para UpdatePosPayload
@@ -90,6 +288,14 @@ func ValidateUpdatePos(p UpdatePosPayload) error {
 	return nil
 }
 
+// Validação simples para MovePayload
+func ValidateMove(m MovePayload) error {
+	if _, _, ok := direcaoDelta(m.Dir); !ok {
+		return &ValidationError{"unknown direction"}
+	}
+	return nil
+}
+
 // Validação simples para RegisterPayload
 func ValidateRegister(r RegisterPayload) error {
 	if r.Name == "" {
@@ -10,57 +10,167 @@ import (
 )
 
 // GameServer gerencia o estado global do jogo multiplayer, incluindo:
-// - Lista de jogadores ativos e suas posições
+// - Salas, cada uma com seus jogadores ativos e suas posições
 // - Sistema de deduplicação de comandos (exactly-once)
 // - Limpeza automática de dados antigos
 type GameServer struct {
-	mu        sync.Mutex                        // Protege acesso concorrente aos maps
-	players   map[string]PlayerInfo             // Mapa de jogadores ativos indexado por ClientID
-	processed map[string]map[int64]CommandReply // Cache de comandos processados para deduplicação
+	mu      sync.Mutex                // Protege acesso concorrente aos maps
+	salas   map[string]*Sala          // Salas abertas indexadas pelo nome (sempre contém SalaPadrao)
+	salaDe  map[string]string         // Sala de cada jogador ativo, indexada por ClientID
+	dedup   map[string]*janelaCliente // Janela deslizante de Seqs processados, por cliente
+	store   *armazenamento            // Log + snapshots em disco (nil = apenas em memória)
+	segredo []byte                    // Chave HMAC dos tokens de sessão
+	sessoes map[string]string         // Sessão atual de cada ClientID registrado (ver server_auth.go)
+	soma    string                    // Checksum do mapa do lobby, anunciado no Hello
 
-	// Controle de TTL (Time To Live)
-	processedTimestamps map[string]map[int64]time.Time // Registra quando cada comando foi processado
-	config              struct {
+	config struct {
 		port         int           // Porta do servidor RPC
-		ttlProcessed time.Duration // Tempo máximo para manter comandos em cache
+		ttlProcessed time.Duration // Tempo máximo sem comandos antes de descartar a janela do cliente
+		dedupWindow  int64         // Quantos Seqs abaixo do maior visto ainda são aceitos/lembrados
 		ttlPlayer    time.Duration // Tempo máximo sem atualização antes de remover jogador
+		mapFile      string        // Arquivo de mapa usado para validar movimentos
+		watchTimeout time.Duration // Tempo máximo que WatchState segura uma chamada
+		historyLimit int           // Máximo de mudanças guardadas para gerar deltas
+		dataDir      string        // Diretório do log/snapshot ("" desliga a persistência)
+		fsync        string        // Política de fsync do log (always, interval, never)
+		snapshotInt  time.Duration // Intervalo entre snapshots
+		secretFile   string        // Arquivo com o segredo dos tokens ("" usa GAME_SECRET)
+		tokenTTL     time.Duration // Validade dos tokens de sessão
+		roomCapacity int           // Capacidade padrão das salas criadas (0 = sem limite)
+		maxRooms     int           // Máximo de salas criadas com CREATE_ROOM (0 = sem limite)
+		monsters     int           // Monstros criados em cada sala (mapas sem marcadores)
+		tick         time.Duration // Intervalo da simulação; cada tipo de monstro anda no seu ritmo
+		coins        int           // Moedas em cada sala (mapas sem marcadores)
+		traps        int           // Armadilhas em cada sala (mapas sem marcadores)
+		coinInterval time.Duration // Intervalo entre mudanças de lugar das moedas (0 = nunca)
+		catalog      string        // Arquivo com tipos de monstro extras ("" = só os embutidos)
+		seed         int64         // Semente dos sorteios das salas (monstros, moedas, armadilhas)
+		exportMap    string        // Grava o mapa (gerado) neste arquivo e sai ("" = não exporta)
+		httpPort     int           // Porta do gateway HTTP/JSON (0 = desligado)
+		jsonrpcPort  int           // Porta do gateway net/rpc/jsonrpc (0 = desligado)
+		wsPort       int           // Porta local do transporte WebSocket (0 = desligado)
 	}
 }
 
 func NewGameServer() *GameServer {
 	s := &GameServer{
-		players:             make(map[string]PlayerInfo),
-		processed:           make(map[string]map[int64]CommandReply),
-		processedTimestamps: make(map[string]map[int64]time.Time),
+		salas:   make(map[string]*Sala),
+		salaDe:  make(map[string]string),
+		dedup:   make(map[string]*janelaCliente),
+		segredo: novoSegredo(),
+		sessoes: make(map[string]string),
 	}
 
 	// Configurações default
 	s.config.port = 12345
 	s.config.ttlProcessed = 30 * time.Minute
+	s.config.dedupWindow = 64
 	s.config.ttlPlayer = 1 * time.Minute
+	s.config.mapFile = "mapa.txt"
+	s.config.watchTimeout = 30 * time.Second
+	s.config.historyLimit = 1024
+	s.config.fsync = FsyncIntervalo
+	s.config.snapshotInt = 1 * time.Minute
+	s.config.tokenTTL = 1 * time.Hour
+	s.config.roomCapacity = 8
+	s.config.maxRooms = 32
+	s.config.monsters = 1
+	s.config.tick = 250 * time.Millisecond
+	s.config.coins = 1
+	s.config.traps = 20
+	s.config.coinInterval = 15 * time.Second
+	s.config.seed = time.Now().UnixNano()
 
+	s.salas[SalaPadrao] = novaSala(SalaPadrao, "", 0, s.config.historyLimit, s.config.seed)
 	return s
 }
 
-// SendCommand processa comandos dos clientes com garantia de exactly-once:
-// - REGISTER: registra novo jogador
-// - UPDATE_POS: atualiza posição do jogador
+// carregarMapa lê o arquivo de mapa do lobby, usado para validar os movimentos
+// e como mapa padrão das salas criadas sem mapa próprio
+func (s *GameServer) carregarMapa(nome string) error {
+	m, err := carregarMapaServidor(nome)
+	if err != nil {
+		return err
+	}
+	soma, err := checksumMapa(nome)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.soma = soma
+	lobby := s.salas[SalaPadrao]
+	lobby.mapa = m
+	lobby.MapFile = nome
+	lobby.rng = novoRNG(s.config.seed) // a semente pode ter vindo de --seed depois de NewGameServer
+	lobby.criarMonstros(s.config.monsters)
+	lobby.criarEntidades(s.config.coins, s.config.traps)
+	s.mu.Unlock()
+	return nil
+}
+
+// SendCommand processa comandos dos clientes com garantia de exactly-once.
+// Todo comando exceto REGISTER precisa do token de sessão devolvido pelo REGISTER.
+// - REGISTER: registra novo jogador e emite o token de sessão
+// - MOVE: move o jogador um passo, validando contra as paredes do mapa
+// - UPDATE_POS: atualiza posição do jogador (apenas posições válidas e adjacentes)
 // - LOGOUT: remove jogador do servidor
+// - CREATE_ROOM / JOIN_ROOM / LEAVE_ROOM: cria, entra ou sai de uma sala
+// - COLLECT: pega uma moeda da sala (só o primeiro jogador a leva)
+// - RESPAWN: o jogador levou dano; registra as vidas e o leva a um início livre
 func (s *GameServer) SendCommand(args *CommandArgs, reply *CommandReply) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	// Inicializa estruturas de deduplicação para novo cliente
-	if _, ok := s.processed[args.ClientID]; !ok {
-		s.processed[args.ClientID] = make(map[int64]CommandReply)
-		s.processedTimestamps[args.ClientID] = make(map[int64]time.Time)
+	// Autenticação: o token precisa ter sido emitido para este ClientID. Um
+	// token expirado ainda busca a resposta de um comando já processado (o
+	// reenvio continua exactly-once), mas não executa comandos novos.
+	var errExpirado error
+	if args.Cmd != "REGISTER" {
+		if err := s.conferirToken(args.ClientID, args.Token, true); err != nil {
+			*reply = CommandReply{Seq: args.Seq, Applied: false, Message: err.Error()}
+			fmt.Printf("[SERVER] %s Rejected %s seq=%d from %s: %v\n",
+				time.Now().Format(time.RFC3339), args.Cmd, args.Seq, args.ClientID, err)
+			return nil
+		}
+		errExpirado = s.conferirToken(args.ClientID, args.Token, false)
 	}
 
-	// Sistema de deduplicação: retorna resposta em cache se comando já foi processado
-	if prev, ok := s.processed[args.ClientID][args.Seq]; ok {
-		*reply = prev
-		fmt.Printf("[SERVER] %s Duplicate command detected for %s seq=%d - returning cached reply\n",
-			time.Now().Format(time.RFC3339), args.ClientID, args.Seq)
+	// Um ClientID em uso só pode ser registrado de novo por quem tem um token
+	// dele (mesmo expirado). Sem o token, o REGISTER não consulta a janela de
+	// deduplicação: a resposta em cache traz o token da sessão do dono.
+	dono := args.Cmd != "REGISTER" || s.conferirToken(args.ClientID, args.Token, true) == nil
+	if !dono {
+		if _, _, ativo := s.jogador(args.ClientID); ativo {
+			*reply = CommandReply{Seq: args.Seq, Applied: false, Message: MsgAlreadyRegistered}
+			fmt.Printf("[SERVER] %s Rejected REGISTER for active player %s without its token\n", time.Now().Format(time.RFC3339), args.ClientID)
+			return nil
+		}
+	}
+
+	if dono {
+		// Sistema de deduplicação: retorna resposta em cache se comando já foi processado
+		// ou rejeita Seqs que já saíram da janela
+		if prev, ok := s.verificarDuplicado(args.ClientID, args.Seq); ok {
+			if args.Cmd == "REGISTER" && prev.Applied && prev.Token == "" {
+				// resposta restaurada do disco, que não guarda tokens: quem
+				// repete o REGISTER já provou ser o dono, então recebe um novo
+				prev.Token = s.emitirToken(args.ClientID)
+			}
+			*reply = prev
+			if prev.Message == MsgSeqTooOld {
+				fmt.Printf("[SERVER] %s Rejected seq=%d from %s: below dedup window\n",
+					time.Now().Format(time.RFC3339), args.Seq, args.ClientID)
+			} else {
+				fmt.Printf("[SERVER] %s Duplicate command detected for %s seq=%d - returning cached reply\n",
+					time.Now().Format(time.RFC3339), args.ClientID, args.Seq)
+			}
+			return nil
+		}
+	}
+	if errExpirado != nil {
+		*reply = CommandReply{Seq: args.Seq, Applied: false, Message: errExpirado.Error()}
+		fmt.Printf("[SERVER] %s Rejected %s seq=%d from %s: %v\n",
+			time.Now().Format(time.RFC3339), args.Cmd, args.Seq, args.ClientID, errExpirado)
 		return nil
 	}
 
@@ -73,6 +183,7 @@ func (s *GameServer) SendCommand(args *CommandArgs, reply *CommandReply) error {
 	case "UPDATE_POS":
 		// Extrair payload de forma segura
 		var x, y, lives int
+		temVidas := true
 		switch p := args.Payload.(type) {
 		case UpdatePosPayload:
 			x = p.X
@@ -85,25 +196,88 @@ func (s *GameServer) SendCommand(args *CommandArgs, reply *CommandReply) error {
 			if yi, ok := toInt(p["y"]); ok {
 				y = yi
 			}
-			if li, ok := toInt(p["lives"]); ok {
-				lives = li
-			}
+			lives, temVidas = toInt(p["lives"])
 		default:
 			// caso não saibamos o tipo, rejeitamos o comando
 			cr.Applied = false
 			cr.Message = "bad-payload"
 			fmt.Printf("[SERVER] %s UPDATE_POS bad payload type %T from %s\n", time.Now().Format(time.RFC3339), args.Payload, args.ClientID)
-			s.processed[args.ClientID][args.Seq] = cr
-			s.processedTimestamps[args.ClientID][args.Seq] = time.Now()
+			s.lembrarComando(args.ClientID, args.Seq, cr, time.Now())
+			s.persistirComando(args.ClientID, args.Seq, cr)
 			*reply = cr
 			return nil
 		}
 
-		pi := PlayerInfo{ID: args.ClientID, X: x, Y: y, Lives: lives, LastSeen: time.Now().Unix()}
-		s.players[args.ClientID] = pi
+		// O servidor é a autoridade da posição: rejeita paredes e saltos maiores que um passo
+		sala := s.salaOuPadrao(args.ClientID)
+		prev, ok := sala.players[args.ClientID]
+		if !ok {
+			// só o REGISTER cria jogadores (com as vidas iniciais)
+			cr.Applied = false
+			cr.Message = "not-registered"
+			fmt.Printf("[SERVER] %s UPDATE_POS from unregistered player %s\n", time.Now().Format(time.RFC3339), args.ClientID)
+			break
+		}
+		if !sala.posicaoValida(x, y) || abs(x-prev.X)+abs(y-prev.Y) > 1 {
+			cr.Applied = false
+			cr.Message = "invalid-position"
+			cr.X, cr.Y = prev.X, prev.Y
+			fmt.Printf("[SERVER] %s Rejected UPDATE_POS for %s -> (%d,%d), keeping (%d,%d)\n", time.Now().Format(time.RFC3339), args.ClientID, x, y, prev.X, prev.Y)
+			break
+		}
+
+		// as vidas só diminuem por aqui (dano); só uma partida nova as repõe
+		if !temVidas || lives > prev.Lives {
+			lives = prev.Lives
+		}
+		pi := PlayerInfo{ID: args.ClientID, X: x, Y: y, Lives: lives, Coins: prev.Coins, LastSeen: time.Now().Unix()}
+		s.salvarJogador(sala, pi)
 		cr.Applied = true
 		cr.Message = "position-updated"
+		cr.X, cr.Y = x, y
 		fmt.Printf("[SERVER] %s Updated position for %s -> (%d,%d) lives=%d\n", time.Now().Format(time.RFC3339), args.ClientID, x, y, lives)
+	case "MOVE":
+		var mp MovePayload
+		switch p := args.Payload.(type) {
+		case MovePayload:
+			mp = p
+		case map[string]interface{}:
+			if dir, ok := p["dir"].(string); ok {
+				mp.Dir = dir
+			}
+		}
+		dx, dy, ok := direcaoDelta(mp.Dir)
+		if !ok {
+			cr.Applied = false
+			cr.Message = "bad-payload"
+			fmt.Printf("[SERVER] %s MOVE bad direction %q from %s\n", time.Now().Format(time.RFC3339), mp.Dir, args.ClientID)
+			break
+		}
+		pi, sala, ok := s.jogador(args.ClientID)
+		if !ok {
+			cr.Applied = false
+			cr.Message = "not-registered"
+			fmt.Printf("[SERVER] %s MOVE from unregistered player %s\n", time.Now().Format(time.RFC3339), args.ClientID)
+			break
+		}
+		nx, ny := pi.X+dx, pi.Y+dy
+		if !sala.posicaoValida(nx, ny) {
+			// movimento bloqueado: devolve a posição atual para o cliente se corrigir
+			cr.Applied = false
+			cr.Message = "blocked"
+			cr.X, cr.Y = pi.X, pi.Y
+			pi.LastSeen = time.Now().Unix()
+			sala.players[args.ClientID] = pi
+			fmt.Printf("[SERVER] %s Blocked move %s for %s at (%d,%d)\n", time.Now().Format(time.RFC3339), mp.Dir, args.ClientID, pi.X, pi.Y)
+			break
+		}
+		pi.X, pi.Y = nx, ny
+		pi.LastSeen = time.Now().Unix()
+		s.salvarJogador(sala, pi)
+		cr.Applied = true
+		cr.Message = "moved"
+		cr.X, cr.Y = nx, ny
+		fmt.Printf("[SERVER] %s Moved %s %s -> (%d,%d)\n", time.Now().Format(time.RFC3339), args.ClientID, mp.Dir, nx, ny)
 	case "REGISTER":
 		// payload pode ser RegisterPayload ou map; registramos jogador
 		var px RegisterPayload
@@ -121,28 +295,85 @@ func (s *GameServer) SendCommand(args *CommandArgs, reply *CommandReply) error {
 			if yi, ok := toInt(p["y"]); ok {
 				px.Y = yi
 			}
+			if room, ok := p["room"].(string); ok {
+				px.Room = room
+			}
 		default:
 			// sem payload tipado, assume valores default
 		}
-		pi := PlayerInfo{ID: args.ClientID, X: px.X, Y: px.Y, Lives: 3, LastSeen: time.Now().Unix()}
-		s.players[args.ClientID] = pi
+		// quem chega aqui com o ClientID ativo tem um token dele (ver acima)
+		_, atual, ativo := s.jogador(args.ClientID)
+		// sem sala pedida, mantém a sala atual (re-registro) ou entra no lobby
+		sala := s.salas[SalaPadrao]
+		if px.Room != "" {
+			var existe bool
+			if sala, existe = s.salas[px.Room]; !existe {
+				cr.Applied = false
+				cr.Message = "no-such-room"
+				break
+			}
+		} else if ativo {
+			sala = atual
+		}
+		if sala != atual && sala.cheia() {
+			cr.Applied = false
+			cr.Message = "room-full"
+			break
+		}
+		// a posição é do servidor, não do payload (senão um REGISTER pularia a
+		// validação do MOVE): quem entra na sala vai para um início livre do
+		// mapa, cada jogador num início diferente; quem se registra de novo na
+		// mesma sala continua onde está
+		pi := PlayerInfo{ID: args.ClientID, Lives: VidasIniciais, LastSeen: time.Now().Unix()}
+		if ativo {
+			// re-registro não devolve vidas (nem depois de game-over): a
+			// partida nova começa depois de LOGOUT ou de o jogador expirar
+			prev := atual.players[args.ClientID]
+			pi.Lives, pi.Coins = prev.Lives, prev.Coins
+		}
+		if ativo && sala == atual {
+			prev := atual.players[args.ClientID]
+			pi.X, pi.Y = prev.X, prev.Y
+		} else {
+			pi.X, pi.Y = sala.inicioLivre(args.ClientID)
+		}
+		s.salvarJogador(sala, pi)
 		cr.Applied = true
 		cr.Message = "registered"
-		fmt.Printf("[SERVER] %s Registered player %s (name=%s)\n", time.Now().Format(time.RFC3339), args.ClientID, px.Name)
+		cr.X, cr.Y = pi.X, pi.Y
+		if !ativo {
+			s.iniciarSessao(args.ClientID)
+		}
+		cr.Token = s.emitirToken(args.ClientID)
+		fmt.Printf("[SERVER] %s Registered player %s (name=%s, room=%s)\n", time.Now().Format(time.RFC3339), args.ClientID, px.Name, sala.Nome)
 	case "LOGOUT":
-		delete(s.players, args.ClientID)
+		s.removerJogador(args.ClientID)
+		s.encerrarSessao(args.ClientID)
 		cr.Applied = true
 		cr.Message = "logged-out"
 		fmt.Printf("[SERVER] %s Player %s logged out\n", time.Now().Format(time.RFC3339), args.ClientID)
+	case "CREATE_ROOM", "JOIN_ROOM", "LEAVE_ROOM":
+		s.comandoSala(args, &cr)
+	case "COLLECT":
+		s.comandoColetar(args, &cr)
+	case "RESPAWN":
+		s.comandoRenascer(args, &cr)
 	default:
 		cr.Applied = false
 		cr.Message = "unknown-command"
 		fmt.Printf("[SERVER] %s Unknown command %s from %s\n", time.Now().Format(time.RFC3339), args.Cmd, args.ClientID)
 	}
 
-	// Armazena o resultado e timestamp
-	s.processed[args.ClientID][args.Seq] = cr
-	s.processedTimestamps[args.ClientID][args.Seq] = time.Now()
+	// REGISTER recusado não muda nada no servidor: fica fora da janela e do log,
+	// senão um Seq alto de quem não é o dono descartaria os comandos do dono
+	if args.Cmd == "REGISTER" && !cr.Applied {
+		*reply = cr
+		return nil
+	}
+
+	// Armazena o resultado e timestamp (em memória e no log em disco)
+	s.lembrarComando(args.ClientID, args.Seq, cr, time.Now())
+	s.persistirComando(args.ClientID, args.Seq, cr)
 	*reply = cr
 	return nil
 }
@@ -182,7 +413,14 @@ func toInt(v interface{}) (int, bool) {
 	}
 }
 
-// GetState retorna lista de jogadores ativos para os clientes
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// GetState retorna lista de jogadores ativos da sala do cliente
 // Usado pelo cliente para sincronizar estado do jogo
 func (s *GameServer) GetState(args *ClientIDArgs, reply *StateReply) error {
 	s.mu.Lock()
@@ -190,24 +428,103 @@ func (s *GameServer) GetState(args *ClientIDArgs, reply *StateReply) error {
 
 	fmt.Printf("[SERVER] %s Received GetState from %s at %s\n", time.Now().Format(time.RFC3339), args.ClientID, args.Now)
 
-	// Constrói lista de jogadores ativos
-	players := make([]PlayerInfo, 0, len(s.players))
-	for _, p := range s.players {
-		players = append(players, p)
+	if err := s.conferirToken(args.ClientID, args.Token, false); err != nil {
+		fmt.Printf("[SERVER] %s Rejected GetState from %s: %v\n", time.Now().Format(time.RFC3339), args.ClientID, err)
+		return err
+	}
+
+	sala := s.salaOuPadrao(args.ClientID)
+	base := args.BaseVersion
+	if args.Room != "" && args.Room != sala.Nome {
+		// a versão base é de outra sala: manda o snapshot completo da sala atual
+		base = 0
+	}
+	sala.preencherEstado(args.ClientID, base, reply)
+
+	fmt.Printf("[SERVER] %s Replying GetState to %s with %d players (full=%v)\n", time.Now().Format(time.RFC3339), args.ClientID, len(reply.Players), reply.Full)
+	return nil
+}
+
+// WatchState é a versão long-poll de GetState: segura a chamada até a versão do
+// estado da sala passar de args.SinceVersion, o jogador mudar de sala ou o timeout
+// expirar, e então responde com o estado atual. Continua sendo o cliente quem
+// inicia cada chamada.
+func (s *GameServer) WatchState(args *WatchArgs, reply *StateReply) error {
+	timeout := s.config.watchTimeout
+	if t := time.Duration(args.TimeoutMS) * time.Millisecond; t > 0 && t < timeout {
+		timeout = t
 	}
-	reply.Players = players
-	reply.ServerTime = time.Now().Unix()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
 
-	fmt.Printf("[SERVER] %s Replying GetState to %s with %d players\n", time.Now().Format(time.RFC3339), args.ClientID, len(players))
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.conferirToken(args.ClientID, args.Token, false); err != nil {
+		return err
+	}
+	for {
+		sala := s.salaOuPadrao(args.ClientID)
+		if sala.version > args.SinceVersion || (args.Room != "" && args.Room != sala.Nome) {
+			break
+		}
+		// sair da sala também avança a versão dela, então esperar só por ela basta
+		mudou := sala.mudou
+		s.mu.Unlock()
+		expirou := false
+		select {
+		case <-mudou:
+		case <-timer.C:
+			expirou = true
+		}
+		s.mu.Lock()
+		if expirou {
+			break
+		}
+	}
+	sala := s.salaOuPadrao(args.ClientID)
+	base := args.BaseVersion
+	if args.Room != "" && args.Room != sala.Nome {
+		base = 0
+	}
+	sala.preencherEstado(args.ClientID, base, reply)
+
+	if reply.Version > args.SinceVersion {
+		fmt.Printf("[SERVER] %s Replying WatchState to %s version=%d (full=%v, players=%d, added=%d, updated=%d, removed=%d)\n",
+			time.Now().Format(time.RFC3339), args.ClientID, reply.Version, reply.Full,
+			len(reply.Players), len(reply.Added), len(reply.Updated), len(reply.Removed))
+	}
 	return nil
 }
 
 // parseFlags configura o servidor usando flags de linha de comando ou variáveis de ambiente
 // Exemplo: go run server.go --port=8080 --ttl-player=30s
-func (s *GameServer) parseFlags() {
+// Devolve erro para valores que o servidor não consegue usar.
+func (s *GameServer) parseFlags() error {
 	port := flag.Int("port", s.config.port, "Port to listen on")
 	ttlProcessed := flag.Duration("ttl-processed", s.config.ttlProcessed, "TTL for processed commands")
+	dedupWindow := flag.Int64("dedup-window", s.config.dedupWindow, "Number of recent sequence numbers remembered per client for deduplication")
 	ttlPlayer := flag.Duration("ttl-player", s.config.ttlPlayer, "TTL for inactive players")
+	mapFile := flag.String("map", s.config.mapFile, "Map file used to validate movement, or a generated map (gerar:<type>:<width>x<height>[:<seed>])")
+	watchTimeout := flag.Duration("watch-timeout", s.config.watchTimeout, "Maximum time WatchState holds a call")
+	historyLimit := flag.Int("history-limit", s.config.historyLimit, "Number of state changes kept to answer delta requests")
+	dataDir := flag.String("data-dir", s.config.dataDir, "Directory for the command log and snapshots (empty keeps state in memory only)")
+	fsync := flag.String("fsync", s.config.fsync, "Command log fsync policy: always, interval or never")
+	snapshotInt := flag.Duration("snapshot-interval", s.config.snapshotInt, "Interval between snapshots of the dedup cache and players")
+	secretFile := flag.String("secret-file", s.config.secretFile, "File with the HMAC secret for session tokens (default: GAME_SECRET env var)")
+	tokenTTL := flag.Duration("token-ttl", s.config.tokenTTL, "Validity of session tokens issued by REGISTER")
+	roomCapacity := flag.Int("room-capacity", s.config.roomCapacity, "Default capacity of rooms created with CREATE_ROOM (0 = unlimited)")
+	maxRooms := flag.Int("max-rooms", s.config.maxRooms, "Maximum number of rooms created with CREATE_ROOM open at once (0 = unlimited)")
+	monsters := flag.Int("monsters", s.config.monsters, "Number of server-simulated monsters in rooms whose map has no monster markers")
+	tick := flag.Duration("tick", s.config.tick, "Interval between simulation ticks (each monster type moves at its own pace)")
+	coins := flag.Int("coins", s.config.coins, "Number of coins in rooms whose map has no coin markers")
+	traps := flag.Int("traps", s.config.traps, "Number of traps in rooms whose map has no trap markers")
+	coinInterval := flag.Duration("coin-interval", s.config.coinInterval, "Interval between coin relocations (0 = never)")
+	catalog := flag.String("monster-catalog", s.config.catalog, "File with extra monster types (see catalogo_monstros.go)")
+	seed := flag.Int64("seed", s.config.seed, "Seed for monster, coin and trap placement (default: SEED env var or the current time)")
+	exportMap := flag.String("export-map", s.config.exportMap, "Write the generated map given by --map to this file in the text map format and exit")
+	httpPort := flag.Int("http-port", s.config.httpPort, "Port for the HTTP/JSON gateway (POST /command, GET /state, GET /hello; 0 = disabled)")
+	jsonrpcPort := flag.Int("jsonrpc-port", s.config.jsonrpcPort, "Port for the net/rpc/jsonrpc gateway (0 = disabled)")
+	wsPort := flag.Int("ws-port", s.config.wsPort, "Port for the WebSocket transport at ws://127.0.0.1:<port>/ws, local only (0 = disabled)")
 
 	// Também aceita via env vars
 	if portEnv := os.Getenv("GAME_PORT"); portEnv != "" {
@@ -215,17 +532,56 @@ func (s *GameServer) parseFlags() {
 			*port = p
 		}
 	}
+	if dirEnv := os.Getenv("GAME_DATA_DIR"); dirEnv != "" {
+		*dataDir = dirEnv
+	}
+	if seedEnv := os.Getenv("SEED"); seedEnv != "" {
+		if v, err := strconv.ParseInt(seedEnv, 10, 64); err == nil {
+			*seed = v
+		}
+	}
 
 	flag.Parse()
+	if *dedupWindow < 1 {
+		// com janela 0 a resposta recém-guardada já sai da janela e o reenvio
+		// do último Seq receberia seq-too-old
+		return fmt.Errorf("--dedup-window must be at least 1, got %d", *dedupWindow)
+	}
 
 	s.config.port = *port
 	s.config.ttlProcessed = *ttlProcessed
+	s.config.dedupWindow = *dedupWindow
 	s.config.ttlPlayer = *ttlPlayer
+	s.config.mapFile = *mapFile
+	s.config.watchTimeout = *watchTimeout
+	s.config.historyLimit = *historyLimit
+	s.config.dataDir = *dataDir
+	s.config.fsync = *fsync
+	s.config.snapshotInt = *snapshotInt
+	s.config.secretFile = *secretFile
+	s.config.tokenTTL = *tokenTTL
+	s.config.roomCapacity = *roomCapacity
+	s.config.maxRooms = *maxRooms
+	s.config.monsters = *monsters
+	s.config.tick = *tick
+	s.config.coins = *coins
+	s.config.traps = *traps
+	s.config.coinInterval = *coinInterval
+	s.config.catalog = *catalog
+	s.config.seed = *seed
+	s.config.exportMap = *exportMap
+	s.config.httpPort = *httpPort
+	s.config.jsonrpcPort = *jsonrpcPort
+	s.config.wsPort = *wsPort
+	for _, sala := range s.salas {
+		sala.limiteHist = s.config.historyLimit
+	}
+	return nil
 }
 
 // startCleanupRoutine inicia uma goroutine que periodicamente:
 // - Remove jogadores inativos (sem atualização > ttlPlayer)
-// - Limpa cache de comandos antigos (processados > ttlProcessed)
+// - Limpa janelas de deduplicação de clientes inativos (> ttlProcessed)
 func (s *GameServer) startCleanupRoutine() {
 	go func() {
 		ticker := time.NewTicker(1 * time.Minute)
@@ -235,28 +591,28 @@ func (s *GameServer) startCleanupRoutine() {
 			s.mu.Lock()
 			now := time.Now()
 
-			// Limpa jogadores inativos
-			for id, player := range s.players {
+			// Limpa jogadores inativos (de todas as salas)
+			for id, nome := range s.salaDe {
+				player := s.salas[nome].players[id]
 				lastSeen := time.Unix(player.LastSeen, 0)
 				if now.Sub(lastSeen) > s.config.ttlPlayer {
-					fmt.Printf("[SERVER] %s Removing inactive player %s (last seen %v ago)\n",
-						time.Now().Format(time.RFC3339), id, now.Sub(lastSeen))
-					delete(s.players, id)
+					fmt.Printf("[SERVER] %s Removing inactive player %s from room %s (last seen %v ago)\n",
+						time.Now().Format(time.RFC3339), id, nome, now.Sub(lastSeen))
+					s.removerJogador(id)
+					s.encerrarSessao(id)
+					s.persistirRemocao(id)
 				}
 			}
 
-			// Limpa comandos processados antigos
-			for clientID, seqMap := range s.processedTimestamps {
-				for seq, timestamp := range seqMap {
-					if now.Sub(timestamp) > s.config.ttlProcessed {
-						delete(s.processed[clientID], seq)
-						delete(s.processedTimestamps[clientID], seq)
-					}
-				}
-				// Remove maps vazios
-				if len(s.processed[clientID]) == 0 {
-					delete(s.processed, clientID)
-					delete(s.processedTimestamps, clientID)
+			// Descarta histórico de mudanças que todos os clientes já confirmaram
+			for _, sala := range s.salas {
+				sala.podarHistorico()
+			}
+
+			// Descarta janelas de clientes sem comandos há mais de ttlProcessed
+			for clientID, j := range s.dedup {
+				if now.Sub(j.Visto) > s.config.ttlProcessed {
+					delete(s.dedup, clientID)
 				}
 			}
 
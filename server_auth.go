@@ -0,0 +1,127 @@
+// server_auth.go - Tokens de sessão emitidos no REGISTER
+//
+// O token é "<expiração unix>.<sessão>.<hmac-sha256 hex>" onde o HMAC cobre o
+// ClientID, a sessão e a expiração, assinado com o segredo do servidor. Sem
+// token válido para o ClientID, SendCommand, GetState e WatchState são
+// rejeitados, então conhecer (ou adivinhar) o ClientID de outro jogador não
+// basta para agir em nome dele.
+//
+// A sessão é um valor aleatório sorteado quando o ClientID é registrado sem
+// estar ativo e esquecido no LOGOUT e quando o jogador expira: os tokens de
+// uma sessão encerrada deixam de valer, mesmo antes de expirar, e não servem
+// para uma sessão nova com o mesmo ClientID.
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Mensagens de rejeição de autenticação (CommandReply.Message ou texto do erro RPC)
+const (
+	MsgInvalidToken      = "invalid-token"
+	MsgTokenExpired      = "token-expired"
+	MsgAlreadyRegistered = "already-registered"
+)
+
+var (
+	errTokenInvalido = errors.New(MsgInvalidToken)
+	errTokenExpirado = errors.New(MsgTokenExpired)
+)
+
+// novoSegredo gera um segredo aleatório; tokens emitidos com ele não
+// sobrevivem a um reinício do servidor
+func novoSegredo() []byte {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// carregarSegredo lê o segredo de `path` ou, se vazio, da variável GAME_SECRET.
+// Sem nenhum dos dois mantém o segredo aleatório criado em NewGameServer.
+func (s *GameServer) carregarSegredo(path string) error {
+	var segredo string
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		segredo = strings.TrimSpace(string(data))
+	} else {
+		segredo = os.Getenv("GAME_SECRET")
+	}
+	if segredo == "" {
+		fmt.Printf("[SERVER] %s No secret configured (--secret-file / GAME_SECRET); using a random one, tokens will not survive restarts\n",
+			time.Now().Format(time.RFC3339))
+		return nil
+	}
+	s.mu.Lock()
+	s.segredo = []byte(segredo)
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *GameServer) assinar(clientID, sessao string, expira int64) string {
+	mac := hmac.New(sha256.New, s.segredo)
+	fmt.Fprintf(mac, "%s|%s|%d", clientID, sessao, expira)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// iniciarSessao sorteia uma sessão nova para clientID, invalidando os tokens
+// das anteriores. Deve ser chamada com s.mu bloqueado.
+func (s *GameServer) iniciarSessao(clientID string) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	s.sessoes[clientID] = hex.EncodeToString(b)
+}
+
+// encerrarSessao invalida os tokens de clientID (LOGOUT ou jogador expirado).
+// Deve ser chamada com s.mu bloqueado.
+func (s *GameServer) encerrarSessao(clientID string) {
+	delete(s.sessoes, clientID)
+}
+
+// emitirToken cria um token da sessão atual de clientID válido por
+// config.tokenTTL. Deve ser chamada com s.mu bloqueado.
+func (s *GameServer) emitirToken(clientID string) string {
+	expira := time.Now().Add(s.config.tokenTTL).Unix()
+	sessao := s.sessoes[clientID]
+	return strconv.FormatInt(expira, 10) + "." + sessao + "." + s.assinar(clientID, sessao, expira)
+}
+
+// conferirToken valida a assinatura do token para clientID e se ele é da sessão
+// atual. Com aceitarExpirado, um token expirado mas autêntico é aceito (usado
+// para renovar via REGISTER). Deve ser chamada com s.mu bloqueado.
+func (s *GameServer) conferirToken(clientID, token string, aceitarExpirado bool) error {
+	partes := strings.SplitN(token, ".", 3)
+	if len(partes) != 3 {
+		return errTokenInvalido
+	}
+	expira, err := strconv.ParseInt(partes[0], 10, 64)
+	if err != nil {
+		return errTokenInvalido
+	}
+	sessao := partes[1]
+	if !hmac.Equal([]byte(partes[2]), []byte(s.assinar(clientID, sessao, expira))) {
+		return errTokenInvalido
+	}
+	if atual, ok := s.sessoes[clientID]; !ok || sessao != atual {
+		return errTokenInvalido
+	}
+	if !aceitarExpirado && time.Now().Unix() > expira {
+		return errTokenExpirado
+	}
+	return nil
+}
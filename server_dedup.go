@@ -0,0 +1,60 @@
+// server_dedup.go - Deduplicação exactly-once com janela deslizante de Seqs
+//
+// O RPCClient gera Seqs estritamente crescentes, então o servidor não precisa
+// lembrar todas as respostas: por cliente guarda o maior Seq já visto e as
+// respostas dos últimos `dedupWindow` Seqs. Dentro da janela, comandos fora de
+// ordem ainda não vistos são aplicados e duplicados recebem a resposta em cache;
+// abaixo da janela o comando é rejeitado com MsgSeqTooOld.
+package main
+
+import "time"
+
+// MsgSeqTooOld é a mensagem da resposta para Seqs abaixo da janela de deduplicação
+const MsgSeqTooOld = "seq-too-old"
+
+// janelaCliente é o estado de deduplicação de um cliente
+type janelaCliente struct {
+	MaiorSeq  int64                  // maior Seq já processado
+	Respostas map[int64]CommandReply // respostas dos Seqs dentro da janela
+	Visto     time.Time              // último comando processado, para o TTL
+}
+
+// verificarDuplicado devolve a resposta a reenviar, se o Seq já foi processado
+// ou está abaixo da janela. Deve ser chamada com s.mu bloqueado.
+func (s *GameServer) verificarDuplicado(clientID string, seq int64) (CommandReply, bool) {
+	j, ok := s.dedup[clientID]
+	if !ok {
+		return CommandReply{}, false
+	}
+	if prev, ok := j.Respostas[seq]; ok {
+		return prev, true
+	}
+	if seq <= j.MaiorSeq-s.config.dedupWindow {
+		return CommandReply{Seq: seq, Applied: false, Message: MsgSeqTooOld}, true
+	}
+	return CommandReply{}, false
+}
+
+// lembrarComando guarda a resposta na janela do cliente e descarta as que
+// ficaram abaixo dela. Deve ser chamada com s.mu bloqueado.
+func (s *GameServer) lembrarComando(clientID string, seq int64, cr CommandReply, quando time.Time) {
+	j, ok := s.dedup[clientID]
+	if !ok {
+		j = &janelaCliente{Respostas: make(map[int64]CommandReply)}
+		s.dedup[clientID] = j
+	}
+	j.Respostas[seq] = cr
+	if quando.After(j.Visto) {
+		j.Visto = quando
+	}
+	if seq <= j.MaiorSeq {
+		return
+	}
+	j.MaiorSeq = seq
+	limite := j.MaiorSeq - s.config.dedupWindow
+	for antigo := range j.Respostas {
+		if antigo <= limite {
+			delete(j.Respostas, antigo)
+		}
+	}
+}
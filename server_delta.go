@@ -0,0 +1,161 @@
+// server_delta.go - Histórico de mudanças e respostas delta de GetState/WatchState
+//
+// Cada sala tem sua própria versão e histórico, já que cada uma tem sua
+// própria tabela de jogadores.
+package main
+
+import (
+	"sort"
+	"time"
+)
+
+// Tipos de mudança registrados no histórico
+const (
+	mudancaAdicionado = iota
+	mudancaAtualizado
+	mudancaRemovido
+)
+
+// mudancaJogador registra que o jogador ID mudou na versão Version
+type mudancaJogador struct {
+	Version int64
+	ID      string
+	Tipo    int
+}
+
+// salvarJogador grava pi na tabela de jogadores da sala e registra a mudança.
+// Deve ser chamada com s.mu bloqueado.
+func (sala *Sala) salvarJogador(pi PlayerInfo) {
+	tipo := mudancaAtualizado
+	anterior, ok := sala.players[pi.ID]
+	if !ok {
+		tipo = mudancaAdicionado
+	} else if d := (PosicaoMapa{X: pi.X - anterior.X, Y: pi.Y - anterior.Y}); abs(d.X)+abs(d.Y) == 1 {
+		sala.direcoes[pi.ID] = d
+	}
+	sala.players[pi.ID] = pi
+	sala.registrarMudanca(pi.ID, tipo)
+}
+
+// removerJogador apaga o jogador da sala e registra a remoção.
+// Deve ser chamada com s.mu bloqueado.
+func (sala *Sala) removerJogador(id string) {
+	if _, ok := sala.players[id]; !ok {
+		return
+	}
+	delete(sala.players, id)
+	delete(sala.direcoes, id)
+	delete(sala.confirmados, id)
+	sala.registrarMudanca(id, mudancaRemovido)
+}
+
+// registrarMudanca avança a versão da sala, guarda a mudança no histórico e
+// acorda as chamadas WatchState em espera. Deve ser chamada com s.mu bloqueado.
+func (sala *Sala) registrarMudanca(id string, tipo int) {
+	sala.version++
+	sala.historico = append(sala.historico, mudancaJogador{Version: sala.version, ID: id, Tipo: tipo})
+	if excesso := len(sala.historico) - sala.limiteHist; excesso > 0 {
+		sala.descartarHistorico(excesso)
+	}
+	sala.acordar()
+}
+
+// avancarVersao marca uma mudança que não é de jogador (monstros, moedas,
+// armadilhas). Essas listas vão completas em toda resposta, então não entram
+// no histórico. Deve ser chamada com s.mu bloqueado.
+func (sala *Sala) avancarVersao() {
+	sala.version++
+	sala.acordar()
+}
+
+// acordar libera as chamadas WatchState esperando por esta sala
+func (sala *Sala) acordar() {
+	close(sala.mudou)
+	sala.mudou = make(chan struct{})
+}
+
+// descartarHistorico remove as n mudanças mais antigas; bases anteriores a
+// elas passam a receber snapshot completo
+func (sala *Sala) descartarHistorico(n int) {
+	sala.histInicio = sala.historico[n-1].Version
+	sala.historico = append(sala.historico[:0], sala.historico[n:]...)
+}
+
+// podarHistorico descarta as mudanças que todos os clientes que pedem delta
+// já confirmaram. Deve ser chamada com s.mu bloqueado.
+func (sala *Sala) podarHistorico() {
+	if len(sala.confirmados) == 0 {
+		return
+	}
+	minimo := sala.version
+	for _, v := range sala.confirmados {
+		if v < minimo {
+			minimo = v
+		}
+	}
+	n := 0
+	for n < len(sala.historico) && sala.historico[n].Version <= minimo {
+		n++
+	}
+	if n > 0 {
+		sala.descartarHistorico(n)
+	}
+}
+
+// preencherEstado copia o estado da sala para reply. Com base > 0 e histórico
+// suficiente, envia apenas os jogadores adicionados/atualizados/removidos desde
+// base; caso contrário envia o snapshot completo em Players.
+// Deve ser chamada com s.mu bloqueado.
+func (sala *Sala) preencherEstado(clientID string, base int64, reply *StateReply) {
+	reply.Room = sala.Nome
+	reply.Version = sala.version
+	reply.ServerTime = time.Now().UnixMilli()
+	reply.Monsters = sala.listaMonstros()
+	reply.Entities = sala.listaEntidades()
+
+	if base > 0 {
+		if _, ativo := sala.players[clientID]; ativo {
+			sala.confirmados[clientID] = base
+		}
+	}
+
+	if base <= 0 || base < sala.histInicio || base > sala.version {
+		// Constrói lista de jogadores ativos
+		players := make([]PlayerInfo, 0, len(sala.players))
+		for _, p := range sala.players {
+			players = append(players, p)
+		}
+		reply.Players = players
+		reply.Full = true
+		return
+	}
+
+	reply.BaseVersion = base
+	primeira := make(map[string]int)
+	ultima := make(map[string]int)
+	var ordem []string
+	for _, m := range sala.historico {
+		if m.Version <= base {
+			continue
+		}
+		if _, ok := primeira[m.ID]; !ok {
+			primeira[m.ID] = m.Tipo
+			ordem = append(ordem, m.ID)
+		}
+		ultima[m.ID] = m.Tipo
+	}
+	sort.Strings(ordem)
+	for _, id := range ordem {
+		novo := primeira[id] == mudancaAdicionado
+		switch {
+		case ultima[id] == mudancaRemovido && novo:
+			// apareceu e sumiu depois da base: o cliente nunca o viu
+		case ultima[id] == mudancaRemovido:
+			reply.Removed = append(reply.Removed, id)
+		case novo:
+			reply.Added = append(reply.Added, sala.players[id])
+		default:
+			reply.Updated = append(reply.Updated, sala.players[id])
+		}
+	}
+}
@@ -0,0 +1,217 @@
+// server_entidades.go - Moedas e armadilhas mantidas pelo servidor
+//
+// Antes cada cliente sorteava a sua moeda e as suas armadilhas, então dois
+// jogadores nunca disputavam o mesmo `$`. Agora elas pertencem à sala: COLLECT
+// entrega a moeda ao primeiro jogador que a pedir (o Seq garante exactly-once),
+// a moeda reaparece em outro lugar com ID novo e as armadilhas são
+// reposicionadas, como fazia o cliente. A lista vai em StateReply.Entities.
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// entidadeServidor é uma moeda ou armadilha de uma sala
+type entidadeServidor struct {
+	ID   string
+	Kind string
+	X, Y int
+}
+
+// criarEntidades coloca as moedas e armadilhas iniciais da sala nos
+// marcadores do mapa. Para cada tipo sem marcador, sorteia a quantidade pedida.
+func (sala *Sala) criarEntidades(moedas, armadilhas int) {
+	sala.entidades = nil
+	if sala.mapa == nil {
+		return
+	}
+	sala.posicionarEntidades(EntidadeMoeda, sala.mapa.Moedas, moedas)
+	sala.posicionarEntidades(EntidadeArmadilha, sala.mapa.Armadilhas, armadilhas)
+}
+
+// posicionarEntidades cria uma entidade em cada marcador ou, sem marcadores,
+// n entidades em células sorteadas
+func (sala *Sala) posicionarEntidades(kind string, marcadores []PosicaoMapa, n int) {
+	for _, p := range marcadores {
+		sala.novaEntidadeEm(kind, p.X, p.Y)
+	}
+	if len(marcadores) > 0 {
+		return
+	}
+	for i := 0; i < n; i++ {
+		sala.novaEntidade(kind)
+	}
+}
+
+// novaEntidade cria uma entidade do tipo kind numa célula livre sorteada
+func (sala *Sala) novaEntidade(kind string) {
+	if x, y, ok := sala.celulaLivreAleatoria(); ok {
+		sala.novaEntidadeEm(kind, x, y)
+	}
+}
+
+func (sala *Sala) novaEntidadeEm(kind string, x, y int) {
+	sala.proximaEntidade++
+	sala.entidades = append(sala.entidades, &entidadeServidor{
+		ID:   fmt.Sprintf("%s%d", kind, sala.proximaEntidade),
+		Kind: kind,
+		X:    x,
+		Y:    y,
+	})
+}
+
+// celulaLivreAleatoria sorteia uma célula livre do mapa sem jogador, monstro ou
+// outra entidade, como o sorteio de moedaLoop/moverTodasArmadilhas no cliente
+func (sala *Sala) celulaLivreAleatoria() (int, int, bool) {
+	if sala.mapa == nil || len(sala.mapa.tangivel) == 0 {
+		return 0, 0, false
+	}
+	ocupado := make(map[[2]int]bool)
+	ix, iy := sala.inicio()
+	ocupado[[2]int{ix, iy}] = true
+	for _, p := range sala.players {
+		ocupado[[2]int{p.X, p.Y}] = true
+	}
+	for _, m := range sala.monstros {
+		ocupado[[2]int{m.X, m.Y}] = true
+	}
+	for _, e := range sala.entidades {
+		ocupado[[2]int{e.X, e.Y}] = true
+	}
+	for tentativas := 0; tentativas < 200; tentativas++ {
+		y := sala.rng.Intn(len(sala.mapa.tangivel))
+		if len(sala.mapa.tangivel[y]) == 0 {
+			continue
+		}
+		x := sala.rng.Intn(len(sala.mapa.tangivel[y]))
+		if sala.mapa.PodeMoverPara(x, y) && !ocupado[[2]int{x, y}] {
+			return x, y, true
+		}
+	}
+	return 0, 0, false
+}
+
+// reposicionar tira a entidade do mapa e a recoloca numa célula livre. Sem
+// célula livre ela fica fora do mapa (-1,-1): some do StateReply até
+// recolocarForaDoMapa achar um lugar.
+func (sala *Sala) reposicionar(e *entidadeServidor) {
+	e.X, e.Y = -1, -1
+	if x, y, ok := sala.celulaLivreAleatoria(); ok {
+		e.X, e.Y = x, y
+	}
+}
+
+// recolocarForaDoMapa tenta pôr de volta as entidades que ficaram sem lugar;
+// devolve true se alguma voltou ao mapa
+func (sala *Sala) recolocarForaDoMapa() bool {
+	voltou := false
+	for _, e := range sala.entidades {
+		if e.X >= 0 {
+			continue
+		}
+		if x, y, ok := sala.celulaLivreAleatoria(); ok {
+			e.X, e.Y = x, y
+			voltou = true
+		}
+	}
+	return voltou
+}
+
+// reaparecerMoeda muda a moeda de lugar com ID novo, para que um COLLECT
+// atrasado não pegue a moeda no lugar novo
+func (sala *Sala) reaparecerMoeda(e *entidadeServidor) {
+	sala.reposicionar(e)
+	sala.proximaEntidade++
+	e.ID = fmt.Sprintf("%s%d", e.Kind, sala.proximaEntidade)
+}
+
+// moverMoedas muda todas as moedas de lugar (o timer de moedaLoop no cliente)
+func (sala *Sala) moverMoedas() {
+	for _, e := range sala.entidades {
+		if e.Kind == EntidadeMoeda {
+			sala.reaparecerMoeda(e)
+		}
+	}
+}
+
+// embaralharArmadilhas reposiciona todas as armadilhas
+func (sala *Sala) embaralharArmadilhas() {
+	for _, e := range sala.entidades {
+		if e.Kind == EntidadeArmadilha {
+			sala.reposicionar(e)
+		}
+	}
+}
+
+func (sala *Sala) entidade(id string) *entidadeServidor {
+	for _, e := range sala.entidades {
+		if e.ID == id {
+			return e
+		}
+	}
+	return nil
+}
+
+// listaEntidades copia as entidades da sala para StateReply, menos as que
+// estão fora do mapa
+func (sala *Sala) listaEntidades() []EntityInfo {
+	lista := make([]EntityInfo, 0, len(sala.entidades))
+	for _, e := range sala.entidades {
+		if e.X < 0 {
+			continue
+		}
+		lista = append(lista, EntityInfo{ID: e.ID, Kind: e.Kind, X: e.X, Y: e.Y})
+	}
+	return lista
+}
+
+// comandoColetar trata COLLECT: a moeda vai para o jogador se ele estiver na
+// posição dela; em seguida ela reaparece em outro lugar e as armadilhas mudam.
+// Deve ser chamada com s.mu bloqueado.
+func (s *GameServer) comandoColetar(args *CommandArgs, cr *CommandReply) {
+	var cp CollectPayload
+	switch p := args.Payload.(type) {
+	case CollectPayload:
+		cp = p
+	case map[string]interface{}:
+		if id, ok := p["id"].(string); ok {
+			cp.ID = id
+		}
+	}
+	pi, sala, ok := s.jogador(args.ClientID)
+	if !ok {
+		cr.Message = "not-registered"
+		return
+	}
+	cr.X, cr.Y = pi.X, pi.Y
+	moeda := sala.entidade(cp.ID)
+	if moeda == nil || moeda.Kind != EntidadeMoeda {
+		// outro jogador chegou antes (ou a moeda já mudou de lugar)
+		cr.Message = "no-such-coin"
+		fmt.Printf("[SERVER] %s COLLECT %q from %s: no such coin\n", time.Now().Format(time.RFC3339), cp.ID, args.ClientID)
+		return
+	}
+	if moeda.X != pi.X || moeda.Y != pi.Y {
+		cr.Message = "not-on-coin"
+		fmt.Printf("[SERVER] %s COLLECT %s from %s at (%d,%d): coin is at (%d,%d)\n",
+			time.Now().Format(time.RFC3339), cp.ID, args.ClientID, pi.X, pi.Y, moeda.X, moeda.Y)
+		return
+	}
+
+	pi.Coins++
+	pi.LastSeen = time.Now().Unix()
+	s.salvarJogador(sala, pi)
+	sala.reaparecerMoeda(moeda)
+	sala.embaralharArmadilhas()
+	cr.Applied = true
+	cr.Message = "collected"
+	fmt.Printf("[SERVER] %s Player %s collected coin %s (coins=%d)\n", time.Now().Format(time.RFC3339), args.ClientID, cp.ID, pi.Coins)
+}
+
+// novoRNG cria o gerador usado para sortear posições numa sala. Salas com a
+// mesma semente e o mesmo mapa começam iguais.
+func novoRNG(semente int64) *rand.Rand {
+	return rand.New(rand.NewSource(semente))
+}
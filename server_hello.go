@@ -0,0 +1,46 @@
+// server_hello.go - Handshake de versão do protocolo
+//
+// O cliente chama GameServer.Hello antes do REGISTER. A resposta diz a versão
+// do protocolo e a mais antiga que o servidor ainda aceita, o build, os
+// comandos de SendCommand, as capacidades opcionais e o checksum do mapa do
+// lobby; é o cliente quem decide se dá para jogar (ver protocoloCompativel).
+// Como o REGISTER, o Hello não exige token.
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// comandosServidor são os comandos aceitos por SendCommand
+var comandosServidor = []string{
+	"REGISTER", "MOVE", "UPDATE_POS", "LOGOUT",
+	"CREATE_ROOM", "JOIN_ROOM", "LEAVE_ROOM", "COLLECT", "RESPAWN",
+}
+
+// capacidadesServidor são as capacidades opcionais deste servidor
+var capacidadesServidor = []string{CapacidadeWatch, CapacidadeDelta, CapacidadeSalas}
+
+// Hello responde o handshake de versão. Um cliente incompatível recebe a
+// resposta mesmo assim, para poder explicar ao jogador o que houve.
+func (s *GameServer) Hello(args *HelloArgs, reply *HelloReply) error {
+	s.mu.Lock()
+	mapa := s.salas[SalaPadrao].MapFile
+	soma := s.soma
+	s.mu.Unlock()
+
+	reply.Protocol = VersaoProtocolo
+	reply.MinProtocol = VersaoProtocoloMinima
+	reply.Build = versaoBuild
+	reply.Commands = append([]string(nil), comandosServidor...)
+	reply.Capabilities = append([]string(nil), capacidadesServidor...)
+	reply.Map = mapa
+	reply.MapChecksum = soma
+
+	if err := protocoloCompativel(args.Protocol, args.MinProtocol); err != nil {
+		fmt.Printf("[SERVER] %s Hello from incompatible client %s (build %s): %v\n", time.Now().Format(time.RFC3339), args.ClientID, args.Build, err)
+		return nil
+	}
+	fmt.Printf("[SERVER] %s Hello from %s (protocol %d, build %s)\n", time.Now().Format(time.RFC3339), args.ClientID, args.Protocol, args.Build)
+	return nil
+}
@@ -0,0 +1,225 @@
+// server_http.go - Gateway JSON para ferramentas fora do Go
+//
+// O protocolo normal é net/rpc com gob, que só clientes em Go falam. Com
+// --http-port o servidor também atende JSON sobre HTTP:
+//
+//	POST /command  corpo CommandArgs em JSON, responde CommandReply
+//	GET  /state    ?client_id=&token=[&base_version=&room=], responde StateReply
+//	POST /state    corpo ClientIDArgs em JSON, responde StateReply
+//	GET  /hello    responde HelloReply
+//
+// e com --jsonrpc-port atende net/rpc/jsonrpc (GameServer.SendCommand,
+// GameServer.GetState e GameServer.Hello). Os dois chamam os mesmos métodos do
+// GameServer, então deduplicação, tokens e validação são os de sempre. Os
+// campos JSON têm os nomes dos campos Go (sem diferenciar maiúsculas). Como o
+// Payload de CommandArgs é interface{}, o gateway o lê no tipo do comando
+// (RegisterPayload no REGISTER, MovePayload no MOVE, ...) antes de chamar
+// SendCommand.
+//
+//	curl -d '{"ClientID":"c","Seq":1,"Cmd":"REGISTER","Payload":{"Name":"c"}}' localhost:8080/command
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"strconv"
+	"time"
+)
+
+// ComandoJSON é CommandArgs como chega em JSON, com o Payload ainda por ler
+type ComandoJSON struct {
+	ClientID string
+	Seq      int64
+	Cmd      string
+	Payload  json.RawMessage
+	Token    string
+}
+
+// args converte o comando em CommandArgs, lendo o Payload no tipo do comando.
+// Comandos desconhecidos seguem sem payload e o SendCommand os recusa.
+func (c ComandoJSON) args() (CommandArgs, error) {
+	args := CommandArgs{ClientID: c.ClientID, Seq: c.Seq, Cmd: c.Cmd, Token: c.Token}
+	var err error
+	switch c.Cmd {
+	case "REGISTER":
+		args.Payload, err = lerPayloadJSON[RegisterPayload](c.Payload)
+	case "MOVE":
+		args.Payload, err = lerPayloadJSON[MovePayload](c.Payload)
+	case "UPDATE_POS":
+		args.Payload, err = lerPayloadJSON[UpdatePosPayload](c.Payload)
+	case "CREATE_ROOM", "JOIN_ROOM", "LEAVE_ROOM":
+		args.Payload, err = lerPayloadJSON[RoomPayload](c.Payload)
+	case "COLLECT":
+		args.Payload, err = lerPayloadJSON[CollectPayload](c.Payload)
+	case "RESPAWN":
+		args.Payload, err = lerPayloadJSON[RespawnPayload](c.Payload)
+	}
+	if err != nil {
+		return args, fmt.Errorf("bad %s payload: %v", c.Cmd, err)
+	}
+	return args, nil
+}
+
+// lerPayloadJSON lê o payload em T; payload ausente vale o valor zero de T
+func lerPayloadJSON[T any](dados json.RawMessage) (interface{}, error) {
+	var p T
+	if len(dados) == 0 || string(dados) == "null" {
+		return p, nil
+	}
+	err := json.Unmarshal(dados, &p)
+	return p, err
+}
+
+// erroJSON é o corpo das respostas de erro do gateway HTTP
+type erroJSON struct {
+	Error string
+}
+
+// handlerHTTP devolve o handler do gateway HTTP
+func (s *GameServer) handlerHTTP() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/command", s.httpComando)
+	mux.HandleFunc("/state", s.httpEstado)
+	mux.HandleFunc("/hello", s.httpHello)
+	return mux
+}
+
+func (s *GameServer) httpComando(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		responderJSON(w, http.StatusMethodNotAllowed, erroJSON{Error: "use POST"})
+		return
+	}
+	var c ComandoJSON
+	if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+		responderJSON(w, http.StatusBadRequest, erroJSON{Error: "bad command: " + err.Error()})
+		return
+	}
+	args, err := c.args()
+	if err != nil {
+		responderJSON(w, http.StatusBadRequest, erroJSON{Error: err.Error()})
+		return
+	}
+	var reply CommandReply
+	if err := s.SendCommand(&args, &reply); err != nil {
+		responderJSON(w, http.StatusInternalServerError, erroJSON{Error: err.Error()})
+		return
+	}
+	responderJSON(w, http.StatusOK, reply)
+}
+
+func (s *GameServer) httpEstado(w http.ResponseWriter, r *http.Request) {
+	args := ClientIDArgs{Now: time.Now()}
+	switch r.Method {
+	case http.MethodGet:
+		q := r.URL.Query()
+		args.ClientID, args.Token, args.Room = q.Get("client_id"), q.Get("token"), q.Get("room")
+		if v := q.Get("base_version"); v != "" {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				responderJSON(w, http.StatusBadRequest, erroJSON{Error: "bad base_version " + strconv.Quote(v)})
+				return
+			}
+			args.BaseVersion = n
+		}
+	case http.MethodPost:
+		if err := json.NewDecoder(r.Body).Decode(&args); err != nil {
+			responderJSON(w, http.StatusBadRequest, erroJSON{Error: "bad state request: " + err.Error()})
+			return
+		}
+	default:
+		responderJSON(w, http.StatusMethodNotAllowed, erroJSON{Error: "use GET or POST"})
+		return
+	}
+	var reply StateReply
+	if err := s.GetState(&args, &reply); err != nil {
+		// GetState só falha quando o token é recusado
+		responderJSON(w, http.StatusUnauthorized, erroJSON{Error: err.Error()})
+		return
+	}
+	responderJSON(w, http.StatusOK, reply)
+}
+
+func (s *GameServer) httpHello(w http.ResponseWriter, r *http.Request) {
+	args := HelloArgs{ClientID: r.URL.Query().Get("client_id"), Protocol: VersaoProtocolo, MinProtocol: VersaoProtocoloMinima, Build: "http"}
+	var reply HelloReply
+	s.Hello(&args, &reply)
+	responderJSON(w, http.StatusOK, reply)
+}
+
+func responderJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		fmt.Printf("[SERVER] %s HTTP gateway failed to write reply: %v\n", time.Now().Format(time.RFC3339), err)
+	}
+}
+
+// gatewayJSONRPC expõe o GameServer em net/rpc/jsonrpc, com o Payload dos
+// comandos lido como no gateway HTTP
+type gatewayJSONRPC struct {
+	s *GameServer
+}
+
+func (g gatewayJSONRPC) SendCommand(c *ComandoJSON, reply *CommandReply) error {
+	args, err := c.args()
+	if err != nil {
+		return err
+	}
+	return g.s.SendCommand(&args, reply)
+}
+
+func (g gatewayJSONRPC) GetState(args *ClientIDArgs, reply *StateReply) error {
+	return g.s.GetState(args, reply)
+}
+
+func (g gatewayJSONRPC) Hello(args *HelloArgs, reply *HelloReply) error {
+	return g.s.Hello(args, reply)
+}
+
+// servirJSONRPC atende conexões JSON-RPC de l até ele ser fechado
+func (s *GameServer) servirJSONRPC(l net.Listener) {
+	srv := rpc.NewServer()
+	srv.RegisterName("GameServer", gatewayJSONRPC{s: s})
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go srv.ServeCodec(jsonrpc.NewServerCodec(conn))
+	}
+}
+
+// startGateways abre o gateway HTTP, o JSON-RPC e o WebSocket (server_ws.go)
+// nas portas configuradas (porta 0 deixa o gateway desligado)
+func (s *GameServer) startGateways() error {
+	if s.config.httpPort != 0 {
+		l, err := net.Listen("tcp", fmt.Sprintf(":%d", s.config.httpPort))
+		if err != nil {
+			return err
+		}
+		fmt.Printf("[SERVER] HTTP/JSON gateway listening on %s\n", l.Addr())
+		go http.Serve(l, s.handlerHTTP())
+	}
+	if s.config.jsonrpcPort != 0 {
+		l, err := net.Listen("tcp", fmt.Sprintf(":%d", s.config.jsonrpcPort))
+		if err != nil {
+			return err
+		}
+		fmt.Printf("[SERVER] JSON-RPC gateway listening on %s\n", l.Addr())
+		go s.servirJSONRPC(l)
+	}
+	if s.config.wsPort != 0 {
+		// só local: o WebSocket não tem TLS nem confere a origem
+		l, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", s.config.wsPort))
+		if err != nil {
+			return err
+		}
+		fmt.Printf("[SERVER] WebSocket transport listening on ws://%s/ws\n", l.Addr())
+		go http.Serve(l, s.handlerWS())
+	}
+	return nil
+}
@@ -7,13 +7,53 @@ import (
 	"log"
 	"net"
 	"net/rpc"
+	"os"
+	"os/signal"
+	"syscall"
 )
 
 // Arquivo com build tag 'server' que contém a função main para executar o servidor
 func main() {
 	// Inicializa e configura o servidor
 	gs := NewGameServer()
-	gs.parseFlags()
+	if err := gs.parseFlags(); err != nil {
+		log.Fatalf("invalid flags: %v", err)
+	}
+	if gs.config.catalog != "" {
+		if err := carregarCatalogoMonstros(gs.config.catalog); err != nil {
+			log.Fatalf("failed to load monster catalog %s: %v", gs.config.catalog, err)
+		}
+	}
+	if gs.config.exportMap != "" {
+		if err := exportarMapa(gs.config.mapFile, gs.config.exportMap); err != nil {
+			log.Fatalf("failed to export map %s: %v", gs.config.mapFile, err)
+		}
+		fmt.Printf("[SERVER] Map %s written to %s\n", gs.config.mapFile, gs.config.exportMap)
+		return
+	}
+	if err := gs.carregarMapa(gs.config.mapFile); err != nil {
+		log.Fatalf("failed to load map %s: %v", gs.config.mapFile, err)
+	}
+	if err := gs.carregarSegredo(gs.config.secretFile); err != nil {
+		log.Fatalf("failed to load secret: %v", err)
+	}
+	if gs.config.dataDir != "" {
+		if err := gs.abrirArmazenamento(gs.config.dataDir, gs.config.fsync); err != nil {
+			log.Fatalf("failed to restore state from %s: %v", gs.config.dataDir, err)
+		}
+		gs.startPersistenceRoutine(gs.config.snapshotInt)
+
+		// grava snapshot final ao receber Ctrl+C / SIGTERM
+		sinais := make(chan os.Signal, 1)
+		signal.Notify(sinais, os.Interrupt, syscall.SIGTERM)
+		go func() {
+			<-sinais
+			if err := gs.fecharArmazenamento(); err != nil {
+				fmt.Printf("[SERVER] failed to write final snapshot: %v\n", err)
+			}
+			os.Exit(0)
+		}()
+	}
 	rpc.Register(gs)
 
 	// Inicia servidor RPC
@@ -24,11 +64,17 @@ func main() {
 	}
 	defer l.Close()
 
-	fmt.Printf("[SERVER] RPC server listening on %s (ttlProcessed=%v, ttlPlayer=%v)\n",
-		addr, gs.config.ttlProcessed, gs.config.ttlPlayer)
+	fmt.Printf("[SERVER] RPC server listening on %s (ttlProcessed=%v, ttlPlayer=%v, map=%s, dataDir=%q, fsync=%s, monsters=%d, tick=%v, seed=%d)\n",
+		addr, gs.config.ttlProcessed, gs.config.ttlPlayer, gs.config.mapFile, gs.config.dataDir, gs.config.fsync, gs.config.monsters, gs.config.tick, gs.config.seed)
+
+	// gateways JSON e WebSocket opcionais (--http-port, --jsonrpc-port, --ws-port)
+	if err := gs.startGateways(); err != nil {
+		log.Fatalf("failed to start JSON gateway: %v", err)
+	}
 
-	// Inicia limpeza automática em background
+	// Inicia limpeza automática e a simulação dos monstros em background
 	gs.startCleanupRoutine()
+	gs.startSimulationRoutine(gs.config.tick)
 
 	// Aceita conexões RPC até o servidor ser encerrado
 	rpc.Accept(l)
@@ -0,0 +1,163 @@
+// server_monstros.go - Monstros simulados pelo servidor
+//
+// Antes cada cliente tinha o seu próprio monstroLoop, então cada jogador via um
+// monstro diferente perseguindo só ele. Agora os monstros pertencem à sala: uma
+// goroutine avança a simulação a cada tick, cada monstro anda um passo conforme
+// o seu comportamento (ver caminho.go), respeitando as paredes, e as posições
+// vão em StateReply.Monsters para todos os clientes da sala.
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// monstroServidor é um monstro de uma sala
+type monstroServidor struct {
+	ID      string
+	X, Y    int
+	especie EspecieMonstro
+	nav     *Navegador
+	espera  time.Duration // tempo acumulado desde o último passo
+}
+
+func novoMonstroServidor(id string, x, y int, especie EspecieMonstro, sala *Sala) *monstroServidor {
+	return &monstroServidor{ID: id, X: x, Y: y, especie: especie, nav: novoNavegador(especie, sala.rng)}
+}
+
+// criarMonstros posiciona os monstros da sala nos marcadores do mapa, cada um
+// com o tipo do marcador. Mapas sem marcadores recebem n monstros do tipo
+// padrão nas células livres mais distantes do início.
+func (sala *Sala) criarMonstros(n int) {
+	sala.monstros = nil
+	if sala.mapa == nil {
+		return
+	}
+	for i, p := range sala.mapa.Monstros {
+		sala.monstros = append(sala.monstros, novoMonstroServidor(fmt.Sprintf("m%d", i+1), p.X, p.Y, p.Especie, sala))
+	}
+	if len(sala.monstros) > 0 {
+		return
+	}
+	ocupado := make(map[[2]int]bool)
+	for i := 0; i < n; i++ {
+		x, y, ok := sala.celulaMaisDistante(ocupado)
+		if !ok {
+			return
+		}
+		ocupado[[2]int{x, y}] = true
+		sala.monstros = append(sala.monstros, novoMonstroServidor(fmt.Sprintf("m%d", i+1), x, y, especiePadrao(), sala))
+	}
+}
+
+// celulaMaisDistante devolve a célula livre (fora de `ocupado`) mais longe do
+// início do mapa, em distância de Manhattan
+func (sala *Sala) celulaMaisDistante(ocupado map[[2]int]bool) (int, int, bool) {
+	ix, iy := sala.inicio()
+	melhor, bx, by := -1, 0, 0
+	for y, linha := range sala.mapa.tangivel {
+		for x := range linha {
+			if !sala.mapa.PodeMoverPara(x, y) || ocupado[[2]int{x, y}] {
+				continue
+			}
+			if d := abs(x-ix) + abs(y-iy); d > melhor {
+				melhor, bx, by = d, x, y
+			}
+		}
+	}
+	return bx, by, melhor >= 0
+}
+
+// alvoMaisProximo devolve o jogador da sala mais perto de (x, y)
+func (sala *Sala) alvoMaisProximo(x, y int) (PlayerInfo, bool) {
+	var alvo PlayerInfo
+	melhor := -1
+	for _, p := range sala.players {
+		d := abs(p.X-x) + abs(p.Y-y)
+		// desempate pelo ID para o resultado não depender da ordem do map
+		if melhor < 0 || d < melhor || (d == melhor && p.ID < alvo.ID) {
+			alvo, melhor = p, d
+		}
+	}
+	return alvo, melhor >= 0
+}
+
+// avancarMonstros avança os monstros da sala por um tick de duração `tick`:
+// cada um dá os passos que o seu tipo permite nesse tempo. Devolve true se algum
+// se moveu. Salas sem jogadores ficam paradas. Deve ser chamada com s.mu bloqueado.
+func (sala *Sala) avancarMonstros(tick time.Duration) bool {
+	if len(sala.players) == 0 {
+		return false
+	}
+	moveu := false
+	for _, m := range sala.monstros {
+		m.espera += tick
+		for m.espera >= m.especie.Passo {
+			m.espera -= m.especie.Passo
+			alvo, _ := sala.alvoMaisProximo(m.X, m.Y)
+			prox := m.nav.Passo(sala.mapa, PosicaoMapa{X: m.X, Y: m.Y}, &Alvo{
+				Pos: PosicaoMapa{X: alvo.X, Y: alvo.Y},
+				Dir: sala.direcoes[alvo.ID],
+			})
+			if prox.X != m.X || prox.Y != m.Y {
+				m.X, m.Y = prox.X, prox.Y
+				moveu = true
+			}
+		}
+	}
+	return moveu
+}
+
+// listaMonstros copia os monstros da sala para StateReply
+func (sala *Sala) listaMonstros() []MonsterInfo {
+	lista := make([]MonsterInfo, 0, len(sala.monstros))
+	for _, m := range sala.monstros {
+		lista = append(lista, MonsterInfo{
+			ID:     m.ID,
+			X:      m.X,
+			Y:      m.Y,
+			Kind:   m.especie.Nome,
+			Symbol: string(m.especie.Simbolo),
+			Color:  m.especie.Cor,
+		})
+	}
+	return lista
+}
+
+// simularTick avança um tick da simulação em todas as salas: move os monstros,
+// recoloca as entidades que ficaram sem lugar e, a cada coinInterval, muda as
+// moedas de lugar. Uma sala com mudanças ganha versão nova, acordando os
+// WatchState em espera.
+func (s *GameServer) simularTick() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ticksMoeda := int64(0)
+	if s.config.tick > 0 {
+		ticksMoeda = int64(s.config.coinInterval / s.config.tick)
+	}
+	for _, sala := range s.salas {
+		mudou := sala.avancarMonstros(s.config.tick)
+		if sala.recolocarForaDoMapa() {
+			mudou = true
+		}
+		sala.ticks++
+		if ticksMoeda > 0 && sala.ticks%ticksMoeda == 0 && len(sala.players) > 0 {
+			sala.moverMoedas()
+			mudou = true
+		}
+		if mudou {
+			sala.avancarVersao()
+		}
+	}
+}
+
+// startSimulationRoutine inicia a goroutine que chama simularTick a cada `tick`
+func (s *GameServer) startSimulationRoutine(tick time.Duration) {
+	go func() {
+		ticker := time.NewTicker(tick)
+		defer ticker.Stop()
+		for range ticker.C {
+			s.simularTick()
+		}
+	}()
+}
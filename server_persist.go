@@ -0,0 +1,386 @@
+// server_persist.go - Persistência do cache exactly-once e da tabela de jogadores
+//
+// Cada comando aplicado é gravado num log append-only (uma linha JSON por
+// registro). Periodicamente é gravado um snapshot completo e o log é truncado.
+// Ao iniciar, o servidor carrega o snapshot e reaplica o log, de forma que um
+// SendCommand reenviado com um Seq antigo continua recebendo a resposta em cache
+// mesmo depois de um reinício. Os tokens de sessão das respostas de REGISTER
+// não vão para o disco: um REGISTER repetido depois do reinício recebe um
+// token novo. A sessão atual de cada jogador vai, para que os tokens emitidos
+// antes do reinício continuem valendo (e os de sessões encerradas, não).
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Políticas de fsync aceitas por --fsync
+const (
+	FsyncSempre    = "always"   // sync a cada registro gravado
+	FsyncIntervalo = "interval" // sync periódico (a cada segundo)
+	FsyncNunca     = "never"    // deixa a cargo do sistema operacional
+)
+
+const (
+	arquivoLog      = "commands.log"
+	arquivoSnapshot = "snapshot.json"
+)
+
+// registroLog é uma linha do log: o resultado de um comando aplicado
+// (ou a remoção de um jogador pela limpeza, quando Seq é 0)
+type registroLog struct {
+	Version  int64 // versão da sala Room após o registro
+	ClientID string
+	Seq      int64 `json:",omitempty"`
+	Reply    CommandReply
+	Time     time.Time
+	Room     string      `json:",omitempty"` // sala do jogador após o comando
+	Player   *PlayerInfo `json:",omitempty"` // estado do jogador após o comando
+	Session  string      `json:",omitempty"` // sessão atual do jogador (ver server_auth.go)
+	Removed  bool        `json:",omitempty"` // jogador deixou de existir
+	NewRoom  *RoomInfo   `json:",omitempty"` // sala criada pelo comando (CREATE_ROOM)
+}
+
+// salaSnapshot é o estado de uma sala dentro de snapshot.json
+type salaSnapshot struct {
+	MapFile    string
+	Capacidade int
+	Version    int64
+	Players    map[string]PlayerInfo
+}
+
+// snapshotServidor é o conteúdo de snapshot.json
+type snapshotServidor struct {
+	Version int64                   // maior versão entre as salas
+	Players map[string]PlayerInfo   `json:",omitempty"` // formato antigo (sem salas): jogadores do lobby
+	Salas   map[string]salaSnapshot `json:",omitempty"`
+	Dedup   map[string]*janelaCliente
+	Sessoes map[string]string `json:",omitempty"` // sessão atual de cada ClientID
+}
+
+// armazenamento mantém o log aberto; é sempre usado com GameServer.mu bloqueado
+type armazenamento struct {
+	dir       string
+	fsync     string
+	log       *os.File
+	w         *bufio.Writer
+	pendentes bool // há dados gravados ainda sem sync
+}
+
+// abrirArmazenamento carrega o snapshot e o log de dir para o servidor e abre o
+// log para novos registros. Deve ser chamada antes de aceitar conexões.
+func (s *GameServer) abrirArmazenamento(dir, fsync string) error {
+	switch fsync {
+	case FsyncSempre, FsyncIntervalo, FsyncNunca:
+	default:
+		return fmt.Errorf("invalid fsync policy %q", fsync)
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	registros, versaoSnap, err := s.carregarSnapshot(filepath.Join(dir, arquivoSnapshot))
+	if err != nil {
+		return err
+	}
+	n, versao, err := s.reaplicarLog(filepath.Join(dir, arquivoLog))
+	if err != nil {
+		return err
+	}
+	// todas as salas partem da maior versão gravada (a reaplicação avança as
+	// versões com mudanças que nenhum cliente viu); versões anteriores ao
+	// reinício não têm histórico: pedem snapshot completo
+	if versaoSnap > versao {
+		versao = versaoSnap
+	}
+	jogadores := 0
+	for _, sala := range s.salas {
+		sala.version = versao
+		sala.historico = nil
+		sala.histInicio = versao
+		jogadores += len(sala.players)
+	}
+
+	f, err := os.OpenFile(filepath.Join(dir, arquivoLog), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	s.store = &armazenamento{dir: dir, fsync: fsync, log: f, w: bufio.NewWriter(f)}
+
+	fmt.Printf("[SERVER] %s Restored %d players in %d rooms from %s (%d cached commands in snapshot, %d log records, version=%d)\n",
+		time.Now().Format(time.RFC3339), jogadores, len(s.salas), dir, registros, n, versao)
+	return nil
+}
+
+// carregarSnapshot lê snapshot.json, se existir, e devolve quantos comandos
+// em cache foram restaurados e a versão gravada
+func (s *GameServer) carregarSnapshot(path string) (int, int64, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return 0, 0, nil
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	var snap snapshotServidor
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return 0, 0, fmt.Errorf("corrupt snapshot %s: %v", path, err)
+	}
+
+	n := 0
+	for _, p := range snap.Players {
+		s.salvarJogador(s.salas[SalaPadrao], p)
+	}
+	for nome, ss := range snap.Salas {
+		sala, ok := s.salas[nome]
+		if !ok {
+			if sala, err = s.criarSala(nome, ss.MapFile, ss.Capacidade); err != nil {
+				return 0, 0, fmt.Errorf("restoring room %s: %v", nome, err)
+			}
+		}
+		for _, p := range ss.Players {
+			s.salvarJogador(sala, p)
+		}
+	}
+	for clientID, j := range snap.Dedup {
+		s.dedup[clientID] = j
+		n += len(j.Respostas)
+	}
+	for clientID, sessao := range snap.Sessoes {
+		s.sessoes[clientID] = sessao
+	}
+	return n, snap.Version, nil
+}
+
+// reaplicarLog aplica os registros gravados depois do último snapshot. Uma
+// última linha incompleta (queda no meio da escrita) é ignorada. Devolve
+// quantos registros foram aplicados e a maior versão gravada neles.
+func (s *GameServer) reaplicarLog(path string) (int, int64, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return 0, 0, nil
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	n := 0
+	var versao int64
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var reg registroLog
+		if err := json.Unmarshal(scanner.Bytes(), &reg); err != nil {
+			fmt.Printf("[SERVER] %s Ignoring truncated log record %d: %v\n", time.Now().Format(time.RFC3339), n+1, err)
+			break
+		}
+		if reg.Seq != 0 {
+			s.lembrarComando(reg.ClientID, reg.Seq, reg.Reply, reg.Time)
+		}
+		if reg.NewRoom != nil {
+			if _, existe := s.salas[reg.NewRoom.Name]; !existe {
+				if _, err := s.criarSala(reg.NewRoom.Name, reg.NewRoom.Map, reg.NewRoom.Capacity); err != nil {
+					return n, versao, fmt.Errorf("restoring room %s: %v", reg.NewRoom.Name, err)
+				}
+			}
+		}
+		if reg.Player != nil {
+			sala, ok := s.salas[reg.Room]
+			if !ok {
+				sala = s.salas[SalaPadrao]
+			}
+			s.salvarJogador(sala, *reg.Player)
+			if reg.Session != "" {
+				s.sessoes[reg.ClientID] = reg.Session
+			}
+		} else if reg.Removed {
+			s.removerJogador(reg.ClientID)
+			s.encerrarSessao(reg.ClientID)
+		}
+		if reg.Version > versao {
+			versao = reg.Version
+		}
+		n++
+	}
+	return n, versao, scanner.Err()
+}
+
+// persistirComando grava no log o resultado de um comando recém-aplicado.
+// Deve ser chamada com s.mu bloqueado.
+func (s *GameServer) persistirComando(clientID string, seq int64, cr CommandReply) {
+	cr.Token = "" // o disco não guarda tokens de sessão; ver SendCommand
+	reg := registroLog{ClientID: clientID, Seq: seq, Reply: cr, Time: time.Now()}
+	if p, sala, ok := s.jogador(clientID); ok {
+		reg.Version = sala.version
+		reg.Room = sala.Nome
+		reg.Player = &p
+		reg.Session = s.sessoes[clientID]
+	} else {
+		reg.Removed = true
+	}
+	s.gravarRegistro(reg)
+}
+
+// dedupSemTokens copia as janelas de deduplicação sem os tokens de sessão das
+// respostas de REGISTER, para o snapshot. Deve ser chamada com s.mu bloqueado.
+func (s *GameServer) dedupSemTokens() map[string]*janelaCliente {
+	copia := make(map[string]*janelaCliente, len(s.dedup))
+	for id, j := range s.dedup {
+		nova := &janelaCliente{MaiorSeq: j.MaiorSeq, Respostas: make(map[int64]CommandReply, len(j.Respostas)), Visto: j.Visto}
+		for seq, cr := range j.Respostas {
+			cr.Token = ""
+			nova.Respostas[seq] = cr
+		}
+		copia[id] = nova
+	}
+	return copia
+}
+
+// persistirSala grava no log a criação de uma sala.
+// Deve ser chamada com s.mu bloqueado.
+func (s *GameServer) persistirSala(sala *Sala) {
+	info := sala.info()
+	s.gravarRegistro(registroLog{Version: sala.version, Room: sala.Nome, Time: time.Now(), NewRoom: &info})
+}
+
+// persistirRemocao grava no log a remoção de um jogador feita pela limpeza.
+// Deve ser chamada com s.mu bloqueado.
+func (s *GameServer) persistirRemocao(id string) {
+	s.gravarRegistro(registroLog{ClientID: id, Time: time.Now(), Removed: true})
+}
+
+func (s *GameServer) gravarRegistro(reg registroLog) {
+	st := s.store
+	if st == nil {
+		return
+	}
+	data, err := json.Marshal(reg)
+	if err == nil {
+		data = append(data, '\n')
+		_, err = st.w.Write(data)
+	}
+	if err == nil {
+		err = st.w.Flush()
+	}
+	if err == nil && st.fsync == FsyncSempre {
+		err = st.log.Sync()
+	}
+	if err != nil {
+		fmt.Printf("[SERVER] %s Failed to write command log: %v\n", time.Now().Format(time.RFC3339), err)
+		return
+	}
+	st.pendentes = st.fsync == FsyncIntervalo
+}
+
+// gravarSnapshot grava o estado completo em snapshot.json (arquivo temporário +
+// rename) e trunca o log, já que todos os registros estão no snapshot.
+// Deve ser chamada com s.mu bloqueado.
+func (s *GameServer) gravarSnapshot() error {
+	st := s.store
+	if st == nil {
+		return nil
+	}
+	snap := snapshotServidor{Salas: make(map[string]salaSnapshot, len(s.salas)), Dedup: s.dedupSemTokens(), Sessoes: s.sessoes}
+	for nome, sala := range s.salas {
+		snap.Salas[nome] = salaSnapshot{MapFile: sala.MapFile, Capacidade: sala.Capacidade, Version: sala.version, Players: sala.players}
+		if sala.version > snap.Version {
+			snap.Version = sala.version
+		}
+	}
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(st.dir, arquivoSnapshot)
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if st.fsync != FsyncNunca {
+		if err := f.Sync(); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+
+	// o snapshot já contém tudo o que estava no log
+	if err := st.log.Truncate(0); err != nil {
+		return err
+	}
+	st.pendentes = false
+	return nil
+}
+
+// sincronizarLog faz fsync do log quando a política é "interval"
+func (s *GameServer) sincronizarLog() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.store == nil || !s.store.pendentes {
+		return
+	}
+	if err := s.store.log.Sync(); err != nil {
+		fmt.Printf("[SERVER] %s Failed to sync command log: %v\n", time.Now().Format(time.RFC3339), err)
+		return
+	}
+	s.store.pendentes = false
+}
+
+// startPersistenceRoutine inicia a goroutine que grava snapshots a cada
+// `intervalo` e, com --fsync=interval, faz sync do log a cada segundo
+func (s *GameServer) startPersistenceRoutine(intervalo time.Duration) {
+	go func() {
+		tickSync := time.NewTicker(1 * time.Second)
+		defer tickSync.Stop()
+		snapshot := time.NewTicker(intervalo)
+		defer snapshot.Stop()
+
+		for {
+			select {
+			case <-tickSync.C:
+				s.sincronizarLog()
+			case <-snapshot.C:
+				s.mu.Lock()
+				if err := s.gravarSnapshot(); err != nil {
+					fmt.Printf("[SERVER] %s Failed to write snapshot: %v\n", time.Now().Format(time.RFC3339), err)
+				}
+				s.mu.Unlock()
+			}
+		}
+	}()
+}
+
+// fecharArmazenamento grava um snapshot final e fecha o log
+func (s *GameServer) fecharArmazenamento() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.store == nil {
+		return nil
+	}
+	err := s.gravarSnapshot()
+	if cerr := s.store.log.Close(); err == nil {
+		err = cerr
+	}
+	s.store = nil
+	return err
+}
@@ -1,8 +1,16 @@
 package main
 
 import (
+    "encoding/json"
     "net"
+    "net/http"
+    "net/http/httptest"
     "net/rpc"
+    "net/rpc/jsonrpc"
+    "os"
+    "path/filepath"
+    "reflect"
+    "strings"
     "testing"
     "time"
 )
@@ -41,7 +49,8 @@ func TestExactlyOnceViaRPC(t *testing.T) {
         t.Fatalf("expected applied=true, got reply=%+v", reply)
     }
 
-    // reenvia mesmo comando (mesmo seq) -> deve retornar o mesmo reply
+    // reenvia mesmo comando (mesmo seq) com o token -> deve retornar o mesmo reply
+    args.Token = reply.Token
     var reply2 CommandReply
     if err := client.Call("GameServer.SendCommand", &args, &reply2); err != nil {
         t.Fatalf("SendCommand second call error: %v", err)
@@ -52,10 +61,1048 @@ func TestExactlyOnceViaRPC(t *testing.T) {
 
     // verificar GetState retorna 1 jogador
     var st StateReply
-    if err := client.Call("GameServer.GetState", &ClientIDArgs{ClientID: "test-client", Now: time.Now()}, &st); err != nil {
+    if err := client.Call("GameServer.GetState", &ClientIDArgs{ClientID: "test-client", Now: time.Now(), Token: reply.Token}, &st); err != nil {
         t.Fatalf("GetState error: %v", err)
     }
     if len(st.Players) != 1 {
         t.Fatalf("expected 1 player in state, got %d", len(st.Players))
     }
 }
+
+// TestMoveValidatedAgainstMap verifica que MOVE respeita as paredes do mapa
+// carregado pelo servidor e devolve a posição oficial
+func TestMoveValidatedAgainstMap(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "mapa.txt")
+    mapa := "▤▤▤▤\n▤☺ ▤\n▤▤▤▤\n"
+    if err := os.WriteFile(path, []byte(mapa), 0600); err != nil {
+        t.Fatalf("write map: %v", err)
+    }
+
+    gs := NewGameServer()
+    if err := gs.carregarMapa(path); err != nil {
+        t.Fatalf("carregarMapa error: %v", err)
+    }
+
+    var reply CommandReply
+    // posição inicial em parede -> servidor usa o início marcado no mapa
+    gs.SendCommand(&CommandArgs{ClientID: "c", Seq: 1, Cmd: "REGISTER", Payload: RegisterPayload{Name: "c", X: 0, Y: 0}}, &reply)
+    if reply.X != 1 || reply.Y != 1 {
+        t.Fatalf("expected spawn at (1,1), got (%d,%d)", reply.X, reply.Y)
+    }
+    token := reply.Token
+
+    gs.SendCommand(&CommandArgs{ClientID: "c", Seq: 2, Cmd: "MOVE", Payload: MovePayload{Dir: DirDireita}, Token: token}, &reply)
+    if !reply.Applied || reply.X != 2 || reply.Y != 1 {
+        t.Fatalf("expected move to (2,1), got %+v", reply)
+    }
+
+    gs.SendCommand(&CommandArgs{ClientID: "c", Seq: 3, Cmd: "MOVE", Payload: MovePayload{Dir: DirDireita}, Token: token}, &reply)
+    if reply.Applied || reply.Message != "blocked" || reply.X != 2 || reply.Y != 1 {
+        t.Fatalf("expected blocked move at (2,1), got %+v", reply)
+    }
+
+    // teleporte via UPDATE_POS é rejeitado
+    gs.SendCommand(&CommandArgs{ClientID: "c", Seq: 4, Cmd: "UPDATE_POS", Payload: UpdatePosPayload{X: 0, Y: 0}, Token: token}, &reply)
+    if reply.Applied || reply.X != 2 || reply.Y != 1 {
+        t.Fatalf("expected UPDATE_POS into wall rejected, got %+v", reply)
+    }
+
+    // REGISTER de novo não muda a posição, mesmo pedindo uma célula válida
+    gs.SendCommand(&CommandArgs{ClientID: "c", Seq: 5, Cmd: "REGISTER", Payload: RegisterPayload{Name: "c", X: 1, Y: 1}, Token: token}, &reply)
+    if !reply.Applied || reply.X != 2 || reply.Y != 1 {
+        t.Fatalf("expected re-register to keep (2,1), got %+v", reply)
+    }
+    // e o primeiro REGISTER vai para o início, não para a célula pedida
+    gs.SendCommand(&CommandArgs{ClientID: "d", Seq: 1, Cmd: "REGISTER", Payload: RegisterPayload{Name: "d", X: 2, Y: 1}}, &reply)
+    if reply.X != 1 || reply.Y != 1 {
+        t.Fatalf("expected first REGISTER at the start (1,1), got %+v", reply)
+    }
+}
+
+// TestWatchStateLongPoll verifica que WatchState responde na hora quando já há
+// versão nova, bloqueia até a próxima mudança e respeita o timeout
+func TestWatchStateLongPoll(t *testing.T) {
+    gs := NewGameServer()
+    var reply CommandReply
+    gs.SendCommand(&CommandArgs{ClientID: "a", Seq: 1, Cmd: "REGISTER", Payload: RegisterPayload{Name: "a"}}, &reply)
+    token := reply.Token
+
+    var st StateReply
+    if err := gs.WatchState(&WatchArgs{ClientID: "a", SinceVersion: 0, Token: token}, &st); err != nil {
+        t.Fatalf("WatchState error: %v", err)
+    }
+    if st.Version == 0 || len(st.Players) != 1 {
+        t.Fatalf("expected immediate state with 1 player, got %+v", st)
+    }
+    base := st.Version
+
+    // sem mudanças a chamada expira e devolve a mesma versão
+    var vazio StateReply
+    inicio := time.Now()
+    gs.WatchState(&WatchArgs{ClientID: "a", SinceVersion: base, TimeoutMS: 50, Token: token}, &vazio)
+    if vazio.Version != base || time.Since(inicio) < 50*time.Millisecond {
+        t.Fatalf("expected timeout with version %d, got %d after %v", base, vazio.Version, time.Since(inicio))
+    }
+
+    // uma mudança acorda a chamada pendente
+    done := make(chan StateReply)
+    go func() {
+        var novo StateReply
+        gs.WatchState(&WatchArgs{ClientID: "a", SinceVersion: base, TimeoutMS: 5000, Token: token}, &novo)
+        done <- novo
+    }()
+    time.Sleep(20 * time.Millisecond)
+    gs.SendCommand(&CommandArgs{ClientID: "b", Seq: 1, Cmd: "REGISTER", Payload: RegisterPayload{Name: "b"}}, &reply)
+    select {
+    case novo := <-done:
+        if novo.Version <= base || len(novo.Players) != 2 {
+            t.Fatalf("expected newer state with 2 players, got %+v", novo)
+        }
+    case <-time.After(2 * time.Second):
+        t.Fatalf("WatchState did not wake up after a change")
+    }
+}
+
+// TestGetStateDelta verifica que, a partir de uma versão base, o servidor envia
+// apenas adicionados/atualizados/removidos e cai para snapshot quando a base é velha
+func TestGetStateDelta(t *testing.T) {
+    gs := NewGameServer()
+    gs.salas[SalaPadrao].limiteHist = 3
+    var reply CommandReply
+    gs.SendCommand(&CommandArgs{ClientID: "a", Seq: 1, Cmd: "REGISTER", Payload: RegisterPayload{Name: "a"}}, &reply)
+    tokenA := reply.Token
+    gs.SendCommand(&CommandArgs{ClientID: "b", Seq: 1, Cmd: "REGISTER", Payload: RegisterPayload{Name: "b"}}, &reply)
+    tokenB := reply.Token
+
+    var full StateReply
+    gs.GetState(&ClientIDArgs{ClientID: "a", Token: tokenA}, &full)
+    if !full.Full || len(full.Players) != 2 {
+        t.Fatalf("expected full snapshot with 2 players, got %+v", full)
+    }
+
+    gs.SendCommand(&CommandArgs{ClientID: "a", Seq: 2, Cmd: "MOVE", Payload: MovePayload{Dir: DirDireita}, Token: tokenA}, &reply)
+    gs.SendCommand(&CommandArgs{ClientID: "c", Seq: 1, Cmd: "REGISTER", Payload: RegisterPayload{Name: "c"}}, &reply)
+    gs.SendCommand(&CommandArgs{ClientID: "b", Seq: 2, Cmd: "LOGOUT", Token: tokenB}, &reply)
+
+    var delta StateReply
+    gs.GetState(&ClientIDArgs{ClientID: "a", BaseVersion: full.Version, Token: tokenA}, &delta)
+    if delta.Full || delta.BaseVersion != full.Version {
+        t.Fatalf("expected delta from %d, got %+v", full.Version, delta)
+    }
+    if len(delta.Added) != 1 || delta.Added[0].ID != "c" {
+        t.Fatalf("expected c added, got %+v", delta.Added)
+    }
+    if len(delta.Updated) != 1 || delta.Updated[0].ID != "a" || delta.Updated[0].X != 1 {
+        t.Fatalf("expected a updated to x=1, got %+v", delta.Updated)
+    }
+    if len(delta.Removed) != 1 || delta.Removed[0] != "b" {
+        t.Fatalf("expected b removed, got %+v", delta.Removed)
+    }
+
+    // histórico limitado a 3 mudanças: a base 1 já não pode gerar delta
+    var velho StateReply
+    gs.GetState(&ClientIDArgs{ClientID: "a", BaseVersion: 1, Token: tokenA}, &velho)
+    if !velho.Full || len(velho.Players) != 2 {
+        t.Fatalf("expected full snapshot for too-old base, got %+v", velho)
+    }
+}
+
+// TestExactlyOnceSurvivesRestart verifica que o cache de deduplicação e os
+// jogadores são restaurados do disco (snapshot + log) por um novo servidor
+func TestExactlyOnceSurvivesRestart(t *testing.T) {
+    dir := t.TempDir()
+
+    gs := NewGameServer()
+    if err := gs.abrirArmazenamento(dir, FsyncSempre); err != nil {
+        t.Fatalf("abrirArmazenamento error: %v", err)
+    }
+    defer gs.fecharArmazenamento()
+    var reply CommandReply
+    gs.SendCommand(&CommandArgs{ClientID: "c", Seq: 1, Cmd: "REGISTER", Payload: RegisterPayload{Name: "c"}}, &reply)
+    token := reply.Token
+    gs.mu.Lock()
+    if err := gs.gravarSnapshot(); err != nil {
+        t.Fatalf("gravarSnapshot error: %v", err)
+    }
+    gs.mu.Unlock()
+    var moved CommandReply
+    gs.SendCommand(&CommandArgs{ClientID: "c", Seq: 2, Cmd: "MOVE", Payload: MovePayload{Dir: DirDireita}, Token: token}, &moved)
+
+    // simula queda: o segundo servidor lê snapshot (seq 1) + log (seq 2)
+    gs2 := NewGameServer()
+    gs2.segredo = gs.segredo // mesmo segredo, como com --secret-file
+    if err := gs2.abrirArmazenamento(dir, FsyncSempre); err != nil {
+        t.Fatalf("reopen error: %v", err)
+    }
+    defer gs2.fecharArmazenamento()
+    var again CommandReply
+    gs2.SendCommand(&CommandArgs{ClientID: "c", Seq: 2, Cmd: "MOVE", Payload: MovePayload{Dir: DirDireita}, Token: token}, &again)
+    if again != moved {
+        t.Fatalf("expected cached reply %+v after restart, got %+v", moved, again)
+    }
+
+    // o token não vai para o disco; o REGISTER repetido recebe um novo
+    for _, nome := range []string{arquivoLog, arquivoSnapshot} {
+        data, _ := os.ReadFile(filepath.Join(dir, nome))
+        if strings.Contains(string(data), token) {
+            t.Fatalf("expected no session token in %s", nome)
+        }
+    }
+    var reg CommandReply
+    gs2.SendCommand(&CommandArgs{ClientID: "c", Seq: 1, Cmd: "REGISTER", Payload: RegisterPayload{Name: "c"}, Token: token}, &reg)
+    gs2.mu.Lock()
+    err := gs2.conferirToken("c", reg.Token, false)
+    gs2.mu.Unlock()
+    if !reg.Applied || err != nil {
+        t.Fatalf("expected replayed REGISTER with a fresh token, got %+v (%v)", reg, err)
+    }
+
+    var st StateReply
+    gs2.GetState(&ClientIDArgs{ClientID: "c", Token: token}, &st)
+    if len(st.Players) != 1 || st.Players[0].X != 1 {
+        t.Fatalf("expected restored player at x=1 (move applied once), got %+v", st.Players)
+    }
+}
+
+// TestDedupWindowOutOfOrder verifica a janela deslizante: Seqs fora de ordem
+// dentro da janela são aplicados uma vez, duplicados devolvem a resposta em
+// cache e Seqs abaixo da janela são rejeitados com MsgSeqTooOld
+func TestDedupWindowOutOfOrder(t *testing.T) {
+    gs := NewGameServer()
+    gs.config.dedupWindow = 4
+
+    token := ""
+    send := func(seq int64, cmd string, payload interface{}) CommandReply {
+        var r CommandReply
+        if err := gs.SendCommand(&CommandArgs{ClientID: "c", Seq: seq, Cmd: cmd, Payload: payload, Token: token}, &r); err != nil {
+            t.Fatalf("SendCommand seq=%d error: %v", seq, err)
+        }
+        return r
+    }
+    right := MovePayload{Dir: DirDireita}
+
+    token = send(1, "REGISTER", RegisterPayload{Name: "c"}).Token
+    // seq 3 chega antes do 2
+    r3 := send(3, "MOVE", right)
+    r2 := send(2, "MOVE", right)
+    if !r2.Applied || !r3.Applied || r3.X != 1 || r2.X != 2 {
+        t.Fatalf("expected out-of-order seqs applied once each, got %+v and %+v", r2, r3)
+    }
+
+    // duplicado dentro da janela: mesma resposta, sem reaplicar
+    if dup := send(2, "MOVE", right); dup != r2 {
+        t.Fatalf("expected cached reply %+v, got %+v", r2, dup)
+    }
+
+    // avança a janela: maior seq 8, janela 4 -> seqs <= 4 ficam de fora
+    send(8, "MOVE", right)
+    if old := send(3, "MOVE", right); old.Applied || old.Message != MsgSeqTooOld {
+        t.Fatalf("expected %s for seq below window, got %+v", MsgSeqTooOld, old)
+    }
+    // seq 6 nunca visto, ainda dentro da janela: aplicado
+    if r6 := send(6, "MOVE", right); !r6.Applied || r6.X != 4 {
+        t.Fatalf("expected seq 6 applied inside window, got %+v", r6)
+    }
+
+    gs.mu.Lock()
+    n := len(gs.dedup["c"].Respostas)
+    gs.mu.Unlock()
+    if n > int(gs.config.dedupWindow) {
+        t.Fatalf("expected at most %d cached replies, got %d", gs.config.dedupWindow, n)
+    }
+}
+
+// TestSessionTokens verifica que comandos e GetState exigem o token emitido no
+// REGISTER e que outro processo não toma a sessão de um ClientID ativo
+func TestSessionTokens(t *testing.T) {
+    gs := NewGameServer()
+    var reg CommandReply
+    gs.SendCommand(&CommandArgs{ClientID: "alice", Seq: 1, Cmd: "REGISTER", Payload: RegisterPayload{Name: "alice"}}, &reg)
+    if !reg.Applied || reg.Token == "" {
+        t.Fatalf("expected token from REGISTER, got %+v", reg)
+    }
+
+    // sem token ou com token de outro cliente: rejeitado
+    var r CommandReply
+    gs.SendCommand(&CommandArgs{ClientID: "alice", Seq: 2, Cmd: "LOGOUT"}, &r)
+    if r.Applied || r.Message != MsgInvalidToken {
+        t.Fatalf("expected %s without token, got %+v", MsgInvalidToken, r)
+    }
+    var bob CommandReply
+    gs.SendCommand(&CommandArgs{ClientID: "bob", Seq: 1, Cmd: "REGISTER", Payload: RegisterPayload{Name: "bob"}}, &bob)
+    gs.SendCommand(&CommandArgs{ClientID: "alice", Seq: 3, Cmd: "LOGOUT", Token: bob.Token}, &r)
+    if r.Applied || r.Message != MsgInvalidToken {
+        t.Fatalf("expected %s with another client's token, got %+v", MsgInvalidToken, r)
+    }
+    if err := gs.GetState(&ClientIDArgs{ClientID: "alice"}, &StateReply{}); err == nil {
+        t.Fatalf("expected GetState without token to fail")
+    }
+
+    // registrar de novo um ClientID ativo exige o token dele
+    gs.SendCommand(&CommandArgs{ClientID: "alice", Seq: 4, Cmd: "REGISTER", Payload: RegisterPayload{Name: "mallory"}}, &r)
+    if r.Applied || r.Message != MsgAlreadyRegistered {
+        t.Fatalf("expected %s when hijacking, got %+v", MsgAlreadyRegistered, r)
+    }
+
+    // token expirado: comandos rejeitados, mas serve para renovar via REGISTER
+    gs.config.tokenTTL = -time.Minute
+    var expirado CommandReply
+    gs.SendCommand(&CommandArgs{ClientID: "alice", Seq: 5, Cmd: "REGISTER", Payload: RegisterPayload{Name: "alice"}, Token: reg.Token}, &expirado)
+    gs.SendCommand(&CommandArgs{ClientID: "alice", Seq: 6, Cmd: "LOGOUT", Token: expirado.Token}, &r)
+    if r.Applied || r.Message != MsgTokenExpired {
+        t.Fatalf("expected %s, got %+v", MsgTokenExpired, r)
+    }
+    // o reenvio de um comando já processado recebe a resposta em cache mesmo
+    // com o token expirado
+    gs.config.tokenTTL = time.Hour
+    var feito, reenvio CommandReply
+    gs.SendCommand(&CommandArgs{ClientID: "bob", Seq: 2, Cmd: "MOVE", Payload: MovePayload{Dir: DirDireita}, Token: bob.Token}, &feito)
+    gs.mu.Lock()
+    vencido := "1." + gs.sessoes["bob"] + "." + gs.assinar("bob", gs.sessoes["bob"], 1)
+    gs.mu.Unlock()
+    gs.SendCommand(&CommandArgs{ClientID: "bob", Seq: 2, Cmd: "MOVE", Payload: MovePayload{Dir: DirDireita}, Token: vencido}, &reenvio)
+    if !feito.Applied || reenvio != feito {
+        t.Fatalf("expected cached reply %+v for retry with expired token, got %+v", feito, reenvio)
+    }
+    gs.SendCommand(&CommandArgs{ClientID: "bob", Seq: 3, Cmd: "MOVE", Payload: MovePayload{Dir: DirDireita}, Token: vencido}, &r)
+    if r.Applied || r.Message != MsgTokenExpired {
+        t.Fatalf("expected %s for new command with expired token, got %+v", MsgTokenExpired, r)
+    }
+
+    var renovado CommandReply
+    gs.SendCommand(&CommandArgs{ClientID: "alice", Seq: 7, Cmd: "REGISTER", Payload: RegisterPayload{Name: "alice"}, Token: expirado.Token}, &renovado)
+    if !renovado.Applied {
+        t.Fatalf("expected re-register with expired token to succeed, got %+v", renovado)
+    }
+    gs.SendCommand(&CommandArgs{ClientID: "alice", Seq: 8, Cmd: "LOGOUT", Token: renovado.Token}, &r)
+    if !r.Applied {
+        t.Fatalf("expected LOGOUT with renewed token to succeed, got %+v", r)
+    }
+}
+
+// TestTokenRevokedOnLogout verifica que o LOGOUT invalida os tokens da sessão,
+// mesmo antes de expirarem, e que eles não valem para uma sessão nova do
+// mesmo ClientID
+func TestTokenRevokedOnLogout(t *testing.T) {
+    gs := NewGameServer()
+    var reg, r CommandReply
+    gs.SendCommand(&CommandArgs{ClientID: "alice", Seq: 1, Cmd: "REGISTER", Payload: RegisterPayload{Name: "alice"}}, &reg)
+    gs.SendCommand(&CommandArgs{ClientID: "alice", Seq: 2, Cmd: "LOGOUT", Token: reg.Token}, &r)
+    if !r.Applied {
+        t.Fatalf("expected LOGOUT applied, got %+v", r)
+    }
+    if err := gs.GetState(&ClientIDArgs{ClientID: "alice", Token: reg.Token}, &StateReply{}); err == nil {
+        t.Fatalf("expected GetState with a logged-out token to fail")
+    }
+
+    // nova sessão com o mesmo ClientID: o token antigo continua inválido
+    var nova CommandReply
+    gs.SendCommand(&CommandArgs{ClientID: "alice", Seq: 3, Cmd: "REGISTER", Payload: RegisterPayload{Name: "alice"}}, &nova)
+    if !nova.Applied || nova.Token == reg.Token {
+        t.Fatalf("expected a new session token, got %+v", nova)
+    }
+    gs.SendCommand(&CommandArgs{ClientID: "alice", Seq: 4, Cmd: "MOVE", Payload: MovePayload{Dir: DirDireita}, Token: reg.Token}, &r)
+    if r.Applied || r.Message != MsgInvalidToken {
+        t.Fatalf("expected %s for the previous session's token, got %+v", MsgInvalidToken, r)
+    }
+    gs.SendCommand(&CommandArgs{ClientID: "alice", Seq: 4, Cmd: "MOVE", Payload: MovePayload{Dir: DirDireita}, Token: nova.Token}, &r)
+    if !r.Applied {
+        t.Fatalf("expected MOVE with the new token applied, got %+v", r)
+    }
+}
+
+// TestRegisterWithoutTokenSkipsDedup verifica que um REGISTER sem o token do
+// ClientID não recebe a resposta em cache do dono (com o token da sessão) nem
+// avança a janela de deduplicação dele
+func TestRegisterWithoutTokenSkipsDedup(t *testing.T) {
+    gs := NewGameServer()
+    var reg CommandReply
+    gs.SendCommand(&CommandArgs{ClientID: "alice", Seq: 1, Cmd: "REGISTER", Payload: RegisterPayload{Name: "alice"}}, &reg)
+    if !reg.Applied || reg.Token == "" {
+        t.Fatalf("expected token from REGISTER, got %+v", reg)
+    }
+
+    // mesmo Seq do REGISTER da vítima: nada de resposta em cache
+    var r CommandReply
+    gs.SendCommand(&CommandArgs{ClientID: "alice", Seq: 1, Cmd: "REGISTER", Payload: RegisterPayload{Name: "mallory"}}, &r)
+    if r.Applied || r.Token != "" || r.Message != MsgAlreadyRegistered {
+        t.Fatalf("expected %s without a token for replayed REGISTER, got %+v", MsgAlreadyRegistered, r)
+    }
+
+    // Seq enorme: recusado sem entrar na janela
+    gs.SendCommand(&CommandArgs{ClientID: "alice", Seq: 1 << 40, Cmd: "REGISTER", Payload: RegisterPayload{Name: "mallory"}}, &r)
+    if r.Applied || r.Message != MsgAlreadyRegistered {
+        t.Fatalf("expected %s for REGISTER with huge seq, got %+v", MsgAlreadyRegistered, r)
+    }
+    gs.SendCommand(&CommandArgs{ClientID: "alice", Seq: 2, Cmd: "MOVE", Payload: MovePayload{Dir: DirDireita}, Token: reg.Token}, &r)
+    if !r.Applied {
+        t.Fatalf("expected the owner's next command applied, got %+v", r)
+    }
+    gs.mu.Lock()
+    maior := gs.dedup["alice"].MaiorSeq
+    gs.mu.Unlock()
+    if maior != 2 {
+        t.Fatalf("expected dedup window at seq 2, got %d", maior)
+    }
+}
+
+// TestRooms verifica que cada sala tem sua própria tabela de jogadores, que
+// GetState só mostra a sala de quem chama e que a capacidade é respeitada
+func TestRooms(t *testing.T) {
+    gs := NewGameServer()
+    tokens := map[string]string{}
+    seqs := map[string]int64{}
+    send := func(id, cmd string, payload interface{}) CommandReply {
+        seqs[id]++
+        var r CommandReply
+        gs.SendCommand(&CommandArgs{ClientID: id, Seq: seqs[id], Cmd: cmd, Payload: payload, Token: tokens[id]}, &r)
+        if r.Token != "" {
+            tokens[id] = r.Token
+        }
+        return r
+    }
+    for _, id := range []string{"a", "b", "c"} {
+        send(id, "REGISTER", RegisterPayload{Name: id})
+    }
+
+    if r := send("a", "CREATE_ROOM", RoomPayload{Name: "arena", Capacity: 2}); !r.Applied {
+        t.Fatalf("expected CREATE_ROOM applied, got %+v", r)
+    }
+    if _, sala, _ := gs.jogador("a"); sala == nil || sala.Nome != "arena" {
+        t.Fatalf("expected creator to join the new room, got %+v", sala)
+    }
+    if r := send("b", "CREATE_ROOM", map[string]interface{}{"name": "arena"}); r.Applied || r.Message != "room-exists" {
+        t.Fatalf("expected room-exists, got %+v", r)
+    }
+    if r := send("a", "JOIN_ROOM", RoomPayload{Name: "nowhere"}); r.Message != "no-such-room" {
+        t.Fatalf("expected no-such-room, got %+v", r)
+    }
+    send("a", "JOIN_ROOM", RoomPayload{Name: "arena"})
+    send("b", "JOIN_ROOM", map[string]interface{}{"name": "arena"})
+    if r := send("c", "JOIN_ROOM", RoomPayload{Name: "arena"}); r.Applied || r.Message != "room-full" {
+        t.Fatalf("expected room-full, got %+v", r)
+    }
+
+    var st StateReply
+    gs.GetState(&ClientIDArgs{ClientID: "a", Token: tokens["a"]}, &st)
+    if st.Room != "arena" || len(st.Players) != 2 {
+        t.Fatalf("expected 2 players in arena, got room=%s players=%+v", st.Room, st.Players)
+    }
+    var lobby StateReply
+    gs.GetState(&ClientIDArgs{ClientID: "c", Token: tokens["c"]}, &lobby)
+    if lobby.Room != SalaPadrao || len(lobby.Players) != 1 || lobby.Players[0].ID != "c" {
+        t.Fatalf("expected only c in lobby, got room=%s players=%+v", lobby.Room, lobby.Players)
+    }
+
+    var lista RoomListReply
+    gs.ListRooms(&ClientIDArgs{ClientID: "c"}, &lista)
+    if len(lista.Rooms) != 2 || lista.Rooms[0].Name != "arena" || lista.Rooms[0].Players != 2 {
+        t.Fatalf("unexpected room list %+v", lista.Rooms)
+    }
+
+    // uma versão base de outra sala recebe snapshot completo
+    send("a", "LEAVE_ROOM", nil)
+    var depois StateReply
+    gs.GetState(&ClientIDArgs{ClientID: "a", Token: tokens["a"], BaseVersion: st.Version, Room: "arena"}, &depois)
+    if !depois.Full || depois.Room != SalaPadrao || len(depois.Players) != 2 {
+        t.Fatalf("expected full lobby snapshot after leaving, got %+v", depois)
+    }
+
+    // sala criada some quando o último jogador sai
+    send("b", "LOGOUT", nil)
+    gs.mu.Lock()
+    _, aberta := gs.salas["arena"]
+    gs.mu.Unlock()
+    if aberta {
+        t.Fatalf("expected empty room to be closed")
+    }
+
+    // limite de salas abertas
+    gs.config.maxRooms = 1
+    send("a", "CREATE_ROOM", RoomPayload{Name: "um"})
+    if r := send("c", "CREATE_ROOM", RoomPayload{Name: "dois"}); r.Applied || r.Message != "too-many-rooms" {
+        t.Fatalf("expected too-many-rooms, got %+v", r)
+    }
+}
+
+// TestCreateRoomDefaultMapPath verifica que o mapa padrão das salas é lido no
+// caminho configurado, mesmo fora do diretório do servidor
+func TestCreateRoomDefaultMapPath(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "lobby-fora.txt")
+    if err := os.WriteFile(path, []byte("▤▤▤▤\n▤☺ ▤\n▤▤▤▤\n"), 0600); err != nil {
+        t.Fatalf("write map: %v", err)
+    }
+    gs := NewGameServer()
+    if err := gs.carregarMapa(path); err != nil {
+        t.Fatalf("carregarMapa error: %v", err)
+    }
+    var reg, r CommandReply
+    gs.SendCommand(&CommandArgs{ClientID: "a", Seq: 1, Cmd: "REGISTER", Payload: RegisterPayload{Name: "a"}}, &reg)
+    gs.SendCommand(&CommandArgs{ClientID: "a", Seq: 2, Cmd: "CREATE_ROOM", Payload: RoomPayload{Name: "arena"}, Token: reg.Token}, &r)
+    if !r.Applied || r.X != 1 || r.Y != 1 {
+        t.Fatalf("expected room created on the lobby map with a at (1,1), got %+v", r)
+    }
+}
+
+// TestMonstersChaseNearestPlayer verifica que os monstros do servidor andam em
+// TestMonstersChaseNearestPlayer verifica que o monstro da sala contorna as
+// paredes pelo menor caminho e troca de alvo quando outro jogador fica mais perto
+func TestMonstersChaseNearestPlayer(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "mapa.txt")
+    mapa := "▤▤▤▤▤▤▤\n▤☺    ▤\n▤▤▤▤▤ ▤\n▤     ▤\n▤▤▤▤▤▤▤\n"
+    if err := os.WriteFile(path, []byte(mapa), 0600); err != nil {
+        t.Fatalf("write map: %v", err)
+    }
+    gs := NewGameServer()
+    gs.config.tick = time.Second // um passo do tipo padrão por tick
+    if err := gs.carregarMapa(path); err != nil {
+        t.Fatalf("carregarMapa error: %v", err)
+    }
+
+    // sem jogadores o monstro fica parado
+    gs.simularTick()
+    var reply CommandReply
+    gs.SendCommand(&CommandArgs{ClientID: "a", Seq: 1, Cmd: "REGISTER", Payload: RegisterPayload{Name: "a", X: 1, Y: 1}}, &reply)
+    token := reply.Token
+    var st StateReply
+    gs.GetState(&ClientIDArgs{ClientID: "a", Token: token}, &st)
+    if len(st.Monsters) != 1 || st.Monsters[0].X != 5 || st.Monsters[0].Y != 3 {
+        t.Fatalf("expected monster spawned at (5,3), got %+v", st.Monsters)
+    }
+
+    // andar em direção a `a` pela linha de baixo leva a um beco: o caminho
+    // sobe pela coluna da direita
+    gs.simularTick()
+    var st2 StateReply
+    gs.GetState(&ClientIDArgs{ClientID: "a", Token: token}, &st2)
+    if st2.Monsters[0].X != 5 || st2.Monsters[0].Y != 2 || st2.Version <= st.Version {
+        t.Fatalf("expected monster at (5,2) with new version, got %+v version=%d", st2.Monsters, st2.Version)
+    }
+    gs.simularTick()
+    gs.GetState(&ClientIDArgs{ClientID: "a", Token: token}, &st)
+    if st.Monsters[0].X != 5 || st.Monsters[0].Y != 1 {
+        t.Fatalf("expected monster at (5,1), got %+v", st.Monsters)
+    }
+
+    // b está mais perto: o monstro muda de alvo e volta pela coluna
+    gs.mu.Lock()
+    gs.salvarJogador(gs.salas[SalaPadrao], PlayerInfo{ID: "b", X: 4, Y: 3, Lives: VidasIniciais, LastSeen: time.Now().Unix()})
+    gs.mu.Unlock()
+    gs.simularTick()
+    gs.GetState(&ClientIDArgs{ClientID: "a", Token: token}, &st)
+    if st.Monsters[0].X != 5 || st.Monsters[0].Y != 2 {
+        t.Fatalf("expected monster chasing b at (5,2), got %+v", st.Monsters)
+    }
+}
+
+// TestMonsterPatrol verifica o comportamento declarado na legenda: o monstro
+// patrulha o corredor, indo e voltando, mesmo sem alcançar o jogador
+func TestMonsterPatrol(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "mapa.txt")
+    mapa := "@P monstro comportamento=patrulhar\n" +
+        "▤▤▤▤▤▤▤▤▤▤▤▤▤▤▤▤▤▤▤▤\n" +
+        "▤☺▤P             ▤\n" +
+        "▤▤▤▤▤▤▤▤▤▤▤▤▤▤▤▤▤▤▤▤\n"
+    if err := os.WriteFile(path, []byte(mapa), 0600); err != nil {
+        t.Fatalf("write map: %v", err)
+    }
+    gs := NewGameServer()
+    gs.config.tick = time.Second // um passo do tipo padrão por tick
+    if err := gs.carregarMapa(path); err != nil {
+        t.Fatalf("carregarMapa error: %v", err)
+    }
+    var reply CommandReply
+    gs.SendCommand(&CommandArgs{ClientID: "a", Seq: 1, Cmd: "REGISTER", Payload: RegisterPayload{Name: "a"}}, &reply)
+
+    monstro := gs.salas[SalaPadrao].monstros[0]
+    if monstro.nav.Comportamento != ComportamentoPatrulhar {
+        t.Fatalf("expected patrol from the legend, got %q", monstro.nav.Comportamento)
+    }
+    // rota padrão: do marcador (3,1) até a célula mais distante a 12 passos (15,1)
+    for i := 0; i < 12; i++ {
+        gs.simularTick()
+    }
+    if monstro.X != 15 || monstro.Y != 1 {
+        t.Fatalf("expected monster at the end of the patrol (15,1), got (%d,%d)", monstro.X, monstro.Y)
+    }
+    gs.simularTick()
+    gs.simularTick()
+    if monstro.X != 13 || monstro.Y != 1 {
+        t.Fatalf("expected monster walking back at (13,1), got (%d,%d)", monstro.X, monstro.Y)
+    }
+}
+
+// TestMonsterCatalog verifica os tipos do catálogo: velocidade própria,
+// fantasma que atravessa paredes, emboscador que mira à frente do jogador e
+// tipos extras lidos de um arquivo
+func TestMonsterCatalog(t *testing.T) {
+    defer func() { catalogoMonstros = catalogoPadrao() }()
+    dir := t.TempDir()
+    catalogo := filepath.Join(dir, "monstros.txt")
+    if err := os.WriteFile(catalogo, []byte("# tipos extras\nlento simbolo=L passo=2s\n"), 0600); err != nil {
+        t.Fatalf("write catalog: %v", err)
+    }
+    if err := carregarCatalogoMonstros(catalogo); err != nil {
+        t.Fatalf("carregarCatalogoMonstros error: %v", err)
+    }
+
+    path := filepath.Join(dir, "mapa.txt")
+    mapa := "@F monstro tipo=fantasma passo=1s\n" +
+        "▤▤▤▤▤▤▤▤▤▤\n" +
+        "▤☺     ЖL▤\n" +
+        "▤▤▤▤▤▤▤▤▤▤\n" +
+        "▤      ▤F▤\n" +
+        "▤▤▤▤▤▤▤▤▤▤\n"
+    if err := os.WriteFile(path, []byte(mapa), 0600); err != nil {
+        t.Fatalf("write map: %v", err)
+    }
+    gs := NewGameServer()
+    gs.config.tick = 250 * time.Millisecond
+    if err := gs.carregarMapa(path); err != nil {
+        t.Fatalf("carregarMapa error: %v", err)
+    }
+    var reply CommandReply
+    gs.SendCommand(&CommandArgs{ClientID: "a", Seq: 1, Cmd: "REGISTER", Payload: RegisterPayload{Name: "a"}}, &reply)
+
+    // um segundo de simulação
+    for i := 0; i < 4; i++ {
+        gs.simularTick()
+    }
+    var st StateReply
+    gs.GetState(&ClientIDArgs{ClientID: "a", Token: reply.Token}, &st)
+    monstros := map[string]MonsterInfo{}
+    for _, m := range st.Monsters {
+        monstros[m.Kind] = m
+    }
+    if m := monstros["corredor"]; m.X != 5 || m.Y != 1 || m.Symbol != "Ж" {
+        t.Fatalf("expected the runner two steps ahead at (5,1), got %+v", m)
+    }
+    if m := monstros["fantasma"]; m.Symbol != "F" || abs(m.X-1)+abs(m.Y-1) != 8 {
+        t.Fatalf("expected the ghost one step out of its walled cell, got %+v", m)
+    }
+    if m := monstros["lento"]; m.X != 8 || m.Y != 1 || m.Symbol != "L" {
+        t.Fatalf("expected the slow monster still at (8,1), got %+v", m)
+    }
+
+    // o emboscador mira 4 casas à frente do jogador que anda para a direita
+    especie, _ := especieMonstro("emboscador")
+    nav := novoNavegador(especie, nil)
+    alvo := &Alvo{Pos: PosicaoMapa{X: 1, Y: 1}, Dir: PosicaoMapa{X: 1, Y: 0}}
+    if p := nav.mira(gs.salas[SalaPadrao].mapa, PosicaoMapa{X: 8, Y: 1}, alvo); p != (PosicaoMapa{X: 5, Y: 1}) {
+        t.Fatalf("expected the ambusher to aim at (5,1), got %+v", p)
+    }
+}
+
+// TestCollectCoinOnce verifica que COLLECT entrega a moeda só ao primeiro
+// jogador, que o reenvio do mesmo Seq não conta duas vezes e que a moeda reaparece
+func TestCollectCoinOnce(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "mapa.txt")
+    mapa := "▤▤▤▤▤▤\n▤☺   ▤\n▤▤▤▤▤▤\n"
+    if err := os.WriteFile(path, []byte(mapa), 0600); err != nil {
+        t.Fatalf("write map: %v", err)
+    }
+    gs := NewGameServer()
+    gs.config.monsters = 0
+    gs.config.traps = 0
+    if err := gs.carregarMapa(path); err != nil {
+        t.Fatalf("carregarMapa error: %v", err)
+    }
+    lobby := gs.salas[SalaPadrao]
+    lobby.entidades = []*entidadeServidor{{ID: "c", Kind: EntidadeMoeda, X: 2, Y: 1}}
+
+    var ra, rb CommandReply
+    gs.SendCommand(&CommandArgs{ClientID: "a", Seq: 1, Cmd: "REGISTER", Payload: RegisterPayload{Name: "a", X: 1, Y: 1}}, &ra)
+    gs.SendCommand(&CommandArgs{ClientID: "b", Seq: 1, Cmd: "REGISTER", Payload: RegisterPayload{Name: "b", X: 3, Y: 1}}, &rb)
+    tokenA, tokenB := ra.Token, rb.Token
+
+    var r CommandReply
+    gs.SendCommand(&CommandArgs{ClientID: "a", Seq: 2, Cmd: "COLLECT", Payload: CollectPayload{ID: "c"}, Token: tokenA}, &r)
+    if r.Applied || r.Message != "not-on-coin" {
+        t.Fatalf("expected not-on-coin away from the coin, got %+v", r)
+    }
+
+    gs.SendCommand(&CommandArgs{ClientID: "a", Seq: 3, Cmd: "MOVE", Payload: MovePayload{Dir: DirDireita}, Token: tokenA}, &r)
+    gs.SendCommand(&CommandArgs{ClientID: "b", Seq: 2, Cmd: "MOVE", Payload: MovePayload{Dir: DirEsquerda}, Token: tokenB}, &r)
+
+    var coletou CommandReply
+    gs.SendCommand(&CommandArgs{ClientID: "a", Seq: 4, Cmd: "COLLECT", Payload: CollectPayload{ID: "c"}, Token: tokenA}, &coletou)
+    if !coletou.Applied || coletou.Message != "collected" {
+        t.Fatalf("expected first claimant to collect, got %+v", coletou)
+    }
+    var dup CommandReply
+    gs.SendCommand(&CommandArgs{ClientID: "a", Seq: 4, Cmd: "COLLECT", Payload: CollectPayload{ID: "c"}, Token: tokenA}, &dup)
+    if dup != coletou {
+        t.Fatalf("expected cached reply %+v for retransmission, got %+v", coletou, dup)
+    }
+    gs.SendCommand(&CommandArgs{ClientID: "b", Seq: 3, Cmd: "COLLECT", Payload: map[string]interface{}{"id": "c"}, Token: tokenB}, &r)
+    if r.Applied || r.Message != "no-such-coin" {
+        t.Fatalf("expected second claimant to lose, got %+v", r)
+    }
+
+    var st StateReply
+    gs.GetState(&ClientIDArgs{ClientID: "a", Token: tokenA}, &st)
+    for _, p := range st.Players {
+        if (p.ID == "a" && p.Coins != 1) || (p.ID == "b" && p.Coins != 0) {
+            t.Fatalf("expected a=1 b=0 coins, got %+v", st.Players)
+        }
+    }
+    if len(st.Entities) != 1 || st.Entities[0].ID == "c" {
+        t.Fatalf("expected coin re-spawned with new ID, got %+v", st.Entities)
+    }
+}
+
+// TestEntityWithoutFreeCell verifica que uma moeda sem célula livre para
+// reaparecer some do estado e volta quando uma célula fica livre
+func TestEntityWithoutFreeCell(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "mapa.txt")
+    if err := os.WriteFile(path, []byte("▤▤▤▤\n▤☺ ▤\n▤▤▤▤\n"), 0600); err != nil {
+        t.Fatalf("write map: %v", err)
+    }
+    gs := NewGameServer()
+    gs.config.monsters = 0
+    gs.config.traps = 0
+    if err := gs.carregarMapa(path); err != nil {
+        t.Fatalf("carregarMapa error: %v", err)
+    }
+    gs.salas[SalaPadrao].entidades = []*entidadeServidor{{ID: "c", Kind: EntidadeMoeda, X: 2, Y: 1}}
+
+    var reg, r CommandReply
+    gs.SendCommand(&CommandArgs{ClientID: "a", Seq: 1, Cmd: "REGISTER", Payload: RegisterPayload{Name: "a"}}, &reg)
+    gs.SendCommand(&CommandArgs{ClientID: "a", Seq: 2, Cmd: "MOVE", Payload: MovePayload{Dir: DirDireita}, Token: reg.Token}, &r)
+    gs.SendCommand(&CommandArgs{ClientID: "a", Seq: 3, Cmd: "COLLECT", Payload: CollectPayload{ID: "c"}, Token: reg.Token}, &r)
+    if !r.Applied {
+        t.Fatalf("expected coin collected, got %+v", r)
+    }
+    // única célula livre é a do jogador (o início não conta)
+    var st StateReply
+    gs.GetState(&ClientIDArgs{ClientID: "a", Token: reg.Token}, &st)
+    if len(st.Entities) != 0 {
+        t.Fatalf("expected coin hidden without a free cell, got %+v", st.Entities)
+    }
+
+    gs.SendCommand(&CommandArgs{ClientID: "a", Seq: 4, Cmd: "MOVE", Payload: MovePayload{Dir: DirEsquerda}, Token: reg.Token}, &r)
+    gs.simularTick()
+    gs.GetState(&ClientIDArgs{ClientID: "a", Token: reg.Token}, &st)
+    if len(st.Entities) != 1 || st.Entities[0].X != 2 || st.Entities[0].Y != 1 {
+        t.Fatalf("expected coin back at (2,1), got %+v", st.Entities)
+    }
+}
+
+// TestMapLegendAndSpawns verifica a legenda do cabeçalho do mapa, os
+// marcadores de monstro/armadilha/moeda e os vários inícios de jogador
+func TestMapLegendAndSpawns(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "mapa.txt")
+    mapa := "@# parede cor=azul\n" +
+        "@~ elemento cor=ciano tangivel=sim\n" +
+        "@M monstro\n" +
+        "#######\n" +
+        "#☺ ☺ M#\n" +
+        "#~Δ $ #\n" +
+        "#######\n"
+    if err := os.WriteFile(path, []byte(mapa), 0600); err != nil {
+        t.Fatalf("write map: %v", err)
+    }
+
+    arq, err := lerMapaArquivo(path)
+    if err != nil {
+        t.Fatalf("lerMapaArquivo error: %v", err)
+    }
+    if len(arq.Celulas) != 4 || arq.Legenda['#'].Cor != "azul" {
+        t.Fatalf("expected 4 rows and a blue '#', got %d rows, legend %+v", len(arq.Celulas), arq.Legenda['#'])
+    }
+    if !arq.Celulas[2][1].Tangivel || arq.Celulas[1][5].Tipo != TipoVazio {
+        t.Fatalf("expected '~' tangible and the monster marker empty, got %+v / %+v", arq.Celulas[2][1], arq.Celulas[1][5])
+    }
+
+    gs := NewGameServer()
+    if err := gs.carregarMapa(path); err != nil {
+        t.Fatalf("carregarMapa error: %v", err)
+    }
+
+    // inícios diferentes para jogadores que pedem a mesma posição inicial
+    var ra, rb CommandReply
+    gs.SendCommand(&CommandArgs{ClientID: "a", Seq: 1, Cmd: "REGISTER", Payload: RegisterPayload{Name: "a", X: 1, Y: 1}}, &ra)
+    gs.SendCommand(&CommandArgs{ClientID: "b", Seq: 1, Cmd: "REGISTER", Payload: RegisterPayload{Name: "b", X: 1, Y: 1}}, &rb)
+    if ra.X != 1 || ra.Y != 1 || rb.X != 3 || rb.Y != 1 {
+        t.Fatalf("expected spawns (1,1) and (3,1), got (%d,%d) and (%d,%d)", ra.X, ra.Y, rb.X, rb.Y)
+    }
+
+    // o elemento tangível da legenda bloqueia a passagem
+    var r CommandReply
+    gs.SendCommand(&CommandArgs{ClientID: "a", Seq: 2, Cmd: "MOVE", Payload: MovePayload{Dir: DirBaixo}, Token: ra.Token}, &r)
+    if r.Applied || r.Message != "blocked" {
+        t.Fatalf("expected '~' to block, got %+v", r)
+    }
+
+    var st StateReply
+    gs.GetState(&ClientIDArgs{ClientID: "a", Token: ra.Token}, &st)
+    if len(st.Monsters) != 1 || st.Monsters[0].X != 5 || st.Monsters[0].Y != 1 {
+        t.Fatalf("expected monster at marker (5,1), got %+v", st.Monsters)
+    }
+    posicoes := map[string][2]int{}
+    for _, e := range st.Entities {
+        posicoes[e.Kind] = [2]int{e.X, e.Y}
+    }
+    if len(st.Entities) != 2 || posicoes[EntidadeArmadilha] != [2]int{2, 2} || posicoes[EntidadeMoeda] != [2]int{4, 2} {
+        t.Fatalf("expected trap at (2,2) and coin at (4,2), got %+v", st.Entities)
+    }
+}
+
+// TestRespawnLives verifica que RESPAWN tira vidas, leva o jogador a um início
+// livre e que as vidas não sobem por RESPAWN nem por UPDATE_POS
+func TestRespawnLives(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "mapa.txt")
+    mapa := "▤▤▤▤▤▤\n▤☺  ☺▤\n▤▤▤▤▤▤\n"
+    if err := os.WriteFile(path, []byte(mapa), 0600); err != nil {
+        t.Fatalf("write map: %v", err)
+    }
+    gs := NewGameServer()
+    gs.config.monsters = 0
+    gs.config.traps = 0
+    gs.config.coins = 0
+    if err := gs.carregarMapa(path); err != nil {
+        t.Fatalf("carregarMapa error: %v", err)
+    }
+
+    var ra, rb CommandReply
+    gs.SendCommand(&CommandArgs{ClientID: "a", Seq: 1, Cmd: "REGISTER", Payload: RegisterPayload{Name: "a", X: 1, Y: 1}}, &ra)
+    gs.SendCommand(&CommandArgs{ClientID: "b", Seq: 1, Cmd: "REGISTER", Payload: RegisterPayload{Name: "b", X: 2, Y: 1}}, &rb)
+    vidas := func() int {
+        var st StateReply
+        gs.GetState(&ClientIDArgs{ClientID: "b", Token: rb.Token}, &st)
+        for _, p := range st.Players {
+            if p.ID == "b" {
+                return p.Lives
+            }
+        }
+        return -1
+    }
+    if v := vidas(); v != VidasIniciais {
+        t.Fatalf("expected %d lives after REGISTER, got %d", VidasIniciais, v)
+    }
+
+    // o início (1,1) está ocupado por a: b renasce no outro
+    var r CommandReply
+    gs.SendCommand(&CommandArgs{ClientID: "b", Seq: 2, Cmd: "RESPAWN", Payload: RespawnPayload{Lives: 2}, Token: rb.Token}, &r)
+    if !r.Applied || r.Message != "respawned" || r.X != 4 || r.Y != 1 || vidas() != 2 {
+        t.Fatalf("expected respawn at (4,1) with 2 lives, got %+v lives=%d", r, vidas())
+    }
+
+    gs.SendCommand(&CommandArgs{ClientID: "b", Seq: 3, Cmd: "RESPAWN", Payload: RespawnPayload{Lives: 2}, Token: rb.Token}, &r)
+    if r.Applied || r.Message != "bad-payload" {
+        t.Fatalf("expected RESPAWN without losing a life to be rejected, got %+v", r)
+    }
+    gs.SendCommand(&CommandArgs{ClientID: "b", Seq: 4, Cmd: "UPDATE_POS", Payload: UpdatePosPayload{X: 3, Y: 1, Lives: 9}, Token: rb.Token}, &r)
+    if !r.Applied || vidas() != 2 {
+        t.Fatalf("expected UPDATE_POS to keep 2 lives, got %+v lives=%d", r, vidas())
+    }
+
+    gs.SendCommand(&CommandArgs{ClientID: "b", Seq: 5, Cmd: "RESPAWN", Payload: map[string]interface{}{"lives": 0}, Token: rb.Token}, &r)
+    if !r.Applied || r.Message != "game-over" || r.X != 3 || vidas() != 0 {
+        t.Fatalf("expected game-over in place, got %+v lives=%d", r, vidas())
+    }
+
+    // REGISTER de um jogador ativo não devolve as vidas; só a partida nova
+    gs.SendCommand(&CommandArgs{ClientID: "b", Seq: 6, Cmd: "REGISTER", Payload: RegisterPayload{Name: "b"}, Token: rb.Token}, &r)
+    if !r.Applied || vidas() != 0 {
+        t.Fatalf("expected re-register to keep 0 lives, got %+v lives=%d", r, vidas())
+    }
+    gs.SendCommand(&CommandArgs{ClientID: "b", Seq: 7, Cmd: "LOGOUT", Token: rb.Token}, &r)
+    gs.SendCommand(&CommandArgs{ClientID: "b", Seq: 8, Cmd: "UPDATE_POS", Payload: UpdatePosPayload{X: 4, Y: 1, Lives: 3}, Token: rb.Token}, &r)
+    if r.Applied {
+        t.Fatalf("expected UPDATE_POS for a player not in the room to be rejected, got %+v", r)
+    }
+    gs.SendCommand(&CommandArgs{ClientID: "b", Seq: 9, Cmd: "REGISTER", Payload: RegisterPayload{Name: "b"}}, &rb)
+    if !rb.Applied || vidas() != VidasIniciais {
+        t.Fatalf("expected a new game with %d lives after LOGOUT, got %+v lives=%d", VidasIniciais, rb, vidas())
+    }
+}
+
+// TestSeedReproducible verifica que servidores com a mesma semente sorteiam as
+// mesmas moedas e armadilhas num mapa sem marcadores
+func TestSeedReproducible(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "mapa.txt")
+    mapa := "▤▤▤▤▤▤▤▤▤▤\n▤☺       ▤\n▤        ▤\n▤        ▤\n▤▤▤▤▤▤▤▤▤▤\n"
+    if err := os.WriteFile(path, []byte(mapa), 0600); err != nil {
+        t.Fatalf("write map: %v", err)
+    }
+    entidades := func(seed int64) []EntityInfo {
+        gs := NewGameServer()
+        gs.config.seed = seed
+        gs.config.monsters = 0
+        gs.config.coins = 2
+        gs.config.traps = 5
+        if err := gs.carregarMapa(path); err != nil {
+            t.Fatalf("carregarMapa error: %v", err)
+        }
+        return gs.salas[SalaPadrao].listaEntidades()
+    }
+    a, b := entidades(7), entidades(7)
+    if len(a) != 7 || !reflect.DeepEqual(a, b) {
+        t.Fatalf("expected the same 7 entities for the same seed, got %+v and %+v", a, b)
+    }
+}
+
+// TestHello verifica a resposta do Hello (versão, comandos, capacidades e
+// checksum do mapa) e que um mapa gerado tem o checksum do arquivo exportado
+func TestHello(t *testing.T) {
+    dir := t.TempDir()
+    nome := "gerar:masmorra:30x15:3"
+    path := filepath.Join(dir, "masmorra.txt")
+    if err := exportarMapa(nome, path); err != nil {
+        t.Fatalf("exportarMapa error: %v", err)
+    }
+
+    gs := NewGameServer()
+    if err := gs.carregarMapa(nome); err != nil {
+        t.Fatalf("carregarMapa error: %v", err)
+    }
+    var reply HelloReply
+    if err := gs.Hello(&HelloArgs{ClientID: "h", Protocol: VersaoProtocolo, MinProtocol: VersaoProtocoloMinima}, &reply); err != nil {
+        t.Fatalf("Hello error: %v", err)
+    }
+    if reply.Protocol != VersaoProtocolo || reply.MinProtocol != VersaoProtocoloMinima || reply.Map != nome {
+        t.Fatalf("unexpected Hello reply %+v", reply)
+    }
+    if !reply.Suporta("MOVE") || !reply.Suporta(CapacidadeDelta) || reply.Suporta("TELEPORT") {
+        t.Fatalf("unexpected commands/capabilities %v %v", reply.Commands, reply.Capabilities)
+    }
+    soma, err := checksumMapa(path)
+    if err != nil {
+        t.Fatalf("checksumMapa error: %v", err)
+    }
+    if len(soma) != 64 || reply.MapChecksum != soma {
+        t.Fatalf("expected generated map checksum %s, got %s", soma, reply.MapChecksum)
+    }
+
+    // clientes velhos e novos demais são incompatíveis, mas ainda recebem resposta
+    if protocoloCompativel(1, 1) == nil || protocoloCompativel(VersaoProtocolo+1, VersaoProtocolo+1) == nil {
+        t.Fatalf("expected protocol 1 and %d incompatible", VersaoProtocolo+1)
+    }
+    if protocoloCompativel(VersaoProtocolo+1, VersaoProtocolo) != nil {
+        t.Fatalf("expected a newer peer that still speaks %d to be compatible", VersaoProtocolo)
+    }
+    reply = HelloReply{}
+    gs.Hello(&HelloArgs{ClientID: "velho", Protocol: 1, MinProtocol: 1}, &reply)
+    if reply.Protocol != VersaoProtocolo {
+        t.Fatalf("expected a reply for an incompatible client, got %+v", reply)
+    }
+}
+
+// postJSON manda corpo para url e decodifica a resposta JSON em v
+func postJSON(t *testing.T, url, corpo string, v interface{}) int {
+    resp, err := http.Post(url, "application/json", strings.NewReader(corpo))
+    if err != nil {
+        t.Fatalf("POST %s error: %v", url, err)
+    }
+    defer resp.Body.Close()
+    if v != nil {
+        if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+            t.Fatalf("decode reply from %s: %v", url, err)
+        }
+    }
+    return resp.StatusCode
+}
+
+// TestHTTPGateway verifica que o gateway HTTP/JSON passa pela mesma
+// deduplicação, tokens e validação de movimento do SendCommand via RPC
+func TestHTTPGateway(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "mapa.txt")
+    if err := os.WriteFile(path, []byte("▤▤▤▤\n▤☺ ▤\n▤▤▤▤\n"), 0600); err != nil {
+        t.Fatalf("write map: %v", err)
+    }
+    gs := NewGameServer()
+    if err := gs.carregarMapa(path); err != nil {
+        t.Fatalf("carregarMapa error: %v", err)
+    }
+    ts := httptest.NewServer(gs.handlerHTTP())
+    defer ts.Close()
+
+    var reg CommandReply
+    if code := postJSON(t, ts.URL+"/command", `{"ClientID":"h","Seq":1,"Cmd":"REGISTER","Payload":{"Name":"h"}}`, &reg); code != http.StatusOK || !reg.Applied || reg.Token == "" {
+        t.Fatalf("expected REGISTER applied with a token, got %d %+v", code, reg)
+    }
+
+    move := `{"ClientID":"h","Seq":2,"Cmd":"MOVE","Payload":{"Dir":"right"},"Token":"` + reg.Token + `"}`
+    var mv, dup CommandReply
+    postJSON(t, ts.URL+"/command", move, &mv)
+    if !mv.Applied || mv.X != 2 || mv.Y != 1 {
+        t.Fatalf("expected move to (2,1), got %+v", mv)
+    }
+    postJSON(t, ts.URL+"/command", move, &dup)
+    if dup != mv {
+        t.Fatalf("expected cached reply for duplicate MOVE, got %+v and %+v", mv, dup)
+    }
+    postJSON(t, ts.URL+"/command", `{"ClientID":"h","Seq":3,"Cmd":"MOVE","Payload":{"Dir":"right"},"Token":"`+reg.Token+`"}`, &mv)
+    if mv.Applied || mv.Message != "blocked" {
+        t.Fatalf("expected blocked move, got %+v", mv)
+    }
+    postJSON(t, ts.URL+"/command", `{"ClientID":"h","Seq":4,"Cmd":"MOVE","Payload":{"Dir":"left"},"Token":"wrong"}`, &mv)
+    if mv.Applied || mv.Message != MsgInvalidToken {
+        t.Fatalf("expected bad token rejected, got %+v", mv)
+    }
+
+    resp, err := http.Get(ts.URL + "/state?client_id=h&token=" + reg.Token)
+    if err != nil {
+        t.Fatalf("GET /state error: %v", err)
+    }
+    var st StateReply
+    json.NewDecoder(resp.Body).Decode(&st)
+    resp.Body.Close()
+    if resp.StatusCode != http.StatusOK || len(st.Players) != 1 || st.Players[0].X != 2 || !st.Full {
+        t.Fatalf("expected full state with h at (2,1), got %d %+v", resp.StatusCode, st)
+    }
+
+    // erros do próprio gateway
+    if code := postJSON(t, ts.URL+"/state", `{"ClientID":"h"}`, nil); code != http.StatusUnauthorized {
+        t.Fatalf("expected 401 for state without token, got %d", code)
+    }
+    if code := postJSON(t, ts.URL+"/command", `{"ClientID":"h","Seq":5,"Cmd":"MOVE","Payload":{"Dir":5}}`, nil); code != http.StatusBadRequest {
+        t.Fatalf("expected 400 for bad payload, got %d", code)
+    }
+    if resp, err := http.Get(ts.URL + "/command"); err != nil || resp.StatusCode != http.StatusMethodNotAllowed {
+        t.Fatalf("expected 405 for GET /command, got %v %v", resp, err)
+    }
+}
+
+// TestJSONRPCGateway verifica SendCommand e GetState via net/rpc/jsonrpc
+func TestJSONRPCGateway(t *testing.T) {
+    gs := NewGameServer()
+    l, err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil {
+        t.Fatalf("listen error: %v", err)
+    }
+    defer l.Close()
+    go gs.servirJSONRPC(l)
+
+    client, err := jsonrpc.Dial("tcp", l.Addr().String())
+    if err != nil {
+        t.Fatalf("dial error: %v", err)
+    }
+    defer client.Close()
+
+    args := map[string]interface{}{"ClientID": "j", "Seq": 1, "Cmd": "REGISTER", "Payload": map[string]interface{}{"Name": "j", "X": 1, "Y": 1}}
+    var reply, dup CommandReply
+    if err := client.Call("GameServer.SendCommand", args, &reply); err != nil || !reply.Applied {
+        t.Fatalf("expected REGISTER applied, got %+v, %v", reply, err)
+    }
+    args["Token"] = reply.Token
+    if err := client.Call("GameServer.SendCommand", args, &dup); err != nil || dup != reply {
+        t.Fatalf("expected cached reply for duplicate, got %+v, %v", dup, err)
+    }
+    bad := map[string]interface{}{"ClientID": "j", "Seq": 2, "Cmd": "RESPAWN", "Payload": "three", "Token": reply.Token}
+    if err := client.Call("GameServer.SendCommand", bad, &dup); err == nil {
+        t.Fatalf("expected error for bad RESPAWN payload")
+    }
+
+    var st StateReply
+    if err := client.Call("GameServer.GetState", ClientIDArgs{ClientID: "j", Token: reply.Token}, &st); err != nil {
+        t.Fatalf("GetState error: %v", err)
+    }
+    if len(st.Players) != 1 || st.Players[0].ID != "j" {
+        t.Fatalf("expected player j in state, got %+v", st.Players)
+    }
+    if err := client.Call("GameServer.GetState", ClientIDArgs{ClientID: "j"}, &st); err == nil {
+        t.Fatalf("expected GetState without token to fail")
+    }
+}
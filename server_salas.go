@@ -0,0 +1,309 @@
+// server_salas.go - Salas (lobbies) independentes no mesmo servidor
+//
+// Cada sala tem sua própria tabela de jogadores, mapa e capacidade. Todo
+// jogador está em exatamente uma sala; GetState/WatchState só mostram os
+// jogadores da sala de quem chama. A sala padrão (SalaPadrao) sempre existe;
+// salas criadas com CREATE_ROOM já começam com quem as criou e somem quando o
+// último jogador sai. --max-rooms limita quantas ficam abertas ao mesmo tempo.
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// SalaPadrao é a sala onde os jogadores entram quando não escolhem outra
+const SalaPadrao = "lobby"
+
+// Sala é uma partida independente dentro do servidor
+type Sala struct {
+	Nome       string
+	MapFile    string
+	Capacidade int // 0 = sem limite
+	mapa       *MapaServidor
+	players    map[string]PlayerInfo
+	monstros   []*monstroServidor     // simulados a cada tick (ver server_monstros.go)
+	direcoes   map[string]PosicaoMapa // direção do último passo de cada jogador (para o emboscador)
+
+	// moedas e armadilhas (ver server_entidades.go)
+	entidades       []*entidadeServidor
+	proximaEntidade int        // contador usado nos IDs das entidades
+	rng             *rand.Rand // sorteio das posições
+	ticks           int64      // ticks simulados, para o reaparecimento periódico das moedas
+
+	// Versionamento do estado para WatchState (long-poll) e respostas delta
+	version     int64            // Incrementa a cada mudança visível em players
+	mudou       chan struct{}    // Fechado (e trocado) sempre que version muda
+	historico   []mudancaJogador // Mudanças recentes, em ordem de versão
+	histInicio  int64            // Menor versão base a partir da qual ainda dá para gerar delta
+	confirmados map[string]int64 // Última versão que cada cliente confirmou possuir
+	limiteHist  int              // Máximo de mudanças guardadas
+}
+
+func novaSala(nome, mapFile string, capacidade, limiteHist int, semente int64) *Sala {
+	return &Sala{
+		Nome:        nome,
+		MapFile:     mapFile,
+		Capacidade:  capacidade,
+		players:     make(map[string]PlayerInfo),
+		direcoes:    make(map[string]PosicaoMapa),
+		mudou:       make(chan struct{}),
+		confirmados: make(map[string]int64),
+		limiteHist:  limiteHist,
+		rng:         novoRNG(semente),
+	}
+}
+
+// posicaoValida indica se (x, y) é uma célula onde um jogador pode estar.
+// Sem mapa carregado, apenas coordenadas negativas são rejeitadas.
+func (sala *Sala) posicaoValida(x, y int) bool {
+	if sala.mapa == nil {
+		return x >= 0 && y >= 0
+	}
+	return sala.mapa.PodeMoverPara(x, y)
+}
+
+// inicio devolve a posição inicial marcada no mapa da sala
+func (sala *Sala) inicio() (int, int) {
+	if sala.mapa == nil {
+		return 0, 0
+	}
+	return sala.mapa.InicioX, sala.mapa.InicioY
+}
+
+// inicioLivre devolve o primeiro início marcado no mapa sem outro jogador além
+// de id; se todos estão ocupados, usa o primeiro
+func (sala *Sala) inicioLivre(id string) (int, int) {
+	if sala.mapa == nil {
+		return sala.inicio()
+	}
+	for _, p := range sala.mapa.Inicios {
+		if !sala.ocupadoPorOutro(id, p.X, p.Y) {
+			return p.X, p.Y
+		}
+	}
+	return sala.inicio()
+}
+
+// ocupadoPorOutro indica se há um jogador diferente de id em (x, y)
+func (sala *Sala) ocupadoPorOutro(id string, x, y int) bool {
+	for _, p := range sala.players {
+		if p.ID != id && p.X == x && p.Y == y {
+			return true
+		}
+	}
+	return false
+}
+
+// ehInicio indica se (x, y) é um dos inícios marcados no mapa
+func (sala *Sala) ehInicio(x, y int) bool {
+	if sala.mapa == nil {
+		return false
+	}
+	for _, p := range sala.mapa.Inicios {
+		if p.X == x && p.Y == y {
+			return true
+		}
+	}
+	return false
+}
+
+func (sala *Sala) cheia() bool {
+	return sala.Capacidade > 0 && len(sala.players) >= sala.Capacidade
+}
+
+func (sala *Sala) info() RoomInfo {
+	return RoomInfo{Name: sala.Nome, Map: sala.MapFile, Capacity: sala.Capacidade, Players: len(sala.players)}
+}
+
+// criarSala cria uma sala nova carregando o mapa indicado. Além do mapa do
+// lobby (usado como configurado), só arquivos do diretório do servidor são
+// aceitos (o caminho é reduzido ao nome do arquivo).
+// Deve ser chamada com s.mu bloqueado.
+func (s *GameServer) criarSala(nome, mapFile string, capacidade int) (*Sala, error) {
+	if _, existe := s.salas[nome]; existe {
+		return nil, fmt.Errorf("room %q already exists", nome)
+	}
+	sala := novaSala(nome, mapFile, capacidade, s.config.historyLimit, s.config.seed)
+	if mapFile != "" {
+		caminho := mapFile
+		if mapFile != s.salas[SalaPadrao].MapFile {
+			caminho = filepath.Base(mapFile)
+		}
+		m, err := carregarMapaServidor(caminho)
+		if err != nil {
+			return nil, err
+		}
+		sala.mapa = m
+		sala.criarMonstros(s.config.monsters)
+		sala.criarEntidades(s.config.coins, s.config.traps)
+	}
+	s.salas[nome] = sala
+	return sala, nil
+}
+
+// salaDoJogador devolve a sala onde o jogador está (nil se não estiver em nenhuma)
+func (s *GameServer) salaDoJogador(id string) *Sala {
+	if nome, ok := s.salaDe[id]; ok {
+		return s.salas[nome]
+	}
+	return nil
+}
+
+// salaOuPadrao devolve a sala do jogador ou a sala padrão
+func (s *GameServer) salaOuPadrao(id string) *Sala {
+	if sala := s.salaDoJogador(id); sala != nil {
+		return sala
+	}
+	return s.salas[SalaPadrao]
+}
+
+// jogador procura o jogador em qualquer sala
+func (s *GameServer) jogador(id string) (PlayerInfo, *Sala, bool) {
+	sala := s.salaDoJogador(id)
+	if sala == nil {
+		return PlayerInfo{}, nil, false
+	}
+	pi, ok := sala.players[id]
+	return pi, sala, ok
+}
+
+// salvarJogador grava o jogador na sala indicada, tirando-o da sala anterior
+// se ele estava em outra. Deve ser chamada com s.mu bloqueado.
+func (s *GameServer) salvarJogador(sala *Sala, pi PlayerInfo) {
+	if anterior := s.salaDoJogador(pi.ID); anterior != nil && anterior != sala {
+		s.removerJogador(pi.ID)
+	}
+	sala.salvarJogador(pi)
+	s.salaDe[pi.ID] = sala.Nome
+}
+
+// removerJogador tira o jogador da sala em que está; salas criadas por
+// jogadores são apagadas quando ficam vazias. Deve ser chamada com s.mu bloqueado.
+func (s *GameServer) removerJogador(id string) {
+	sala := s.salaDoJogador(id)
+	delete(s.salaDe, id)
+	if sala == nil {
+		return
+	}
+	sala.removerJogador(id)
+	if sala.Nome != SalaPadrao && len(sala.players) == 0 {
+		delete(s.salas, sala.Nome)
+		fmt.Printf("[SERVER] %s Room %s is empty and was closed\n", time.Now().Format(time.RFC3339), sala.Nome)
+	}
+}
+
+// comandoSala trata CREATE_ROOM, JOIN_ROOM e LEAVE_ROOM.
+// Deve ser chamada com s.mu bloqueado.
+func (s *GameServer) comandoSala(args *CommandArgs, cr *CommandReply) {
+	var rp RoomPayload
+	switch p := args.Payload.(type) {
+	case RoomPayload:
+		rp = p
+	case map[string]interface{}:
+		if name, ok := p["name"].(string); ok {
+			rp.Name = name
+		}
+		if m, ok := p["map"].(string); ok {
+			rp.Map = m
+		}
+		if c, ok := toInt(p["capacity"]); ok {
+			rp.Capacity = c
+		}
+	}
+
+	switch args.Cmd {
+	case "CREATE_ROOM":
+		if rp.Name == "" {
+			cr.Message = "bad-payload"
+			return
+		}
+		// quem cria entra na sala: como as salas só fecham quando o último
+		// jogador sai, uma sala sem ninguém nunca seria apagada
+		pi, _, ok := s.jogador(args.ClientID)
+		if !ok {
+			cr.Message = "not-registered"
+			return
+		}
+		if rp.Map == "" {
+			rp.Map = s.salas[SalaPadrao].MapFile
+		}
+		if rp.Capacity <= 0 {
+			rp.Capacity = s.config.roomCapacity
+		}
+		if _, existe := s.salas[rp.Name]; existe {
+			cr.Message = "room-exists"
+			return
+		}
+		if s.config.maxRooms > 0 && len(s.salas)-1 >= s.config.maxRooms {
+			cr.Message = "too-many-rooms"
+			fmt.Printf("[SERVER] %s CREATE_ROOM %s by %s refused: %d rooms open\n", time.Now().Format(time.RFC3339), rp.Name, args.ClientID, len(s.salas)-1)
+			return
+		}
+		sala, err := s.criarSala(rp.Name, rp.Map, rp.Capacity)
+		if err != nil {
+			cr.Message = "bad-map"
+			fmt.Printf("[SERVER] %s CREATE_ROOM %s by %s failed: %v\n", time.Now().Format(time.RFC3339), rp.Name, args.ClientID, err)
+			return
+		}
+		s.persistirSala(sala)
+		pi.X, pi.Y = sala.inicioLivre(pi.ID)
+		pi.LastSeen = time.Now().Unix()
+		s.salvarJogador(sala, pi)
+		cr.Applied = true
+		cr.Message = "room-created"
+		cr.X, cr.Y = pi.X, pi.Y
+		fmt.Printf("[SERVER] %s Room %s created by %s (map=%s, capacity=%d)\n", time.Now().Format(time.RFC3339), rp.Name, args.ClientID, rp.Map, rp.Capacity)
+	case "JOIN_ROOM", "LEAVE_ROOM":
+		pi, atual, ok := s.jogador(args.ClientID)
+		if !ok {
+			cr.Message = "not-registered"
+			return
+		}
+		if args.Cmd == "LEAVE_ROOM" {
+			rp.Name = SalaPadrao
+		}
+		destino, existe := s.salas[rp.Name]
+		if !existe {
+			cr.Message = "no-such-room"
+			return
+		}
+		if destino == atual {
+			cr.Message = "already-in-room"
+			cr.X, cr.Y = pi.X, pi.Y
+			return
+		}
+		if destino.cheia() {
+			cr.Message = "room-full"
+			return
+		}
+		pi.X, pi.Y = destino.inicioLivre(pi.ID)
+		pi.LastSeen = time.Now().Unix()
+		s.salvarJogador(destino, pi)
+		cr.Applied = true
+		cr.Message = "joined-room"
+		if args.Cmd == "LEAVE_ROOM" {
+			cr.Message = "left-room"
+		}
+		cr.X, cr.Y = pi.X, pi.Y
+		fmt.Printf("[SERVER] %s Player %s moved from room %s to %s\n", time.Now().Format(time.RFC3339), args.ClientID, atual.Nome, destino.Nome)
+	}
+}
+
+// ListRooms lista as salas abertas. Não exige token, para que o cliente possa
+// escolher a sala antes do REGISTER.
+func (s *GameServer) ListRooms(args *ClientIDArgs, reply *RoomListReply) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	reply.Rooms = make([]RoomInfo, 0, len(s.salas))
+	for _, sala := range s.salas {
+		reply.Rooms = append(reply.Rooms, sala.info())
+	}
+	sort.Slice(reply.Rooms, func(i, j int) bool { return reply.Rooms[i].Name < reply.Rooms[j].Name })
+	fmt.Printf("[SERVER] %s Replying ListRooms to %s with %d rooms\n", time.Now().Format(time.RFC3339), args.ClientID, len(reply.Rooms))
+	return nil
+}
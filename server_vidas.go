@@ -0,0 +1,54 @@
+// server_vidas.go - Vidas dos jogadores
+//
+// O dano é detectado pelo cliente (monstro ou armadilha na posição dele), que
+// avisa o servidor com RESPAWN e as vidas que sobraram. O servidor guarda as
+// vidas em PlayerInfo.Lives, sem deixar que subam, e escolhe o início onde o
+// jogador renasce. O REGISTER de uma partida nova devolve VidasIniciais.
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// comandoRenascer trata RESPAWN. Deve ser chamada com s.mu bloqueado.
+func (s *GameServer) comandoRenascer(args *CommandArgs, cr *CommandReply) {
+	var rp RespawnPayload
+	switch p := args.Payload.(type) {
+	case RespawnPayload:
+		rp = p
+	case map[string]interface{}:
+		if li, ok := toInt(p["lives"]); ok {
+			rp.Lives = li
+		}
+	}
+	pi, sala, ok := s.jogador(args.ClientID)
+	if !ok {
+		cr.Message = "not-registered"
+		return
+	}
+	if rp.Lives < 0 || rp.Lives >= pi.Lives {
+		// dano sempre tira vida: não dá para ganhar vidas (nem renascer de graça) assim
+		cr.Message = "bad-payload"
+		cr.X, cr.Y = pi.X, pi.Y
+		fmt.Printf("[SERVER] %s RESPAWN from %s with lives=%d rejected (has %d)\n", time.Now().Format(time.RFC3339), args.ClientID, rp.Lives, pi.Lives)
+		return
+	}
+
+	pi.Lives = rp.Lives
+	pi.LastSeen = time.Now().Unix()
+	cr.Applied = true
+	if pi.Lives == 0 {
+		// fim de jogo: fica onde está até registrar uma partida nova
+		s.salvarJogador(sala, pi)
+		cr.Message = "game-over"
+		cr.X, cr.Y = pi.X, pi.Y
+		fmt.Printf("[SERVER] %s Player %s has no lives left\n", time.Now().Format(time.RFC3339), args.ClientID)
+		return
+	}
+	pi.X, pi.Y = sala.inicioLivre(pi.ID)
+	s.salvarJogador(sala, pi)
+	cr.Message = "respawned"
+	cr.X, cr.Y = pi.X, pi.Y
+	fmt.Printf("[SERVER] %s Player %s respawned at (%d,%d) with %d lives\n", time.Now().Format(time.RFC3339), args.ClientID, pi.X, pi.Y, pi.Lives)
+}
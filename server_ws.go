@@ -0,0 +1,174 @@
+// server_ws.go - Transporte WebSocket com o estado empurrado pelo servidor
+//
+// Com --ws-port o servidor aceita WebSocket em ws://127.0.0.1:<porta>/ws, só
+// na interface local. Cada mensagem do cliente é um PedidoWS com os argumentos
+// de sempre (CommandArgs em SendCommand, com o Payload lido como no gateway
+// HTTP) e recebe um RespostaWS com o mesmo ID, na ordem dos pedidos.
+//
+// Subscribe (com um WatchArgs, sem resposta) liga a assinatura da conexão: a
+// cada mudança da sala do jogador o servidor empurra um RespostaWS com ID 0 e
+// o StateReply, um delta sobre o estado empurrado antes (o primeiro parte do
+// BaseVersion pedido). Um novo Subscribe troca o anterior; um token recusado
+// termina a assinatura com Error. Por baixo a assinatura é um laço de
+// WatchState, então tokens, salas e deltas funcionam como no net/rpc.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// sessaoWS é uma conexão WebSocket aberta e a assinatura atual dela
+type sessaoWS struct {
+	conn       *ConexaoWS
+	mu         sync.Mutex // protege assinatura e a escrita dos estados
+	assinatura int64      // número da assinatura atual (0 = nenhuma, -1 = conexão fechada)
+}
+
+// empurrar envia r se a assinatura n ainda é a atual
+func (ss *sessaoWS) empurrar(n int64, r RespostaWS) bool {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	if ss.assinatura != n {
+		return false
+	}
+	return ss.conn.EscreverJSON(r) == nil
+}
+
+// ativa indica se a assinatura n ainda é a atual
+func (ss *sessaoWS) ativa(n int64) bool {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	return ss.assinatura == n
+}
+
+// trocarAssinatura encerra a assinatura atual e devolve o número da próxima
+func (ss *sessaoWS) trocarAssinatura(fechar bool) int64 {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	if fechar {
+		ss.assinatura = -1
+	} else {
+		ss.assinatura++
+	}
+	return ss.assinatura
+}
+
+// handlerWS devolve o handler do endpoint WebSocket
+func (s *GameServer) handlerWS() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ws", s.servirWS)
+	return mux
+}
+
+func (s *GameServer) servirWS(w http.ResponseWriter, r *http.Request) {
+	conn, err := aceitarWS(w, r)
+	if err != nil {
+		fmt.Printf("[SERVER] %s Rejected WebSocket from %s: %v\n", time.Now().Format(time.RFC3339), r.RemoteAddr, err)
+		return
+	}
+	defer conn.Fechar()
+	fmt.Printf("[SERVER] %s WebSocket connected from %s\n", time.Now().Format(time.RFC3339), r.RemoteAddr)
+
+	sessao := &sessaoWS{conn: conn}
+	defer sessao.trocarAssinatura(true)
+	for {
+		var p PedidoWS
+		if err := conn.LerJSON(&p); err != nil {
+			if err != io.EOF {
+				fmt.Printf("[SERVER] %s WebSocket from %s closed: %v\n", time.Now().Format(time.RFC3339), r.RemoteAddr, err)
+			}
+			return
+		}
+		if p.Method == "Subscribe" {
+			var args WatchArgs
+			if err := json.Unmarshal(p.Params, &args); err != nil {
+				conn.EscreverJSON(RespostaWS{ID: p.ID, Error: "bad Subscribe params: " + err.Error()})
+				continue
+			}
+			go s.assinarWS(sessao, sessao.trocarAssinatura(false), args)
+			continue
+		}
+		if err := conn.EscreverJSON(s.atenderWS(p)); err != nil {
+			return
+		}
+	}
+}
+
+// atenderWS executa um pedido e monta a resposta
+func (s *GameServer) atenderWS(p PedidoWS) RespostaWS {
+	var result interface{}
+	var err error
+	switch p.Method {
+	case "SendCommand":
+		var c ComandoJSON
+		var reply CommandReply
+		if err = json.Unmarshal(p.Params, &c); err == nil {
+			var args CommandArgs
+			if args, err = c.args(); err == nil {
+				err = s.SendCommand(&args, &reply)
+			}
+		}
+		result = reply
+	case "GetState":
+		var args ClientIDArgs
+		var reply StateReply
+		if err = json.Unmarshal(p.Params, &args); err == nil {
+			err = s.GetState(&args, &reply)
+		}
+		result = reply
+	case "ListRooms":
+		var args ClientIDArgs
+		var reply RoomListReply
+		if err = json.Unmarshal(p.Params, &args); err == nil {
+			err = s.ListRooms(&args, &reply)
+		}
+		result = reply
+	case "Hello":
+		var args HelloArgs
+		var reply HelloReply
+		if err = json.Unmarshal(p.Params, &args); err == nil {
+			err = s.Hello(&args, &reply)
+		}
+		result = reply
+	default:
+		err = fmt.Errorf("unknown method %q", p.Method)
+	}
+
+	resp := RespostaWS{ID: p.ID}
+	if err == nil {
+		resp.Result, err = json.Marshal(result)
+	}
+	if err != nil {
+		resp.Error = err.Error()
+	}
+	return resp
+}
+
+// assinarWS empurra os estados da sala do jogador enquanto n for a assinatura
+// atual da sessão. Uma assinatura trocada só percebe na próxima volta do
+// WatchState (no máximo --watch-timeout depois).
+func (s *GameServer) assinarWS(sessao *sessaoWS, n int64, args WatchArgs) {
+	for {
+		var st StateReply
+		if err := s.WatchState(&args, &st); err != nil {
+			sessao.empurrar(n, RespostaWS{Error: err.Error()})
+			return
+		}
+		if st.Version == args.SinceVersion && (args.Room == "" || st.Room == args.Room) {
+			// timeout sem mudanças
+			if !sessao.ativa(n) {
+				return
+			}
+			continue
+		}
+		if !sessao.empurrar(n, RespostaWS{State: &st}) {
+			return
+		}
+		args.SinceVersion, args.BaseVersion, args.Room = st.Version, st.Version, st.Room
+	}
+}
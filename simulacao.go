@@ -0,0 +1,158 @@
+//go:build !server
+// +build !server
+
+// simulacao.go - Passo fixo da simulação do cliente
+//
+// Todo o estado do Jogo é alterado só por simularPasso, chamado pelo loop
+// principal a cada tickSimulacao. Teclado e rede continuam em goroutines, mas
+// apenas produzem Entradas, que o loop enfileira e o passo aplica na ordem em
+// que chegaram. Depois das entradas o passo avança os monstros locais, resolve
+// as colisões, recalcula o campo de visão e por fim a moeda, sempre nessa
+// ordem. Todo sorteio usa o gerador do Jogo, então com a mesma semente e as
+// mesmas entradas o resultado é sempre o mesmo.
+package main
+
+import (
+	"strconv"
+	"time"
+)
+
+const (
+	tickSimulacao  = 50 * time.Millisecond // duração de um passo da simulação
+	intervaloMoeda = 15 * time.Second      // a moeda local muda de lugar nesse intervalo
+)
+
+// Entrada é um evento de fora da simulação: uma tecla, a resposta de um
+// comando ou um estado novo do servidor. Só um dos campos vem preenchido.
+type Entrada struct {
+	Teclado  *EventoTeclado
+	Resposta *CommandReply
+	Estado   *StateReply
+}
+
+// Simulacao guarda as entidades locais do modo offline (online elas vêm do
+// servidor em StateReply)
+type Simulacao struct {
+	Tick       int64
+	Monstros   []*Monstro
+	Armadilhas []*Armadilha
+	Moeda      *Moeda
+}
+
+// ResultadoPasso diz ao loop principal se a rodada acabou
+type ResultadoPasso struct {
+	Sair      bool   // o jogador apertou ESC
+	FimDeJogo string // motivo da última vida perdida ("" enquanto há vidas)
+}
+
+// novaSimulacao cria a simulação da rodada. Com local=true (modo offline) os
+// monstros, armadilhas e a moeda nascem nos marcadores do mapa.
+func novaSimulacao(jogo *Jogo, local bool) *Simulacao {
+	sim := &Simulacao{}
+	if !local {
+		return sim
+	}
+	for i, p := range jogo.SpawnMonstros {
+		monstro := monstroNovo(i, p, jogo.rng)
+		sim.Monstros = append(sim.Monstros, monstro)
+		jogo.Monstros = append(jogo.Monstros, monstroInfo(monstro))
+	}
+	for i, p := range jogo.SpawnArmadilhas {
+		sim.Armadilhas = append(sim.Armadilhas, &Armadilha{X: p.X, Y: p.Y, Ativa: true, ID: i + 1})
+	}
+	if len(jogo.SpawnMoedas) > 0 {
+		sim.Moeda = &Moeda{X: jogo.SpawnMoedas[0].X, Y: jogo.SpawnMoedas[0].Y}
+	}
+	return sim
+}
+
+// simularPasso avança a simulação um tick. Quando o jogador sai, as entradas
+// seguintes são descartadas, mas o passo termina normalmente.
+func simularPasso(jogo *Jogo, sim *Simulacao, entradas []Entrada) ResultadoPasso {
+	var res ResultadoPasso
+	sim.Tick++
+	if jogo.Invulneravel > 0 {
+		jogo.Invulneravel--
+	}
+entradas:
+	for _, e := range entradas {
+		switch {
+		case e.Teclado != nil:
+			if continuar := personagemExecutarAcao(*e.Teclado, jogo); !continuar {
+				res.Sair = true
+				break entradas
+			}
+		case e.Resposta != nil:
+			clienteReconciliar(jogo, *e.Resposta)
+		case e.Estado != nil:
+			clienteAplicarEstado(jogo, *e.Estado)
+		}
+	}
+
+	for i, monstro := range sim.Monstros {
+		monstro.espera += tickSimulacao
+		for monstro.espera >= monstro.especie.Passo {
+			monstro.espera -= monstro.especie.Passo
+			monstroMover(monstro, jogo)
+		}
+		jogo.Monstros[i] = monstroInfo(monstro)
+	}
+
+	motivo, ok := simularColisoes(jogo, sim)
+	// a visão acompanha o personagem depois de andar ou renascer
+	visaoAtualizar(jogo)
+	if !ok {
+		res.FimDeJogo = motivo
+		return res
+	}
+
+	if sim.Moeda != nil && sim.Tick%int64(intervaloMoeda/tickSimulacao) == 0 {
+		// muda de lugar pelo tempo, sem contar ponto
+		moedaReposicionar(sim.Moeda, jogo, jogo.rng)
+	}
+	return res
+}
+
+// simularColisoes confere o jogador contra monstros, armadilhas e moedas, locais
+// ou do servidor. Devolve false (e o motivo) quando a última vida foi perdida.
+func simularColisoes(jogo *Jogo, sim *Simulacao) (string, bool) {
+	if monstroNaPosicao(jogo) {
+		return simularDano(jogo, "O MONSTRO TE PEGOU")
+	}
+	// a armadilha continua armada, mas só dispara de novo depois que o jogador
+	// sair de cima dela
+	for _, a := range sim.Armadilhas {
+		pisou := armadilhaAtivada(a, jogo)
+		disparou := pisou && !a.disparou
+		a.disparou = pisou
+		if disparou {
+			return simularDano(jogo, "CAIU EM UMA ARMADILHA")
+		}
+	}
+	if clienteVerificarEntidades(jogo) {
+		return simularDano(jogo, "CAIU EM UMA ARMADILHA")
+	}
+	if sim.Moeda != nil && moedaColetada(sim.Moeda, jogo) {
+		jogo.Pontos++
+		moedaReposicionar(sim.Moeda, jogo, jogo.rng)
+		// as armadilhas mudam de lugar a cada moeda coletada
+		moverTodasArmadilhas(sim.Armadilhas, jogo, jogo.rng)
+		jogo.StatusMsg = "Moeda coletada! Novas armadilhas foram posicionadas!"
+	}
+	return "", true
+}
+
+// simularDano tira uma vida do jogador e avisa o servidor com RESPAWN. Com
+// vidas sobrando ele renasce num início do mapa; sem vidas devolve false.
+func simularDano(jogo *Jogo, motivo string) (string, bool) {
+	if !jogoSofrerDano(jogo) {
+		return "", true // invulnerável logo depois de renascer
+	}
+	clienteEnfileirar(jogo, "RESPAWN", RespawnPayload{Lives: jogo.Vidas})
+	if jogo.Vidas == 0 {
+		return motivo + ", VOCE MORREU", false
+	}
+	jogoRenascer(jogo)
+	jogo.StatusMsg = motivo + "! Vidas restantes: " + strconv.Itoa(jogo.Vidas)
+	return "", true
+}
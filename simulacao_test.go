@@ -0,0 +1,183 @@
+//go:build !server
+// +build !server
+
+package main
+
+import (
+    "os"
+    "path/filepath"
+    "reflect"
+    "testing"
+)
+
+// rodarSimulacao joga uma partida offline com teclas fixas e devolve o estado final
+func rodarSimulacao(t *testing.T, path string, seed int64) (Jogo, *Simulacao) {
+    jogo := jogoNovo(seed)
+    if err := jogoCarregarMapa(path, &jogo); err != nil {
+        t.Fatalf("jogoCarregarMapa error: %v", err)
+    }
+    sim := novaSimulacao(&jogo, true)
+    teclas := []rune{'d', 'd', 'd', 'd', 's', 'a', 'w', 'd'}
+    for tick := 0; tick < 400; tick++ {
+        var entradas []Entrada
+        if tick%10 == 0 && tick/10 < len(teclas) {
+            entradas = append(entradas, Entrada{Teclado: &EventoTeclado{Tipo: "mover", Tecla: teclas[tick/10]}})
+        }
+        if r := simularPasso(&jogo, sim, entradas); r.Sair || r.FimDeJogo != "" {
+            break
+        }
+    }
+    return jogo, sim
+}
+
+// TestSimulacaoDeterministica verifica que o passo fixo dá o mesmo resultado
+// (inclusive as posições sorteadas) com as mesmas entradas e a mesma semente
+func TestSimulacaoDeterministica(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "mapa.txt")
+    mapa := "▤▤▤▤▤▤▤▤▤▤\n" +
+        "▤☺   $   ▤\n" +
+        "▤ ▤▤ ▤▤  ▤\n" +
+        "▤  Δ    Ж▤\n" +
+        "▤▤▤▤▤▤▤▤▤▤\n"
+    if err := os.WriteFile(path, []byte(mapa), 0600); err != nil {
+        t.Fatalf("write map: %v", err)
+    }
+
+    a, simA := rodarSimulacao(t, path, 42)
+    b, simB := rodarSimulacao(t, path, 42)
+    if a.PosX != b.PosX || a.PosY != b.PosY || a.Vidas != b.Vidas || a.Pontos != b.Pontos {
+        t.Fatalf("expected identical runs, got (%d,%d) lives=%d coins=%d and (%d,%d) lives=%d coins=%d",
+            a.PosX, a.PosY, a.Vidas, a.Pontos, b.PosX, b.PosY, b.Vidas, b.Pontos)
+    }
+    if !reflect.DeepEqual(a.Monstros, b.Monstros) || *simA.Moeda != *simB.Moeda || !reflect.DeepEqual(simA.Armadilhas, simB.Armadilhas) {
+        t.Fatalf("expected identical entities, got %+v %+v and %+v %+v", a.Monstros, *simA.Moeda, b.Monstros, *simB.Moeda)
+    }
+    if a.Pontos != 1 {
+        t.Fatalf("expected the coin to be collected once, got %d", a.Pontos)
+    }
+    if a.Vidas == VidasIniciais {
+        t.Fatalf("expected the runner to catch the player at least once")
+    }
+}
+
+// TestSimulacaoDano verifica o dano, o renascimento no início e a invulnerabilidade
+func TestSimulacaoDano(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "mapa.txt")
+    mapa := "▤▤▤▤▤▤\n▤☺ Δ ▤\n▤▤▤▤▤▤\n"
+    if err := os.WriteFile(path, []byte(mapa), 0600); err != nil {
+        t.Fatalf("write map: %v", err)
+    }
+    jogo := jogoNovo(1)
+    if err := jogoCarregarMapa(path, &jogo); err != nil {
+        t.Fatalf("jogoCarregarMapa error: %v", err)
+    }
+    sim := novaSimulacao(&jogo, true)
+    direita := []Entrada{{Teclado: &EventoTeclado{Tipo: "mover", Tecla: 'd'}}}
+
+    simularPasso(&jogo, sim, direita)
+    simularPasso(&jogo, sim, direita)
+    if jogo.Vidas != VidasIniciais-1 || jogo.PosX != 1 || !jogoInvulneravel(&jogo) {
+        t.Fatalf("expected a life lost and respawn at (1,1), got lives=%d pos=(%d,%d)", jogo.Vidas, jogo.PosX, jogo.PosY)
+    }
+
+    // invulnerável: pisar de novo na armadilha não tira vida
+    simularPasso(&jogo, sim, direita)
+    simularPasso(&jogo, sim, direita)
+    if jogo.Vidas != VidasIniciais-1 || jogo.PosX != 3 {
+        t.Fatalf("expected no damage while invulnerable, got lives=%d pos=(%d,%d)", jogo.Vidas, jogo.PosX, jogo.PosY)
+    }
+
+    // sem a proteção, as duas vidas que sobram acabam e só a última encerra o jogo
+    var r ResultadoPasso
+    for i := 0; i < 2; i++ {
+        jogoRenascer(&jogo)
+        jogo.Invulneravel = 0
+        simularPasso(&jogo, sim, direita)
+        r = simularPasso(&jogo, sim, direita)
+        if (i == 0) != (r.FimDeJogo == "") {
+            t.Fatalf("expected game over only on the last life, got %+v at lives=%d", r, jogo.Vidas)
+        }
+    }
+    if jogo.Vidas != 0 {
+        t.Fatalf("expected zero lives, got %d", jogo.Vidas)
+    }
+}
+
+// TestMoedaSemLugar verifica que a moeda sai do mapa, em vez de travar o tick,
+// quando a única célula livre é a do jogador, e que o sorteio respeita a
+// largura de cada linha
+func TestMoedaSemLugar(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "mapa.txt")
+    if err := os.WriteFile(path, []byte("▤▤▤\n▤☺▤\n▤▤▤\n"), 0600); err != nil {
+        t.Fatalf("write map: %v", err)
+    }
+    jogo := jogoNovo(1)
+    if err := jogoCarregarMapa(path, &jogo); err != nil {
+        t.Fatalf("jogoCarregarMapa error: %v", err)
+    }
+    moeda := &Moeda{X: jogo.PosX, Y: jogo.PosY}
+    moedaReposicionar(moeda, &jogo, jogo.rng)
+    if moeda.X != -1 || moeda.Y != -1 {
+        t.Fatalf("expected the coin off the map without a free cell, got (%d,%d)", moeda.X, moeda.Y)
+    }
+
+    // linhas de larguras diferentes: a única célula livre fica na linha curta
+    if err := os.WriteFile(path, []byte("▤▤▤▤▤▤▤▤\n▤☺▤▤▤▤▤▤\n▤ ▤\n▤▤▤\n"), 0600); err != nil {
+        t.Fatalf("write map: %v", err)
+    }
+    jogo = jogoNovo(1)
+    if err := jogoCarregarMapa(path, &jogo); err != nil {
+        t.Fatalf("jogoCarregarMapa error: %v", err)
+    }
+    for i := 0; i < 20; i++ {
+        moedaReposicionar(moeda, &jogo, jogo.rng)
+        if moeda.X != -1 && (moeda.X != 1 || moeda.Y != 2) {
+            t.Fatalf("expected the coin at (1,2) or off the map, got (%d,%d)", moeda.X, moeda.Y)
+        }
+    }
+}
+
+// TestPredicaoReconciliacao verifica que as respostas dos MOVE, identificadas
+// pelo Seq, só corrigem o personagem quando a posição oficial mais os passos
+// ainda pendentes diverge da posição local
+func TestPredicaoReconciliacao(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "mapa.txt")
+    if err := os.WriteFile(path, []byte("▤▤▤▤▤▤▤\n▤☺    ▤\n▤▤▤▤▤▤▤\n"), 0600); err != nil {
+        t.Fatalf("write map: %v", err)
+    }
+    jogo := jogoNovo(1)
+    if err := jogoCarregarMapa(path, &jogo); err != nil {
+        t.Fatalf("jogoCarregarMapa error: %v", err)
+    }
+    sim := novaSimulacao(&jogo, false)
+
+    // três passos para a direita já dados localmente, sem resposta
+    jogo.PosX = 4
+    jogo.Pendentes = []ComandoPendente{{Seq: 11, Cmd: "MOVE", DX: 1}, {Seq: 12, Cmd: "MOVE", DX: 1}, {Seq: 13, Cmd: "MOVE", DX: 1}}
+    responder := func(resp CommandReply) {
+        simularPasso(&jogo, sim, []Entrada{{Resposta: &resp}})
+    }
+
+    // o servidor confirma o primeiro passo: com os dois pendentes dá a posição local
+    responder(CommandReply{Seq: 11, Applied: true, Message: "moved", X: 2, Y: 1})
+    if jogo.PosX != 4 || len(jogo.Pendentes) != 2 || jogo.StatusMsg != "" {
+        t.Fatalf("expected no correction, got x=%d pending=%d status=%q", jogo.PosX, len(jogo.Pendentes), jogo.StatusMsg)
+    }
+
+    // o segundo passo foi bloqueado no servidor: sobra só o terceiro por cima
+    responder(CommandReply{Seq: 12, Message: "blocked", X: 2, Y: 1})
+    if jogo.PosX != 3 || len(jogo.Pendentes) != 1 || jogo.StatusMsg != "Posição corrigida pelo servidor" {
+        t.Fatalf("expected a correction to x=3, got x=%d pending=%d status=%q", jogo.PosX, len(jogo.Pendentes), jogo.StatusMsg)
+    }
+
+    // com um RESPAWN pendente a resposta do MOVE não mexe no personagem
+    jogo.Pendentes = append(jogo.Pendentes, ComandoPendente{Seq: 14, Cmd: "RESPAWN"})
+    responder(CommandReply{Seq: 13, Applied: true, Message: "moved", X: 5, Y: 1})
+    if jogo.PosX != 3 || len(jogo.Pendentes) != 1 {
+        t.Fatalf("expected to wait for RESPAWN, got x=%d pending=%d", jogo.PosX, len(jogo.Pendentes))
+    }
+    responder(CommandReply{Seq: 14, Applied: true, Message: "respawned", X: 1, Y: 1})
+    if jogo.PosX != 1 || len(jogo.Pendentes) != 0 {
+        t.Fatalf("expected the respawn position, got x=%d pending=%d", jogo.PosX, len(jogo.Pendentes))
+    }
+}
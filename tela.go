@@ -0,0 +1,160 @@
+//go:build !server
+// +build !server
+
+// tela.go - Onde o jogo desenha e de onde vêm as teclas
+//
+// interface.go desenha através de um Renderer e o loop do cliente recebe as
+// teclas de uma FonteTeclado. No jogo normal as duas são o termbox; nos
+// testes, TelaMemoria guarda os quadros como texto e TeclasRoteiro entrega
+// uma lista fixa de teclas, então o cliente inteiro roda sem terminal.
+package main
+
+import (
+	"strings"
+
+	"github.com/nsf/termbox-go"
+)
+
+// Renderer é a superfície onde o jogo é desenhado
+type Renderer interface {
+	Limpar()
+	Celula(x, y int, ch rune, fg, bg Cor)
+	Texto(x, y int, texto string, fg, bg Cor)
+	Atualizar()          // mostra o que foi desenhado desde o último Limpar
+	Tamanho() (int, int) // largura e altura
+}
+
+// FonteTeclado produz as teclas do jogo. LerEvento bloqueia até a próxima
+// tecla e devolve false quando não há mais nenhuma.
+type FonteTeclado interface {
+	LerEvento() (EventoTeclado, bool)
+}
+
+// rendererTermbox desenha no terminal
+type rendererTermbox struct{}
+
+func (rendererTermbox) Limpar() {
+	termbox.Clear(CorPadrao, CorPadrao)
+}
+
+func (rendererTermbox) Celula(x, y int, ch rune, fg, bg Cor) {
+	termbox.SetCell(x, y, ch, fg, bg)
+}
+
+func (rendererTermbox) Texto(x, y int, texto string, fg, bg Cor) {
+	for i, ch := range []rune(texto) {
+		termbox.SetCell(x+i, y, ch, fg, bg)
+	}
+}
+
+func (rendererTermbox) Atualizar() {
+	termbox.Flush()
+}
+
+func (rendererTermbox) Tamanho() (int, int) {
+	return termbox.Size()
+}
+
+// tecladoTermbox lê as teclas do terminal
+type tecladoTermbox struct{}
+
+func (tecladoTermbox) LerEvento() (EventoTeclado, bool) {
+	for {
+		ev := termbox.PollEvent()
+		if ev.Type == termbox.EventResize {
+			// não é tecla: só avisa o loop para redesenhar no tamanho novo
+			return EventoTeclado{Tipo: "redimensionar"}, true
+		}
+		if ev.Type != termbox.EventKey {
+			continue
+		}
+		switch {
+		case ev.Key == termbox.KeyEsc:
+			return EventoTeclado{Tipo: "sair"}, true
+		case ev.Key == termbox.KeyEnter:
+			return EventoTeclado{Tipo: "confirmar"}, true
+		case ev.Ch == 'e':
+			return EventoTeclado{Tipo: "interagir"}, true
+		case ev.Ch != 0:
+			return EventoTeclado{Tipo: "mover", Tecla: ev.Ch}, true
+		}
+		// setas e outras teclas especiais não fazem nada no jogo
+	}
+}
+
+// TelaMemoria é um Renderer que guarda o quadro numa grade de runas, para
+// testes e execução sem terminal
+type TelaMemoria struct {
+	largura, altura int
+	celulas         [][]rune // quadro sendo desenhado
+	quadro          string   // último quadro mostrado por Atualizar
+	Quadros         int      // quantos quadros já foram mostrados
+}
+
+func novaTelaMemoria(largura, altura int) *TelaMemoria {
+	t := &TelaMemoria{largura: largura, altura: altura}
+	t.Limpar()
+	return t
+}
+
+func (t *TelaMemoria) Limpar() {
+	t.celulas = make([][]rune, t.altura)
+	for y := range t.celulas {
+		t.celulas[y] = []rune(strings.Repeat(" ", t.largura))
+	}
+}
+
+func (t *TelaMemoria) Celula(x, y int, ch rune, fg, bg Cor) {
+	if y >= 0 && y < t.altura && x >= 0 && x < t.largura {
+		t.celulas[y][x] = ch
+	}
+}
+
+func (t *TelaMemoria) Texto(x, y int, texto string, fg, bg Cor) {
+	for i, ch := range []rune(texto) {
+		t.Celula(x+i, y, ch, fg, bg)
+	}
+}
+
+func (t *TelaMemoria) Atualizar() {
+	linhas := make([]string, len(t.celulas))
+	for y, l := range t.celulas {
+		linhas[y] = strings.TrimRight(string(l), " ")
+	}
+	t.quadro = strings.TrimRight(strings.Join(linhas, "\n"), "\n")
+	t.Quadros++
+}
+
+func (t *TelaMemoria) Tamanho() (int, int) {
+	return t.largura, t.altura
+}
+
+// Redimensionar muda o tamanho da tela, como um terminal redimensionado; vale
+// a partir do próximo Limpar
+func (t *TelaMemoria) Redimensionar(largura, altura int) {
+	t.largura, t.altura = largura, altura
+}
+
+// Quadro devolve o último quadro mostrado, uma linha de texto por linha da
+// tela, sem os espaços do fim
+func (t *TelaMemoria) Quadro() string {
+	return t.quadro
+}
+
+// TeclasRoteiro entrega uma lista fixa de teclas e depois acaba
+type TeclasRoteiro struct {
+	eventos []EventoTeclado
+}
+
+func novasTeclasRoteiro(eventos ...EventoTeclado) *TeclasRoteiro {
+	return &TeclasRoteiro{eventos: eventos}
+}
+
+func (r *TeclasRoteiro) LerEvento() (EventoTeclado, bool) {
+	if len(r.eventos) == 0 {
+		return EventoTeclado{}, false
+	}
+	ev := r.eventos[0]
+	r.eventos = r.eventos[1:]
+	return ev, true
+}
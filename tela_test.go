@@ -0,0 +1,127 @@
+//go:build !server
+// +build !server
+
+package main
+
+import (
+    "os"
+    "path/filepath"
+    "testing"
+)
+
+// TestQuadroDoJogo verifica o quadro desenhado numa TelaMemoria
+func TestQuadroDoJogo(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "mapa.txt")
+    mapa := "▤▤▤▤▤▤\n▤☺ ♣Ж▤\n▤Δ $ ▤\n▤▤▤▤▤▤\n"
+    if err := os.WriteFile(path, []byte(mapa), 0600); err != nil {
+        t.Fatalf("write map: %v", err)
+    }
+    jogo := jogoNovo(5)
+    if err := jogoCarregarMapa(path, &jogo); err != nil {
+        t.Fatalf("jogoCarregarMapa error: %v", err)
+    }
+    sim := novaSimulacao(&jogo, true)
+    jogo.StatusMsg = "ok"
+
+    tela := novaTelaMemoria(60, 10)
+    interfaceDesenharJogo(tela, &jogo, sim.Armadilhas, sim.Moeda)
+    esperado := "▤▤▤▤▤▤\n" +
+        "▤☺ ♣Ж▤\n" +
+        "▤Δ $ ▤\n" +
+        "▤▤▤▤▤▤\n" +
+        "\n" +
+        "ok | Vidas: 3 | Moedas: 0 | Semente: 5\n" +
+        "\n" +
+        "Use WASD para mover e E para interagir. ESC para sair."
+    if tela.Quadro() != esperado {
+        t.Fatalf("unexpected frame:\n%s\nwant:\n%s", tela.Quadro(), esperado)
+    }
+}
+
+// TestClienteSemTerminal roda o loop do cliente inteiro com teclas de roteiro
+// e confere o último quadro
+func TestClienteSemTerminal(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "mapa.txt")
+    mapa := "▤▤▤▤▤▤\n▤☺   ▤\n▤  $ ▤\n▤▤▤▤▤▤\n"
+    if err := os.WriteFile(path, []byte(mapa), 0600); err != nil {
+        t.Fatalf("write map: %v", err)
+    }
+
+    tela := novaTelaMemoria(100, 10)
+    canalTeclado := make(chan EventoTeclado)
+    teclas := novasTeclasRoteiro(
+        EventoTeclado{Tipo: "mover", Tecla: 'd'},
+        EventoTeclado{Tipo: "mover", Tecla: 'd'},
+        EventoTeclado{Tipo: "mover", Tecla: 's'},
+        EventoTeclado{Tipo: "sair"},
+    )
+    go interfaceLerEventoTeclado(teclas, canalTeclado)
+    if err := clienteJogar(tela, canalTeclado, ConfigCliente{Mapa: path, Semente: 3}); err != nil {
+        t.Fatalf("clienteJogar error: %v", err)
+    }
+
+    // a moeda reaparece num lugar sorteado com a semente 3
+    esperado := "▤▤▤▤▤▤\n" +
+        "▤  $ ▤\n" +
+        "▤  ☺ ▤\n" +
+        "▤▤▤▤▤▤\n" +
+        "\n" +
+        "Moeda coletada! Novas armadilhas foram posicionadas! | Vidas: 3 | Moedas: 1 | Semente: 3\n" +
+        "\n" +
+        "Use WASD para mover e E para interagir. ESC para sair."
+    if tela.Quadro() != esperado {
+        t.Fatalf("unexpected last frame:\n%s\nwant:\n%s", tela.Quadro(), esperado)
+    }
+}
+
+// TestCameraSegueJogador desenha um mapa maior que a tela: só a janela em volta
+// do personagem aparece, presa às bordas do mapa, e a barra de status fica
+// logo abaixo dela, inclusive depois de a tela mudar de tamanho
+func TestCameraSegueJogador(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "mapa.txt")
+    mapa := "▤▤▤▤▤▤▤▤▤▤▤▤\n" +
+        "▤  ♣    ♣  ▤\n" +
+        "▤          ▤\n" +
+        "▤    ☺     ▤\n" +
+        "▤  ♣       ▤\n" +
+        "▤          ▤\n" +
+        "▤▤▤▤▤▤▤▤▤▤▤▤\n"
+    if err := os.WriteFile(path, []byte(mapa), 0600); err != nil {
+        t.Fatalf("write map: %v", err)
+    }
+    jogo := jogoNovo(1)
+    if err := jogoCarregarMapa(path, &jogo); err != nil {
+        t.Fatalf("jogoCarregarMapa error: %v", err)
+    }
+    jogo.StatusMsg = "ok"
+    jogo.OtherPlayers = []PlayerInfo{{ID: "outro", X: 6, Y: 2}, {ID: "longe", X: 10, Y: 5}}
+
+    // 5x3 de mapa + 4 linhas de status
+    tela := novaTelaMemoria(5, 7)
+    interfaceDesenharJogo(tela, &jogo, nil, nil)
+    esperado := "   ☺\n" +
+        "  ☺\n" +
+        "♣\n" +
+        "\n" +
+        "ok |\n" +
+        "\n" +
+        "Use W"
+    if tela.Quadro() != esperado {
+        t.Fatalf("unexpected frame:\n%s\nwant:\n%s", tela.Quadro(), esperado)
+    }
+
+    // perto da borda a câmera para no canto do mapa
+    jogo.PosX, jogo.PosY = 1, 1
+    tela.Redimensionar(4, 7)
+    interfaceDesenharJogo(tela, &jogo, nil, nil)
+    esperado = "▤▤▤▤\n" +
+        "▤☺ ♣\n" +
+        "▤\n" +
+        "\n" +
+        "ok |\n" +
+        "\n" +
+        "Use"
+    if tela.Quadro() != esperado {
+        t.Fatalf("unexpected frame after resize:\n%s\nwant:\n%s", tela.Quadro(), esperado)
+    }
+}
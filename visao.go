@@ -0,0 +1,135 @@
+//go:build !server
+// +build !server
+
+// visao.go - Neblina e campo de visão do personagem
+//
+// Em mapas com a opção @neblina (ver mapa_formato.go) o personagem só enxerga
+// até o alcance dado e não enxerga através de paredes. O campo de visão é
+// calculado com shadowcasting recursivo, um octante de cada vez. As células
+// já vistas ficam lembradas e são desenhadas apagadas; armadilhas, moedas,
+// monstros e outros jogadores só aparecem nas células visíveis agora.
+package main
+
+// Visao guarda o que o personagem enxerga e o que ele já explorou
+type Visao struct {
+	Alcance   int
+	Visivel   [][]bool // células no campo de visão atual
+	Explorado [][]bool // células vistas alguma vez na rodada
+}
+
+// octantes são as transformações (xx, xy, yx, yy) que levam o octante base
+// para cada um dos oito em volta do personagem
+var octantes = [8][4]int{
+	{1, 0, 0, -1}, {0, 1, -1, 0}, {0, 1, 1, 0}, {1, 0, 0, 1},
+	{-1, 0, 0, 1}, {0, -1, 1, 0}, {0, -1, -1, 0}, {-1, 0, 0, -1},
+}
+
+// novaVisao cria a visão de um mapa; com alcance 0 não há neblina e devolve nil
+func novaVisao(jogo *Jogo, alcance int) *Visao {
+	if alcance <= 0 {
+		return nil
+	}
+	v := &Visao{Alcance: alcance}
+	v.Visivel = make([][]bool, len(jogo.Mapa))
+	v.Explorado = make([][]bool, len(jogo.Mapa))
+	for y, linha := range jogo.Mapa {
+		v.Visivel[y] = make([]bool, len(linha))
+		v.Explorado[y] = make([]bool, len(linha))
+	}
+	return v
+}
+
+// visaoAtualizar recalcula o campo de visão a partir da posição do personagem
+func visaoAtualizar(jogo *Jogo) {
+	v := jogo.Visao
+	if v == nil {
+		return
+	}
+	for _, linha := range v.Visivel {
+		clear(linha)
+	}
+	v.marcar(jogo.PosX, jogo.PosY)
+	for _, o := range octantes {
+		v.projetar(jogo, 1, 1.0, 0.0, o[0], o[1], o[2], o[3])
+	}
+}
+
+// projetar percorre as linhas de um octante a partir de linha, entre as
+// inclinações inicio e fim. Uma parede no meio da linha faz sombra: o que
+// está antes dela continua numa chamada recursiva e o resto segue depois da
+// sombra.
+func (v *Visao) projetar(jogo *Jogo, linha int, inicio, fim float64, xx, xy, yx, yy int) {
+	if inicio < fim {
+		return
+	}
+	var proximoInicio float64
+	for j := linha; j <= v.Alcance; j++ {
+		bloqueado := false
+		for dx, dy := -j, -j; dx <= 0; dx++ {
+			x := jogo.PosX + dx*xx + dy*xy
+			y := jogo.PosY + dx*yx + dy*yy
+			esquerda := (float64(dx) - 0.5) / (float64(dy) + 0.5)
+			direita := (float64(dx) + 0.5) / (float64(dy) - 0.5)
+			if inicio < direita {
+				continue
+			}
+			if fim > esquerda {
+				break
+			}
+			if dx*dx+dy*dy <= v.Alcance*v.Alcance {
+				v.marcar(x, y)
+			}
+			opaca := visaoOpaca(jogo, x, y)
+			switch {
+			case bloqueado && opaca:
+				proximoInicio = direita
+			case bloqueado:
+				bloqueado = false
+				inicio = proximoInicio
+			case opaca && j < v.Alcance:
+				bloqueado = true
+				v.projetar(jogo, j+1, inicio, esquerda, xx, xy, yx, yy)
+				proximoInicio = direita
+			}
+		}
+		if bloqueado {
+			return
+		}
+	}
+}
+
+// marcar deixa a célula (x, y) visível e explorada
+func (v *Visao) marcar(x, y int) {
+	if y >= 0 && y < len(v.Visivel) && x >= 0 && x < len(v.Visivel[y]) {
+		v.Visivel[y][x] = true
+		v.Explorado[y][x] = true
+	}
+}
+
+// visaoOpaca indica se a célula bloqueia a visão: as mesmas que bloqueiam a
+// passagem, e também tudo fora do mapa
+func visaoOpaca(jogo *Jogo, x, y int) bool {
+	if y < 0 || y >= len(jogo.Mapa) || x < 0 || x >= len(jogo.Mapa[y]) {
+		return true
+	}
+	return jogo.Mapa[y][x].tangivel
+}
+
+// visaoEnxerga indica se o personagem vê a célula (x, y) agora; sem neblina
+// tudo é visível
+func visaoEnxerga(jogo *Jogo, x, y int) bool {
+	v := jogo.Visao
+	if v == nil {
+		return true
+	}
+	return y >= 0 && y < len(v.Visivel) && x >= 0 && x < len(v.Visivel[y]) && v.Visivel[y][x]
+}
+
+// visaoExplorada indica se a célula (x, y) já foi vista alguma vez
+func visaoExplorada(jogo *Jogo, x, y int) bool {
+	v := jogo.Visao
+	if v == nil {
+		return true
+	}
+	return y >= 0 && y < len(v.Explorado) && x >= 0 && x < len(v.Explorado[y]) && v.Explorado[y][x]
+}
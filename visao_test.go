@@ -0,0 +1,84 @@
+//go:build !server
+// +build !server
+
+package main
+
+import (
+    "os"
+    "path/filepath"
+    "testing"
+)
+
+// TestNeblinaCampoDeVisao verifica que paredes fazem sombra, que a armadilha
+// atrás delas não aparece e que as células exploradas continuam lembradas
+func TestNeblinaCampoDeVisao(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "mapa.txt")
+    mapa := "@neblina 4\n" +
+        "▤▤▤▤▤▤▤▤▤\n" +
+        "▤☺ ▤    ▤\n" +
+        "▤  ▤ Δ  ▤\n" +
+        "▤       ▤\n" +
+        "▤▤▤▤▤▤▤▤▤\n"
+    if err := os.WriteFile(path, []byte(mapa), 0600); err != nil {
+        t.Fatalf("write map: %v", err)
+    }
+    jogo := jogoNovo(1)
+    if err := jogoCarregarMapa(path, &jogo); err != nil {
+        t.Fatalf("jogoCarregarMapa error: %v", err)
+    }
+    sim := novaSimulacao(&jogo, true)
+    tela := novaTelaMemoria(40, 9)
+
+    // do canto, a parede do meio esconde o outro lado e a armadilha
+    interfaceDesenharJogo(tela, &jogo, sim.Armadilhas, sim.Moeda)
+    esperado := "▤▤▤▤\n" +
+        "▤☺ ▤\n" +
+        "▤  ▤\n" +
+        "▤\n" +
+        "▤▤▤▤\n" +
+        "\n" +
+        " | Vidas: 3 | Moedas: 0 | Semente: 1\n" +
+        "\n" +
+        "Use WASD para mover e E para interagir."
+    if tela.Quadro() != esperado {
+        t.Fatalf("unexpected frame:\n%s\nwant:\n%s", tela.Quadro(), esperado)
+    }
+
+    // do outro lado a armadilha aparece; o canto de onde ele veio fica lembrado
+    jogo.PosX, jogo.PosY = 7, 3
+    visaoAtualizar(&jogo)
+    interfaceDesenharJogo(tela, &jogo, sim.Armadilhas, sim.Moeda)
+    esperado = "▤▤▤▤ ▤▤▤▤\n" +
+        "▤  ▤    ▤\n" +
+        "▤  ▤ Δ  ▤\n" +
+        "▤      ☺▤\n" +
+        "▤▤▤▤▤▤▤▤▤\n" +
+        "\n" +
+        " | Vidas: 3 | Moedas: 0 | Semente: 1\n" +
+        "\n" +
+        "Use WASD para mover e E para interagir."
+    if tela.Quadro() != esperado {
+        t.Fatalf("unexpected frame after moving:\n%s\nwant:\n%s", tela.Quadro(), esperado)
+    }
+    if visaoEnxerga(&jogo, 1, 1) || !visaoExplorada(&jogo, 1, 1) {
+        t.Fatalf("start cell should be explored but out of sight")
+    }
+    if visaoExplorada(&jogo, 4, 0) {
+        t.Fatalf("cell (4,0) was never in sight")
+    }
+}
+
+// TestSemNeblina verifica que mapas sem a opção @neblina continuam todo visíveis
+func TestSemNeblina(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "mapa.txt")
+    if err := os.WriteFile(path, []byte("▤▤▤▤\n▤☺▤Δ\n▤▤▤▤\n"), 0600); err != nil {
+        t.Fatalf("write map: %v", err)
+    }
+    jogo := jogoNovo(1)
+    if err := jogoCarregarMapa(path, &jogo); err != nil {
+        t.Fatalf("jogoCarregarMapa error: %v", err)
+    }
+    if jogo.Visao != nil || !visaoEnxerga(&jogo, 3, 1) {
+        t.Fatalf("map without @neblina should be fully visible")
+    }
+}
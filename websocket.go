@@ -0,0 +1,305 @@
+// websocket.go - WebSocket mínimo (RFC 6455) sobre a biblioteca padrão
+//
+// Só o que o transporte ws:// do jogo usa (ver server_ws.go e client_ws.go):
+// handshake HTTP/1.1 dos dois lados, mensagens de texto (frames de
+// continuação são juntados na leitura), ping/pong e close. Sem extensões nem
+// subprotocolos. Frames do cliente saem mascarados, como a RFC exige, e o
+// servidor encerra a conexão que mandar frame sem máscara (§5.1) ou frame de
+// controle fragmentado ou com mais de 125 bytes (§5.5).
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// guidWS é a constante da RFC 6455 usada em Sec-WebSocket-Accept
+const guidWS = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// maxMensagemWS limita o tamanho de uma mensagem recebida
+const maxMensagemWS = 1 << 20
+
+// Opcodes dos frames
+const (
+	opContinuacao = 0x0
+	opTexto       = 0x1
+	opBinario     = 0x2
+	opFechar      = 0x8
+	opPing        = 0x9
+	opPong        = 0xA
+)
+
+// ConexaoWS é uma conexão WebSocket já aberta
+type ConexaoWS struct {
+	conn    net.Conn
+	leitor  *bufio.Reader
+	cliente bool       // mascara os frames enviados
+	escrita sync.Mutex // um frame por vez na conexão
+}
+
+// chaveAceiteWS calcula Sec-WebSocket-Accept a partir de Sec-WebSocket-Key
+func chaveAceiteWS(chave string) string {
+	soma := sha1.Sum([]byte(chave + guidWS))
+	return base64.StdEncoding.EncodeToString(soma[:])
+}
+
+// aceitarWS faz o lado servidor do handshake e assume a conexão do pedido
+func aceitarWS(w http.ResponseWriter, r *http.Request) (*ConexaoWS, error) {
+	chave := r.Header.Get("Sec-WebSocket-Key")
+	if r.Method != http.MethodGet || !cabecalhoContem(r.Header, "Connection", "upgrade") ||
+		!cabecalhoContem(r.Header, "Upgrade", "websocket") || chave == "" {
+		http.Error(w, "websocket handshake expected", http.StatusBadRequest)
+		return nil, errors.New("not a websocket handshake")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "unsupported websocket version", http.StatusUpgradeRequired)
+		return nil, errors.New("unsupported websocket version")
+	}
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "websocket not supported", http.StatusInternalServerError)
+		return nil, errors.New("response writer can't be hijacked")
+	}
+	conn, rw, err := hj.Hijack()
+	if err != nil {
+		return nil, err
+	}
+	resposta := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + chaveAceiteWS(chave) + "\r\n\r\n"
+	if _, err := conn.Write([]byte(resposta)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &ConexaoWS{conn: conn, leitor: rw.Reader}, nil
+}
+
+// conectarWS abre uma conexão WebSocket com endereco (ws://host:porta/caminho)
+func conectarWS(endereco string) (*ConexaoWS, error) {
+	u, err := url.Parse(endereco)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "ws" {
+		return nil, fmt.Errorf("unsupported websocket scheme %q (only ws://)", u.Scheme)
+	}
+	conn, err := net.Dial("tcp", u.Host)
+	if err != nil {
+		return nil, err
+	}
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	chave := base64.StdEncoding.EncodeToString(b)
+	pedido := "GET " + u.RequestURI() + " HTTP/1.1\r\n" +
+		"Host: " + u.Host + "\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Key: " + chave + "\r\n" +
+		"Sec-WebSocket-Version: 13\r\n\r\n"
+	if _, err := conn.Write([]byte(pedido)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	leitor := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(leitor, &http.Request{Method: http.MethodGet})
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Accept") != chaveAceiteWS(chave) {
+		conn.Close()
+		return nil, fmt.Errorf("websocket handshake with %s failed: %s", endereco, resp.Status)
+	}
+	return &ConexaoWS{conn: conn, leitor: leitor, cliente: true}, nil
+}
+
+// cabecalhoContem indica se o cabeçalho nome tem o valor na lista separada por vírgulas
+func cabecalhoContem(h http.Header, nome, valor string) bool {
+	for _, v := range h.Values(nome) {
+		for _, parte := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(parte), valor) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// LerMensagem devolve a próxima mensagem de texto ou binária. Responde pings
+// no caminho e devolve io.EOF quando o outro lado fecha a conexão.
+func (c *ConexaoWS) LerMensagem() ([]byte, error) {
+	var mensagem []byte
+	for {
+		fin, op, dados, err := c.lerFrame()
+		if err != nil {
+			return nil, err
+		}
+		switch op {
+		case opPing:
+			if err := c.escreverFrame(opPong, dados); err != nil {
+				return nil, err
+			}
+			continue
+		case opPong:
+			continue
+		case opFechar:
+			c.escreverFrame(opFechar, dados)
+			return nil, io.EOF
+		case opTexto, opBinario, opContinuacao:
+			if (op == opContinuacao) != (mensagem != nil) {
+				return nil, errors.New("websocket: unexpected continuation frame")
+			}
+			if len(mensagem)+len(dados) > maxMensagemWS {
+				return nil, errors.New("websocket: message too large")
+			}
+			mensagem = append(mensagem, dados...)
+			if mensagem == nil {
+				mensagem = []byte{}
+			}
+		default:
+			return nil, fmt.Errorf("websocket: unknown opcode %d", op)
+		}
+		if fin {
+			return mensagem, nil
+		}
+	}
+}
+
+// maxControleWS é o maior payload de um frame de controle (close, ping, pong)
+const maxControleWS = 125
+
+// lerFrame lê um frame e desfaz a máscara dos dados. Frames que violam a RFC
+// devolvem erro, e quem lê fecha a conexão.
+func (c *ConexaoWS) lerFrame() (fin bool, op byte, dados []byte, err error) {
+	var cab [2]byte
+	if _, err = io.ReadFull(c.leitor, cab[:]); err != nil {
+		return
+	}
+	fin, op = cab[0]&0x80 != 0, cab[0]&0x0F
+	mascarado := cab[1]&0x80 != 0
+	tamanho := uint64(cab[1] & 0x7F)
+	switch tamanho {
+	case 126:
+		var ext [2]byte
+		if _, err = io.ReadFull(c.leitor, ext[:]); err != nil {
+			return
+		}
+		tamanho = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err = io.ReadFull(c.leitor, ext[:]); err != nil {
+			return
+		}
+		tamanho = binary.BigEndian.Uint64(ext[:])
+	}
+	if tamanho > maxMensagemWS {
+		return fin, op, nil, errors.New("websocket: frame too large")
+	}
+	if !c.cliente && !mascarado {
+		return fin, op, nil, errors.New("websocket: unmasked client frame")
+	}
+	if op&opFechar != 0 && (!fin || tamanho > maxControleWS) {
+		return fin, op, nil, errors.New("websocket: invalid control frame")
+	}
+	var mascara [4]byte
+	if mascarado {
+		if _, err = io.ReadFull(c.leitor, mascara[:]); err != nil {
+			return
+		}
+	}
+	dados = make([]byte, tamanho)
+	if _, err = io.ReadFull(c.leitor, dados); err != nil {
+		return
+	}
+	if mascarado {
+		for i := range dados {
+			dados[i] ^= mascara[i%4]
+		}
+	}
+	return fin, op, dados, nil
+}
+
+// EscreverMensagem envia dados numa mensagem de texto
+func (c *ConexaoWS) EscreverMensagem(dados []byte) error {
+	return c.escreverFrame(opTexto, dados)
+}
+
+// escreverFrame envia um frame completo (FIN), mascarado do lado cliente
+func (c *ConexaoWS) escreverFrame(op byte, dados []byte) error {
+	frame := []byte{0x80 | op}
+	bitMascara := byte(0)
+	if c.cliente {
+		bitMascara = 0x80
+	}
+	switch n := len(dados); {
+	case n < 126:
+		frame = append(frame, bitMascara|byte(n))
+	case n <= 0xFFFF:
+		frame = append(frame, bitMascara|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(n))
+	default:
+		frame = append(frame, bitMascara|127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(n))
+	}
+	if c.cliente {
+		var mascara [4]byte
+		if _, err := rand.Read(mascara[:]); err != nil {
+			return err
+		}
+		frame = append(frame, mascara[:]...)
+		inicio := len(frame)
+		frame = append(frame, dados...)
+		for i := range dados {
+			frame[inicio+i] ^= mascara[i%4]
+		}
+	} else {
+		frame = append(frame, dados...)
+	}
+
+	c.escrita.Lock()
+	defer c.escrita.Unlock()
+	_, err := c.conn.Write(frame)
+	return err
+}
+
+// LerJSON lê a próxima mensagem e a decodifica em v
+func (c *ConexaoWS) LerJSON(v interface{}) error {
+	dados, err := c.LerMensagem()
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(dados, v)
+}
+
+// EscreverJSON envia v codificado em JSON numa mensagem de texto
+func (c *ConexaoWS) EscreverJSON(v interface{}) error {
+	dados, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.EscreverMensagem(dados)
+}
+
+// Fechar avisa o outro lado (frame close) e fecha a conexão
+func (c *ConexaoWS) Fechar() error {
+	c.escreverFrame(opFechar, nil)
+	return c.conn.Close()
+}